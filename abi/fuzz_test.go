@@ -0,0 +1,96 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package abi
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fuzzABI covers the types which are not used by contracts in tests/sols
+const fuzzABI = `[
+	{"type":"function","name":"ints","inputs":[{"type":"uint8"},{"type":"int16"},{"type":"int256"},{"type":"uint64"},{"type":"bool"}]},
+	{"type":"function","name":"bytes","inputs":[{"type":"bytes4"},{"type":"bytes"},{"type":"string"},{"type":"bytes32"}]},
+	{"type":"function","name":"arrays","inputs":[{"type":"uint256[3]"},{"type":"address[]"},{"type":"string[]"},{"type":"int8[2][]"}]},
+	{"type":"function","name":"tuples","inputs":[{"type":"tuple","components":[{"name":"a","type":"uint64"},{"name":"b","type":"bytes"}]},{"type":"tuple[]","components":[{"name":"c","type":"bool"},{"name":"d","type":"uint16[]"}]}]}
+]`
+
+// FuzzPackUnpack unpacks arbitrary data by the inputs and outputs of methods of contracts in
+// tests/sols and fuzzABI, the method is selected by the first 4 bytes of data, and the values unpacked
+// should be the same after they are packed and unpacked again.
+// Note: Run it by go test -run=^$ -fuzz=FuzzPackUnpack ./abi
+func FuzzPackUnpack(f *testing.F) {
+	methods := loadSolMethods(f)
+	for _, method := range methods {
+		var words = len(method.Inputs)
+		if len(method.Outputs) > words {
+			words = len(method.Outputs)
+		}
+		f.Add(append(method.ID(), make([]byte, 32*words)...))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) < 4 {
+			return
+		}
+		for _, method := range methods {
+			if string(method.ID()) != string(data[:4]) {
+				continue
+			}
+			checkRoundTrip(t, method.Inputs, data[4:])
+			checkRoundTrip(t, method.Outputs, data[4:])
+		}
+	})
+}
+
+func checkRoundTrip(t *testing.T, arguments Arguments, data []byte) {
+	values, err := arguments.UnpackValues(data)
+	if err != nil {
+		return
+	}
+	packed, err := arguments.Pack(values...)
+	require.NoError(t, err)
+	again, err := arguments.UnpackValues(packed)
+	require.NoError(t, err)
+	require.Equal(t, values, again)
+}
+
+func loadSolMethods(f *testing.F) []Method {
+	files, err := filepath.Glob("../tests/sols/*.abi")
+	require.NoError(f, err)
+	var methods []Method
+	for _, file := range files {
+		abi, err := New(file)
+		require.NoError(f, err)
+		for _, method := range abi.Methods {
+			methods = append(methods, method)
+		}
+	}
+	abi, err := JSON(strings.NewReader(fuzzABI))
+	require.NoError(f, err)
+	for _, method := range abi.Methods {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Sig() < methods[j].Sig()
+	})
+	return methods
+}
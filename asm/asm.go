@@ -0,0 +1,454 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package asm
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/thu-arxan/evm"
+)
+
+// maxMacroDepth limits the nested expansion of macros
+const maxMacroDepth = 16
+
+// Error is the error of assembling, which contains the line of source
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Assemble assembles source into bytecode, the source is line based:
+//
+//	label:                  define a label at the current offset, JUMPDEST is not added
+//	PUSH1 0x80              PUSHn with a number in hex or decimal, or a label expression
+//	PUSH label              PUSH which is sized automatically, label could be end-start
+//	ADD                     any other opcode, the mnemonic is case insensitive
+//	.bytes 0x6001           raw bytes, such as data section or invalid opcodes
+//	.string "hello"         raw bytes of a quoted string
+//	.macro name a b         define a macro with parameters, which are used as $a and $b
+//	.endm                   end the definition of macro
+//	name 1 label            expand a macro
+//
+// Comments begin with ; or //, and the leading 0x pc of a line is ignored, so the
+// output of Program.String could be assembled again.
+func Assemble(source string) ([]byte, error) {
+	var a = &assembler{
+		macros: make(map[string]*macro),
+		labels: make(map[string]int),
+	}
+	if err := a.parse(strings.Split(source, "\n"), 0, 0); err != nil {
+		return nil, err
+	}
+	if a.macro != nil {
+		return nil, &Error{Line: a.macro.line, Msg: fmt.Sprintf("macro %s is not ended", a.macro.name)}
+	}
+	return a.assemble()
+}
+
+// MustAssemble is like Assemble but panics if source could not be assembled
+func MustAssemble(source string) []byte {
+	code, err := Assemble(source)
+	if err != nil {
+		panic(err)
+	}
+	return code
+}
+
+type macro struct {
+	name   string
+	line   int
+	params []string
+	body   []string
+}
+
+// operand is the operand of PUSH, which is a number or label expression
+type operand struct {
+	value *big.Int
+	label string
+	// sub is the label subtracted from label
+	sub string
+}
+
+type item struct {
+	line int
+	op   evm.OpCode
+	// size is the size of PUSH data, and 0 means auto sized
+	size    int
+	operand *operand
+	// data is the raw bytes of .bytes and .string
+	data  []byte
+	isRaw bool
+	// labels are defined at the offset of item
+	labels []string
+	// offset and width are decided by layout
+	offset int
+	width  int
+}
+
+type assembler struct {
+	items   []*item
+	macros  map[string]*macro
+	labels  map[string]int
+	pending []string
+	// macro is the macro being defined
+	macro *macro
+}
+
+func (a *assembler) parse(lines []string, base, depth int) error {
+	for i, line := range lines {
+		var lineNo = base + i + 1
+		if depth > 0 {
+			lineNo = base
+		}
+		if err := a.parseLine(stripComment(line), lineNo, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *assembler) parseLine(line string, lineNo, depth int) error {
+	fail := func(format string, args ...interface{}) error {
+		return &Error{Line: lineNo, Msg: fmt.Sprintf(format, args...)}
+	}
+	fields := strings.Fields(line)
+	if a.macro != nil {
+		if len(fields) > 0 && fields[0] == ".endm" {
+			a.macros[a.macro.name] = a.macro
+			a.macro = nil
+		} else {
+			a.macro.body = append(a.macro.body, line)
+		}
+		return nil
+	}
+	if len(fields) > 1 && strings.HasPrefix(fields[0], "0x") {
+		fields = fields[1:]
+	}
+	for len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+		name := strings.TrimSuffix(fields[0], ":")
+		if depth > 0 {
+			return fail("label %s is not allowed in macro", name)
+		}
+		if !isIdentifier(name) {
+			return fail("invalid label %s", name)
+		}
+		if _, ok := a.labels[name]; ok {
+			return fail("duplicate label %s", name)
+		}
+		a.labels[name] = -1
+		a.pending = append(a.pending, name)
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var name, args = fields[0], fields[1:]
+	switch name {
+	case ".bytes":
+		if len(args) != 1 {
+			return fail(".bytes needs one hex argument")
+		}
+		data, err := parseHex(args[0])
+		if err != nil {
+			return fail("invalid bytes %s", args[0])
+		}
+		a.add(&item{line: lineNo, data: data, isRaw: true})
+		return nil
+	case ".string":
+		text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[strings.Index(line, ".string"):]), ".string"))
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return fail("invalid string %s", text)
+		}
+		a.add(&item{line: lineNo, data: []byte(s), isRaw: true})
+		return nil
+	case ".macro":
+		if depth > 0 {
+			return fail("macro could not be defined in macro")
+		}
+		if len(args) == 0 || !isIdentifier(args[0]) {
+			return fail("invalid macro name")
+		}
+		if _, ok := a.macros[args[0]]; ok {
+			return fail("duplicate macro %s", args[0])
+		}
+		a.macro = &macro{name: args[0], line: lineNo, params: splitArgs(args[1:])}
+		return nil
+	case ".endm":
+		return fail(".endm without .macro")
+	}
+
+	if m, ok := a.macros[name]; ok {
+		return a.expand(m, splitArgs(args), lineNo, depth)
+	}
+	op, ok := evm.StringToOpCode(strings.ToUpper(name))
+	switch {
+	case strings.ToUpper(name) == "PUSH":
+		if len(args) != 1 {
+			return fail("PUSH needs one argument")
+		}
+		operand, err := parseOperand(args[0])
+		if err != nil {
+			return fail("%v", err)
+		}
+		a.add(&item{line: lineNo, op: evm.PUSH1, operand: operand})
+	case !ok:
+		return fail("unknown opcode or macro %s", name)
+	case op.IsPush():
+		if len(args) != 1 {
+			return fail("%s needs one argument", op)
+		}
+		operand, err := parseOperand(args[0])
+		if err != nil {
+			return fail("%v", err)
+		}
+		a.add(&item{line: lineNo, op: op, size: op.PushSize(), operand: operand})
+	default:
+		if len(args) != 0 {
+			return fail("%s has no argument", op)
+		}
+		a.add(&item{line: lineNo, op: op})
+	}
+	return nil
+}
+
+func (a *assembler) expand(m *macro, args []string, lineNo, depth int) error {
+	if depth >= maxMacroDepth {
+		return &Error{Line: lineNo, Msg: fmt.Sprintf("macro %s is nested too deep", m.name)}
+	}
+	if len(args) != len(m.params) {
+		return &Error{Line: lineNo, Msg: fmt.Sprintf("macro %s needs %d arguments but got %d", m.name, len(m.params), len(args))}
+	}
+	var pairs []string
+	for i, param := range m.params {
+		pairs = append(pairs, "$"+param, args[i])
+	}
+	replacer := strings.NewReplacer(pairs...)
+	var body = make([]string, len(m.body))
+	for i, line := range m.body {
+		body[i] = replacer.Replace(line)
+	}
+	return a.parse(body, lineNo, depth+1)
+}
+
+func (a *assembler) add(it *item) {
+	it.labels = a.pending
+	a.pending = nil
+	a.items = append(a.items, it)
+}
+
+// layout decides the offset of items and the width of auto sized PUSH, the
+// width only grows so it always stops
+func (a *assembler) layout() error {
+	for _, it := range a.items {
+		switch {
+		case it.isRaw:
+			it.width = len(it.data)
+		case it.size > 0:
+			it.width = it.size
+		case it.operand != nil && it.operand.value != nil:
+			it.width = byteLen(it.operand.value)
+		case it.operand != nil:
+			it.width = 1
+		}
+	}
+	for {
+		var offset = 0
+		for _, it := range a.items {
+			it.offset = offset
+			for _, label := range it.labels {
+				a.labels[label] = offset
+			}
+			if it.isRaw {
+				offset += it.width
+			} else {
+				offset += 1 + it.width
+			}
+		}
+		for _, label := range a.pending {
+			a.labels[label] = offset
+		}
+		var changed = false
+		for _, it := range a.items {
+			if it.isRaw || it.size > 0 || it.operand == nil || it.operand.value != nil {
+				continue
+			}
+			value, err := a.eval(it)
+			if err != nil {
+				return err
+			}
+			if width := byteLen(value); width > it.width {
+				it.width = width
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+	}
+}
+
+func (a *assembler) eval(it *item) (*big.Int, error) {
+	if it.operand.value != nil {
+		return it.operand.value, nil
+	}
+	offset, ok := a.labels[it.operand.label]
+	if !ok {
+		return nil, &Error{Line: it.line, Msg: fmt.Sprintf("undefined label %s", it.operand.label)}
+	}
+	if it.operand.sub != "" {
+		sub, ok := a.labels[it.operand.sub]
+		if !ok {
+			return nil, &Error{Line: it.line, Msg: fmt.Sprintf("undefined label %s", it.operand.sub)}
+		}
+		if offset < sub {
+			return nil, &Error{Line: it.line, Msg: fmt.Sprintf("%s-%s is negative", it.operand.label, it.operand.sub)}
+		}
+		offset -= sub
+	}
+	return big.NewInt(int64(offset)), nil
+}
+
+func (a *assembler) assemble() ([]byte, error) {
+	if err := a.layout(); err != nil {
+		return nil, err
+	}
+	var code []byte
+	for _, it := range a.items {
+		if it.isRaw {
+			code = append(code, it.data...)
+			continue
+		}
+		if it.operand == nil {
+			code = append(code, byte(it.op))
+			continue
+		}
+		value, err := a.eval(it)
+		if err != nil {
+			return nil, err
+		}
+		if byteLen(value) > it.width {
+			return nil, &Error{Line: it.line, Msg: fmt.Sprintf("value 0x%x overflows %d bytes", value, it.width)}
+		}
+		data := value.Bytes()
+		code = append(code, byte(evm.PUSH1)+byte(it.width-1))
+		code = append(code, make([]byte, it.width-len(data))...)
+		code = append(code, data...)
+	}
+	return code, nil
+}
+
+func parseOperand(s string) (*operand, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty operand")
+	}
+	if s[0] >= '0' && s[0] <= '9' {
+		value, ok := new(big.Int).SetString(s, 0)
+		if !ok || value.Sign() < 0 {
+			return nil, fmt.Errorf("invalid number %s", s)
+		}
+		if value.BitLen() > 256 {
+			return nil, fmt.Errorf("number %s overflows 32 bytes", s)
+		}
+		return &operand{value: value}, nil
+	}
+	var parts = strings.SplitN(s, "-", 2)
+	for _, part := range parts {
+		if !isIdentifier(part) {
+			return nil, fmt.Errorf("invalid label %s", part)
+		}
+	}
+	var o = &operand{label: parts[0]}
+	if len(parts) == 2 {
+		o.sub = parts[1]
+	}
+	return o, nil
+}
+
+// byteLen return the bytes needed by value, which is at least 1
+func byteLen(value *big.Int) int {
+	if n := (value.BitLen() + 7) / 8; n > 0 {
+		return n
+	}
+	return 1
+}
+
+func parseHex(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return nil, fmt.Errorf("hex should begin with 0x")
+	}
+	value, ok := new(big.Int).SetString("1"+s[2:], 16)
+	if !ok || len(s)%2 != 0 {
+		return nil, fmt.Errorf("invalid hex %s", s)
+	}
+	return value.Bytes()[1:], nil
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// splitArgs split arguments by whitespace and comma
+func splitArgs(fields []string) []string {
+	var args []string
+	for _, field := range fields {
+		for _, arg := range strings.Split(field, ",") {
+			if arg != "" {
+				args = append(args, arg)
+			}
+		}
+	}
+	return args
+}
+
+// stripComment remove the comment begins with ; or // which is not quoted
+func stripComment(line string) string {
+	var quoted = false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && quoted:
+			i++
+		case line[i] == '"':
+			quoted = !quoted
+		case !quoted && line[i] == ';':
+			return line[:i]
+		case !quoted && line[i] == '/' && i+1 < len(line) && line[i+1] == '/':
+			return line[:i]
+		}
+	}
+	return line
+}
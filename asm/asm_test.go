@@ -0,0 +1,149 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package asm
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssemble(t *testing.T) {
+	code, err := Assemble(`
+		push1 0x80 ; comment
+		PUSH 0x40  // another comment
+		MSTORE
+		PUSH2 1
+		PUSH 0
+		PUSH 256
+	`)
+	require.NoError(t, err)
+	require.Equal(t, util.Hex2Bytes("608060405261000160006101"+"00"), code)
+}
+
+func TestLabel(t *testing.T) {
+	code, err := Assemble(`
+		PUSH end
+		JUMP
+		.bytes 0xfe
+	end:
+		JUMPDEST
+		PUSH data_end-data
+		PUSH data
+		PUSH1 0
+		CODECOPY
+		STOP
+	data:
+		.string "hi;\"//"
+	data_end:
+	`)
+	require.NoError(t, err)
+	require.Equal(t, util.Hex2Bytes("600456fe5b6006600d60003900"+"68693b222f2f"), code)
+
+	// the label after 256 bytes needs PUSH2, and the jump before it grows too
+	code, err = Assemble("PUSH far\nJUMP\n.bytes 0x" + strings.Repeat("00", 256) + "\nfar: JUMPDEST")
+	require.NoError(t, err)
+	require.Equal(t, util.Hex2Bytes("610104"), code[:3])
+	require.EqualValues(t, evm.JUMPDEST, code[0x104])
+}
+
+func TestMacro(t *testing.T) {
+	code, err := Assemble(`
+		.macro store slot, value
+		PUSH $value
+		PUSH $slot
+		SSTORE
+		.endm
+		.macro twice a
+		store $a $a
+		store $a 2
+		.endm
+		twice 1
+	`)
+	require.NoError(t, err)
+	require.Equal(t, util.Hex2Bytes("600160015560026001"+"55"), code)
+}
+
+func TestAssembleError(t *testing.T) {
+	for source, line := range map[string]int{
+		"PUSH1 0x100":                        1,
+		"\nFOO":                              2,
+		"ADD 1":                              1,
+		"PUSH missing":                       1,
+		"a:\na:":                             2,
+		".macro m\nPUSH 1":                   1,
+		".macro m\nl:\n.endm\n\nm":           5,
+		"PUSH a-b\na: STOP\nb: STOP":         1,
+		".bytes 0x123":                       1,
+		"PUSH 0x1" + strings.Repeat("0", 64): 1,
+	} {
+		_, err := Assemble(source)
+		require.Error(t, err, source)
+		require.Equal(t, line, err.(*Error).Line, source)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../tests/sols/*.bin")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	for _, file := range files {
+		code, err := util.ReadBinFile(file)
+		require.NoError(t, err)
+		if len(code) == 0 {
+			continue
+		}
+		assembled, err := Assemble(Disassemble(code).String())
+		require.NoError(t, err, file)
+		require.Equal(t, code, assembled, file)
+	}
+	code := util.Hex2Bytes("60806040520c5b6101")
+	require.Equal(t, code, MustAssemble(Disassemble(code).String()))
+}
+
+func TestRun(t *testing.T) {
+	// return 1 + 2 after jumping over the invalid opcode
+	code := MustAssemble(`
+		PUSH 2
+		PUSH 1
+		ADD
+		PUSH ret
+		JUMP
+		INVALID
+	ret:
+		JUMPDEST
+		PUSH 0
+		MSTORE
+		PUSH 32
+		PUSH 0
+		RETURN
+	`)
+	bc := example.NewBlockchain()
+	var gas uint64 = 100000
+	vm := evm.New(bc, db.NewMemory(bc.NewAccount), &evm.Context{Gas: &gas})
+	output, err := vm.Call(example.RandomAddress(), example.RandomAddress(), code)
+	require.NoError(t, err)
+	require.Equal(t, util.LeftPadBytes([]byte{3}, 32), output)
+}
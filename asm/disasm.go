@@ -0,0 +1,190 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package asm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/thu-arxan/evm"
+)
+
+// Instruction is an instruction of bytecode
+type Instruction struct {
+	PC uint64
+	Op evm.OpCode
+	// Data is the immediate data of PUSH
+	Data []byte
+	// Invalid is true if the opcode is not defined
+	Invalid bool
+	// Truncated is true if the PUSH data is shorter than the PUSH size because code ends
+	Truncated bool
+}
+
+// String return the instruction in the format of assembler, the undefined opcode
+// and truncated PUSH are written as raw bytes
+func (ins *Instruction) String() string {
+	switch {
+	case ins.Invalid:
+		return fmt.Sprintf(".bytes 0x%02x ; invalid opcode", byte(ins.Op))
+	case ins.Truncated:
+		return fmt.Sprintf(".bytes 0x%02x%x ; truncated %s", byte(ins.Op), ins.Data, ins.Op)
+	case ins.Op.IsPush():
+		return fmt.Sprintf("%s 0x%x", ins.Op, ins.Data)
+	default:
+		return ins.Op.String()
+	}
+}
+
+// Size return the size of instruction in bytes
+func (ins *Instruction) Size() uint64 {
+	return 1 + uint64(len(ins.Data))
+}
+
+// Program is the disassembled bytecode
+type Program struct {
+	Instructions []*Instruction
+	// Metadata is the CBOR encoded metadata trailer of solc, which is not disassembled
+	Metadata []byte
+}
+
+// Disassemble disassembles code, the solc metadata trailer is split off if exist
+func Disassemble(code []byte) *Program {
+	var program = &Program{}
+	code, program.Metadata = SplitMetadata(code)
+	for pc := uint64(0); pc < uint64(len(code)); {
+		op := evm.OpCode(code[pc])
+		ins := &Instruction{
+			PC:      pc,
+			Op:      op,
+			Invalid: !op.IsDefined(),
+		}
+		if size := uint64(op.PushSize()); size > 0 {
+			end := pc + 1 + size
+			if end > uint64(len(code)) {
+				end = uint64(len(code))
+				ins.Truncated = true
+			}
+			ins.Data = code[pc+1 : end]
+		}
+		program.Instructions = append(program.Instructions, ins)
+		pc += ins.Size()
+	}
+	return program
+}
+
+// SplitMetadata split code into the executable part and the solc metadata trailer,
+// which is a CBOR map followed by its length in 2 bytes. The metadata is nil if not found.
+func SplitMetadata(code []byte) ([]byte, []byte) {
+	if len(code) < 2 {
+		return code, nil
+	}
+	length := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	start := len(code) - 2 - length
+	if length == 0 || start < 0 {
+		return code, nil
+	}
+	// CBOR map with 1 to 15 pairs
+	if code[start] < 0xa1 || code[start] > 0xaf {
+		return code, nil
+	}
+	metadata := code[start:]
+	for _, key := range []string{"solc", "ipfs", "bzzr0", "bzzr1", "experimental"} {
+		if bytes.Contains(metadata, []byte(key)) {
+			return code[:start], metadata
+		}
+	}
+	return code, nil
+}
+
+// Code return the bytecode of program
+func (p *Program) Code() []byte {
+	var code []byte
+	for _, ins := range p.Instructions {
+		code = append(code, byte(ins.Op))
+		code = append(code, ins.Data...)
+	}
+	return append(code, p.Metadata...)
+}
+
+// WriteTo writes program in the human readable format, every line is an
+// instruction begins with its pc, and it could be assembled again.
+func (p *Program) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	for _, ins := range p.Instructions {
+		fmt.Fprintf(&buf, "0x%04x  %s\n", ins.PC, ins)
+	}
+	if len(p.Metadata) > 0 {
+		var pc uint64
+		if n := len(p.Instructions); n > 0 {
+			pc = p.Instructions[n-1].PC + p.Instructions[n-1].Size()
+		}
+		fmt.Fprintf(&buf, "0x%04x  .bytes 0x%x ; metadata\n", pc, p.Metadata)
+	}
+	return buf.WriteTo(w)
+}
+
+// String return program in the human readable format
+func (p *Program) String() string {
+	var buf bytes.Buffer
+	p.WriteTo(&buf)
+	return buf.String()
+}
+
+type jsonInstruction struct {
+	PC        uint64 `json:"pc"`
+	Op        string `json:"op"`
+	Opcode    byte   `json:"opcode"`
+	Data      string `json:"data,omitempty"`
+	Invalid   bool   `json:"invalid,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+type jsonProgram struct {
+	Instructions []*jsonInstruction `json:"instructions"`
+	Metadata     string             `json:"metadata,omitempty"`
+}
+
+// MarshalJSON is the implementation of json.Marshaler
+func (p *Program) MarshalJSON() ([]byte, error) {
+	var program = jsonProgram{
+		Instructions: make([]*jsonInstruction, len(p.Instructions)),
+	}
+	for i, ins := range p.Instructions {
+		program.Instructions[i] = &jsonInstruction{
+			PC:        ins.PC,
+			Op:        ins.Op.String(),
+			Opcode:    byte(ins.Op),
+			Invalid:   ins.Invalid,
+			Truncated: ins.Truncated,
+		}
+		if ins.Invalid {
+			program.Instructions[i].Op = "INVALID"
+		}
+		if len(ins.Data) > 0 {
+			program.Instructions[i].Data = "0x" + hex.EncodeToString(ins.Data)
+		}
+	}
+	if len(p.Metadata) > 0 {
+		program.Metadata = "0x" + hex.EncodeToString(p.Metadata)
+	}
+	return json.Marshal(program)
+}
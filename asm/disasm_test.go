@@ -0,0 +1,77 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package asm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisassemble(t *testing.T) {
+	// PUSH1 0x80 PUSH1 0x40 MSTORE 0x0c(invalid) JUMPDEST PUSH2 0x01(truncated)
+	program := Disassemble(util.Hex2Bytes("60806040520c5b6101"))
+	require.Len(t, program.Instructions, 6)
+	require.Nil(t, program.Metadata)
+	require.Equal(t, &Instruction{PC: 0, Op: evm.PUSH1, Data: []byte{0x80}}, program.Instructions[0])
+	require.Equal(t, &Instruction{PC: 5, Op: evm.OpCode(0x0c), Invalid: true}, program.Instructions[3])
+	require.Equal(t, &Instruction{PC: 7, Op: evm.PUSH2, Data: []byte{0x01}, Truncated: true}, program.Instructions[5])
+	require.Equal(t, "0x0000  PUSH1 0x80\n"+
+		"0x0002  PUSH1 0x40\n"+
+		"0x0004  MSTORE\n"+
+		"0x0005  .bytes 0x0c ; invalid opcode\n"+
+		"0x0006  JUMPDEST\n"+
+		"0x0007  .bytes 0x6101 ; truncated PUSH2\n", program.String())
+	require.Equal(t, util.Hex2Bytes("60806040520c5b6101"), program.Code())
+
+	// the JUMPDEST in PUSH data is not an instruction
+	program = Disassemble(util.Hex2Bytes("615b5b5b"))
+	require.Len(t, program.Instructions, 2)
+	require.Equal(t, evm.JUMPDEST, program.Instructions[1].Op)
+	require.EqualValues(t, 3, program.Instructions[1].PC)
+}
+
+func TestMetadata(t *testing.T) {
+	code, err := util.ReadBinFile("../tests/sols/Balance_sol_Balance.bin")
+	require.NoError(t, err)
+	program := Disassemble(code)
+	require.NotEmpty(t, program.Metadata)
+	require.EqualValues(t, 0xa2, program.Metadata[0])
+	require.Equal(t, code, program.Code())
+	for _, ins := range program.Instructions {
+		require.False(t, ins.Truncated)
+	}
+
+	// the length looks like a trailer but the map is not metadata
+	executable, metadata := SplitMetadata(util.Hex2Bytes("00a101020003"))
+	require.Nil(t, metadata)
+	require.Len(t, executable, 6)
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(Disassemble(util.Hex2Bytes("60fffe0c")))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"instructions":[
+		{"pc":0,"op":"PUSH1","opcode":96,"data":"0xff"},
+		{"pc":2,"op":"INVALID","opcode":254},
+		{"pc":3,"op":"INVALID","opcode":12,"invalid":true}]}`, string(data))
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/errors"
 	"github.com/thu-arxan/evm/util"
 )
 
@@ -28,23 +29,70 @@ import (
 // It will simulate operate on a db, and sync to db if necessary.
 // Note: It's not thread safety because now it will only be used in one thread.
 type Cache struct {
-	db       DB
+	db       FallibleDB
 	readonly bool
 	accounts map[string]*accountInfo
 	logs     []*Log
+	// deleteEmpty is set if the touched empty accounts are deleted by Sync(EIP-161)
+	deleteEmpty bool
+	// journal records the changes of cache, which are undone by revert
+	journal []journalEntry
+	// err is the first failure of db
+	err error
+
+	accountFunc func(address Address) Account
 }
 
 type accountInfo struct {
 	account Account
 	storage map[string][]byte
 	updated bool
+	// touched is set if the account is modified or called, and it is deleted
+	// if it is empty at the end of a transaction(EIP-161)
+	touched bool
+	// storageUpdated is set if the storage is written
+	storageUpdated bool
+}
+
+// journalEntry is the state of an account before a change, or a log if info is nil
+type journalEntry struct {
+	info                             *accountInfo
+	account                          Account
+	updated, touched, storageUpdated bool
+	// storageKey is set if the change writes a storage, and storageValue is the
+	// value in cache before it, which is nil if the key is not cached
+	storageKey   *string
+	storageValue []byte
 }
 
 // NewCache is the constructor of Cache
 func NewCache(db DB) *Cache {
+	return NewFallibleCache(ToFallibleDB(db), nil)
+}
+
+// NewFallibleCache is the constructor of Cache on a FallibleDB, and accountFunc
+// creates the default account if the db fails to load an account, which is an
+// empty account if accountFunc is nil
+func NewFallibleCache(db FallibleDB, accountFunc func(address Address) Account) *Cache {
+	if accountFunc == nil {
+		accountFunc = newDefaultAccount
+	}
 	return &Cache{
-		db:       db,
-		accounts: make(map[string]*accountInfo),
+		db:          db,
+		accounts:    make(map[string]*accountInfo),
+		accountFunc: accountFunc,
+	}
+}
+
+// Error return the first failure of db, which is an *errors.DBError, and the
+// cache should not be used any more if it is not nil
+func (cache *Cache) Error() error {
+	return cache.err
+}
+
+func (cache *Cache) pushError(err error) {
+	if err != nil && cache.err == nil {
+		cache.err = &errors.DBError{Err: err}
 	}
 }
 
@@ -58,7 +106,9 @@ func (cache *Cache) Exist(addr Address) bool {
 		}
 		// maybe a cache of default account, we need to ask underlying database to figure out if the account exist
 	}
-	return cache.db.Exist(addr)
+	exist, err := cache.db.TryExist(addr)
+	cache.pushError(err)
+	return exist
 }
 
 // HasSuicide return if an account has suicide
@@ -78,15 +128,27 @@ func (cache *Cache) UpdateAccount(account Account) error {
 	if accInfo.account.HasSuicide() {
 		return fmt.Errorf("UpdateAccount on a removed account: %s", account.GetAddress())
 	}
+	cache.record(accInfo, accInfo.account)
 	accInfo.account = account.Copy()
 	accInfo.updated = true
+	accInfo.touched = true
 	return nil
 }
 
+// touch mark an account as touched without modifying it, such as the target of a call
+func (cache *Cache) touch(address Address) {
+	accInfo := cache.get(address)
+	cache.record(accInfo, accInfo.account)
+	accInfo.touched = true
+}
+
 // Suicide remove an account
 func (cache *Cache) Suicide(address Address) error {
 	accInfo := cache.get(address)
+	// the account is modified in place, so a copy is recorded
+	cache.record(accInfo, accInfo.account.Copy())
 	accInfo.account.Suicide()
+	accInfo.updated = true
 	return nil
 }
 
@@ -97,7 +159,11 @@ func (cache *Cache) GetStorage(address Address, key core.Word256) []byte {
 	if value, ok := accInfo.storage[storageKey]; ok {
 		return value
 	}
-	value := cache.db.GetStorage(address, key.Bytes())
+	value, err := cache.db.TryGetStorage(address, key.Bytes())
+	if err != nil {
+		cache.pushError(err)
+		return make([]byte, 32)
+	}
 	// avoid the db just return nil if storage is not exist
 	if len(value) == 0 {
 		value = make([]byte, 32)
@@ -106,6 +172,13 @@ func (cache *Cache) GetStorage(address Address, key core.Word256) []byte {
 	return value
 }
 
+// getOriginStorage return the storage in db, which is not modified by the cache
+func (cache *Cache) getOriginStorage(address Address, key core.Word256) []byte {
+	value, err := cache.db.TryGetStorage(address, key.Bytes())
+	cache.pushError(err)
+	return value
+}
+
 // SetStorage set the storage of address
 // NOTE: Set value to zero to remove. How should i understand this?
 // TODO: Review this
@@ -115,8 +188,14 @@ func (cache *Cache) SetStorage(address Address, key core.Word256, value []byte)
 	// if accInfo.removed {
 	// 	return fmt.Errorf("SetStorage on a removed account: %s", addressToString(address))
 	// }
-	accInfo.storage[word256ToString(key)] = value
+	storageKey := word256ToString(key)
+	cache.record(accInfo, accInfo.account)
+	entry := &cache.journal[len(cache.journal)-1]
+	entry.storageKey = &storageKey
+	entry.storageValue = accInfo.storage[storageKey]
+	accInfo.storage[storageKey] = value
 	accInfo.updated = true
+	accInfo.storageUpdated = true
 }
 
 // GetNonce return the nonce of account
@@ -127,22 +206,89 @@ func (cache *Cache) GetNonce(address Address) uint64 {
 // AddLog add log
 func (cache *Cache) AddLog(log *Log) {
 	cache.logs = append(cache.logs, log)
+	cache.journal = append(cache.journal, journalEntry{})
+}
+
+// record append the state of an account before a change to the journal
+func (cache *Cache) record(info *accountInfo, account Account) {
+	cache.journal = append(cache.journal, journalEntry{
+		info:           info,
+		account:        account,
+		updated:        info.updated,
+		touched:        info.touched,
+		storageUpdated: info.storageUpdated,
+	})
+}
+
+// snapshot return the id of current state, so the changes after it could be
+// dropped by revert. It costs nothing but the length of journal.
+func (cache *Cache) snapshot() int {
+	return len(cache.journal)
+}
+
+// revert undo the changes after snapshot id in reverse order, and the ids
+// after it should not be used again
+func (cache *Cache) revert(id int) {
+	for i := len(cache.journal) - 1; i >= id; i-- {
+		entry := cache.journal[i]
+		if entry.info == nil {
+			cache.logs = cache.logs[:len(cache.logs)-1]
+			continue
+		}
+		entry.info.account = entry.account
+		entry.info.updated = entry.updated
+		entry.info.touched = entry.touched
+		entry.info.storageUpdated = entry.storageUpdated
+		if entry.storageKey != nil {
+			if entry.storageValue == nil {
+				delete(entry.info.storage, *entry.storageKey)
+			} else {
+				entry.info.storage[*entry.storageKey] = entry.storageValue
+			}
+		}
+	}
+	cache.journal = cache.journal[:id]
 }
 
-// Sync will sync change to db
-func (cache *Cache) Sync() {
+// Sync will sync change to db, and nothing is synced if it returns an error
+func (cache *Cache) Sync() error {
+	// the changes are made on a broken state
+	if cache.err != nil {
+		return cache.err
+	}
 	wb := cache.db.NewWriteBatch()
 	for _, info := range cache.accounts {
-		if info.updated {
+		address := info.account.GetAddress()
+		switch {
+		case info.account.HasSuicide():
+			wb.DeleteAccount(address)
+		case cache.deleteEmpty && info.touched && !info.storageUpdated && isEmptyAccount(info.account):
+			// Note: It differs from EIP-161 that the empty account whose storage is
+			// written is kept, because the code may be given by Call rather than
+			// stored in the account. An account which is not exist is not deleted,
+			// so a read-only call writes nothing.
+			exist, err := cache.db.TryExist(address)
+			if err != nil {
+				wb.Discard()
+				return err
+			}
+			if exist {
+				wb.DeleteAccount(address)
+			}
+		case info.updated:
 			for key, value := range info.storage {
-				wb.SetStorage(info.account.GetAddress(), stringToWord256(key).Bytes(), value)
+				wb.SetStorage(address, stringToWord256(key).Bytes(), value)
+			}
+			if err := wb.UpdateAccount(info.account); err != nil {
+				wb.Discard()
+				return err
 			}
-			wb.UpdateAccount(info.account)
 		}
 	}
 	for i := range cache.logs {
 		wb.AddLog(cache.logs[i])
 	}
+	return wb.Commit()
 }
 
 // get the cache accountInfo item creating it if necessary
@@ -152,8 +298,17 @@ func (cache *Cache) get(address Address) *accountInfo {
 		return account
 	}
 	// Then try to load from db
-	// todo: should return error?
-	account := cache.db.GetAccount(address)
+	account, err := cache.db.TryGetAccount(address)
+	if err != nil {
+		cache.pushError(err)
+		// the execution will be aborted, so the default account is not cached
+		return &accountInfo{
+			account: cache.accountFunc(address),
+			storage: make(map[string][]byte),
+		}
+	}
+	// copy it so the db will not be modified before sync
+	account = account.Copy()
 	// set the account
 	cache.accounts[key] = &accountInfo{
 		account: account,
@@ -0,0 +1,238 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package cfg
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/asm"
+)
+
+// Block is a basic block, which is a sequence of instructions that only the
+// first one could be jumped to and only the last one could jump.
+type Block struct {
+	// Start is the pc of the first instruction
+	Start uint64
+	// End is the pc after the last instruction
+	End          uint64
+	Instructions []*asm.Instruction
+	// Gas is the sum of constant gas of instructions, the memory expansion and
+	// other gas depend on operands are not included
+	Gas uint64
+	// Next is the block falls through to, which is nil if the block halts or jumps unconditionally
+	Next *Block
+	// Jump is the static target of JUMP or JUMPI
+	Jump *Block
+	// Dynamic is true if the target of JUMP or JUMPI could not be resolved statically
+	Dynamic bool
+	// InvalidJump is true if the static target is not a JUMPDEST
+	InvalidJump bool
+	// Preds are the blocks which fall through or jump to the block statically
+	Preds     []*Block
+	Reachable bool
+}
+
+// Last return the last instruction of block
+func (b *Block) Last() *asm.Instruction {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+// Succs return the blocks which the block falls through or jumps to statically
+func (b *Block) Succs() []*Block {
+	var succs []*Block
+	if b.Next != nil {
+		succs = append(succs, b.Next)
+	}
+	if b.Jump != nil && b.Jump != b.Next {
+		succs = append(succs, b.Jump)
+	}
+	return succs
+}
+
+// CFG is the control flow graph of bytecode
+type CFG struct {
+	// Blocks are sorted by pc
+	Blocks []*Block
+	// Metadata is the solc metadata trailer which is not analysed
+	Metadata []byte
+	blocks   map[uint64]*Block
+}
+
+// New builds the control flow graph of code
+func New(code []byte) *CFG {
+	program := asm.Disassemble(code)
+	cfg := &CFG{
+		Metadata: program.Metadata,
+		blocks:   make(map[uint64]*Block),
+	}
+	var block *Block
+	for _, ins := range program.Instructions {
+		if block == nil || ins.Op == evm.JUMPDEST {
+			block = &Block{Start: ins.PC}
+			cfg.Blocks = append(cfg.Blocks, block)
+			cfg.blocks[block.Start] = block
+		}
+		block.Instructions = append(block.Instructions, ins)
+		block.End = ins.PC + ins.Size()
+		block.Gas += evm.ConstantGas(ins.Op)
+		if endsBlock(ins) {
+			block = nil
+		}
+	}
+	for i, block := range cfg.Blocks {
+		last := block.Last()
+		if !halts(last) && i+1 < len(cfg.Blocks) {
+			block.Next = cfg.Blocks[i+1]
+		}
+		if last.Invalid || (last.Op != evm.JUMP && last.Op != evm.JUMPI) {
+			continue
+		}
+		target := jumpTarget(block.Instructions)
+		switch {
+		case target == nil:
+			block.Dynamic = true
+		case !target.IsUint64() || cfg.jumpDest(target.Uint64()) == nil:
+			block.InvalidJump = true
+		default:
+			block.Jump = cfg.jumpDest(target.Uint64())
+		}
+	}
+	for _, block := range cfg.Blocks {
+		for _, succ := range block.Succs() {
+			succ.Preds = append(succ.Preds, block)
+		}
+	}
+	cfg.markReachable()
+	return cfg
+}
+
+// Block return the block which contains pc, or nil if pc is out of code
+func (c *CFG) Block(pc uint64) *Block {
+	i := sort.Search(len(c.Blocks), func(i int) bool {
+		return c.Blocks[i].End > pc
+	})
+	if i < len(c.Blocks) && c.Blocks[i].Start <= pc {
+		return c.Blocks[i]
+	}
+	return nil
+}
+
+// Unreachable return the blocks which could not be reached from the entry.
+// Note: A dynamic jump is assumed to jump to any JUMPDEST, so the result is conservative.
+func (c *CFG) Unreachable() []*Block {
+	var blocks []*Block
+	for _, block := range c.Blocks {
+		if !block.Reachable {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// jumpDest return the block begins with JUMPDEST at pc
+func (c *CFG) jumpDest(pc uint64) *Block {
+	block, ok := c.blocks[pc]
+	if !ok || block.Instructions[0].Op != evm.JUMPDEST {
+		return nil
+	}
+	return block
+}
+
+func (c *CFG) markReachable() {
+	if len(c.Blocks) == 0 {
+		return
+	}
+	var queue = []*Block{c.Blocks[0]}
+	var dynamic = false
+	c.Blocks[0].Reachable = true
+	for len(queue) > 0 {
+		block := queue[0]
+		queue = queue[1:]
+		var succs = block.Succs()
+		if block.Dynamic && !dynamic {
+			dynamic = true
+			for _, b := range c.Blocks {
+				if b.Instructions[0].Op == evm.JUMPDEST {
+					succs = append(succs, b)
+				}
+			}
+		}
+		for _, succ := range succs {
+			if !succ.Reachable {
+				succ.Reachable = true
+				queue = append(queue, succ)
+			}
+		}
+	}
+}
+
+// endsBlock return if the next instruction begins a new block
+func endsBlock(ins *asm.Instruction) bool {
+	return ins.Op == evm.JUMPI || halts(ins)
+}
+
+// halts return if the instruction never falls through
+func halts(ins *asm.Instruction) bool {
+	if ins.Invalid {
+		return true
+	}
+	switch ins.Op {
+	case evm.STOP, evm.JUMP, evm.RETURN, evm.REVERT, evm.INVALID, evm.SELFDESTRUCT:
+		return true
+	}
+	return false
+}
+
+// jumpTarget return the target of the JUMP or JUMPI ends instructions, which
+// is tracked through PUSH, DUP, SWAP and POP in the block, or nil if unknown
+func jumpTarget(instructions []*asm.Instruction) *big.Int {
+	// stack holds the known values on the top of stack, nil means unknown
+	var stack []*big.Int
+	// peek makes sure the n-th item from top is tracked and return its index
+	peek := func(n int) int {
+		for len(stack) < n {
+			stack = append([]*big.Int{nil}, stack...)
+		}
+		return len(stack) - n
+	}
+	for _, ins := range instructions[:len(instructions)-1] {
+		switch {
+		case ins.Truncated:
+			return nil
+		case ins.Op.IsPush():
+			stack = append(stack, new(big.Int).SetBytes(ins.Data))
+		case ins.Op >= evm.DUP1 && ins.Op <= evm.DUP16:
+			stack = append(stack, stack[peek(int(ins.Op-evm.DUP1)+1)])
+		case ins.Op >= evm.SWAP1 && ins.Op <= evm.SWAP16:
+			i, top := peek(int(ins.Op-evm.SWAP1)+2), peek(1)
+			stack[i], stack[top] = stack[top], stack[i]
+		case ins.Op == evm.POP:
+			stack = stack[:peek(1)]
+		case ins.Op == evm.JUMPDEST:
+		default:
+			// the stack effect of other opcodes is not tracked
+			stack = nil
+		}
+	}
+	if len(stack) == 0 {
+		return nil
+	}
+	return stack[len(stack)-1]
+}
@@ -0,0 +1,102 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package cfg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/thu-arxan/evm/asm"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCFG(t *testing.T) {
+	code := asm.MustAssemble(`
+		PUSH 0
+		CALLDATALOAD
+		PUSH then
+		JUMPI
+		PUSH 1
+		PUSH else
+		SWAP1
+		POP
+		JUMP
+		ADD           ; dead code
+	then:
+		JUMPDEST
+		STOP
+	else:
+		JUMPDEST
+		PUSH 21
+		JUMP          ; jumps to the PUSH data
+		.bytes 0x605b
+	`)
+	cfg := New(code)
+	require.Len(t, cfg.Blocks, 6)
+	entry, right, dead, then, elseBlock := cfg.Blocks[0], cfg.Blocks[1], cfg.Blocks[2], cfg.Blocks[3], cfg.Blocks[4]
+	require.Equal(t, then, entry.Jump)
+	require.Equal(t, right, entry.Next)
+	require.EqualValues(t, 3+3+3+10, entry.Gas)
+	require.Equal(t, elseBlock, right.Jump)
+	require.Nil(t, right.Next)
+	require.False(t, dead.Reachable)
+	require.Equal(t, []*Block{dead, cfg.Blocks[5]}, cfg.Unreachable())
+	require.Equal(t, []*Block{entry, dead}, then.Preds)
+	require.True(t, elseBlock.InvalidJump)
+	require.Equal(t, elseBlock, cfg.Block(elseBlock.End-1))
+	require.Nil(t, cfg.Block(uint64(len(code))))
+
+	// the dynamic jump could reach any JUMPDEST
+	cfg = New(asm.MustAssemble("PUSH 0\nCALLDATALOAD\nJUMP\nSTOP\nl: JUMPDEST\nSTOP"))
+	require.True(t, cfg.Blocks[0].Dynamic)
+	require.Equal(t, []*Block{cfg.Blocks[1]}, cfg.Unreachable())
+}
+
+func TestFunctions(t *testing.T) {
+	code, err := util.ReadBinFile("../tests/sols/Balance_sol_Balance.bin")
+	require.NoError(t, err)
+	// the runtime code follows RETURN INVALID of the constructor
+	cfg := New(code[bytes.Index(code, []byte{0xf3, 0xfe})+2:])
+	require.NotEmpty(t, cfg.Metadata)
+	var selectors []string
+	for _, function := range cfg.Functions() {
+		require.Equal(t, "JUMPDEST", function.Entry.Instructions[0].Op.String())
+		selectors = append(selectors, fmt.Sprintf("%x", function.Selector))
+	}
+	require.Equal(t, []string{"1003e2d2", "27ee58a6", "370158ea", "60fe47b1", "6d4ce63c"}, selectors)
+
+	code = asm.MustAssemble("PUSH 0\nCALLDATALOAD\nPUSH 0xe0\nSHR\nPUSH4 0x12345678\nDUP2\nEQ\nPUSH f\nJUMPI\nSTOP\nf: JUMPDEST\nSTOP")
+	functions := New(code).Functions()
+	require.Len(t, functions, 1)
+	require.Equal(t, [4]byte{0x12, 0x34, 0x56, 0x78}, functions[0].Selector)
+}
+
+func TestDOT(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := New(asm.MustAssemble("PUSH l\nJUMPI\nINVALID\nl: JUMPDEST\nSTOP"))
+	require.NoError(t, cfg.WriteDOT(&buf))
+	dot := buf.String()
+	require.True(t, strings.HasPrefix(dot, "digraph cfg {\n"))
+	require.Contains(t, dot, "\tblock_0 [label=\"0x0000  PUSH1 0x04\\l0x0002  JUMPI\\lgas: 13\\l\"];\n")
+	require.Contains(t, dot, "\tblock_0 -> block_3 [style=dashed];\n")
+	require.Contains(t, dot, "\tblock_0 -> block_4;\n")
+}
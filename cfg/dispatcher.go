@@ -0,0 +1,75 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package cfg
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/asm"
+)
+
+// Function is a public function found in the dispatcher of solidity
+type Function struct {
+	Selector [4]byte
+	// Entry is the block the dispatcher jumps to if the selector matches
+	Entry *Block
+}
+
+// Functions return the functions found in the solidity dispatcher, which
+// compares the selector and jumps in the pattern of
+//
+//	DUP1 PUSH4 selector EQ PUSH target JUMPI
+//
+// or PUSH4 selector DUP2 EQ, and it works without the ABI.
+func (c *CFG) Functions() []*Function {
+	var functions []*Function
+	var found = make(map[[4]byte]bool)
+	for _, block := range c.Blocks {
+		if block.Jump == nil || block.Last().Op != evm.JUMPI {
+			continue
+		}
+		selector, ok := matchSelector(block.Instructions)
+		if !ok || found[selector] {
+			continue
+		}
+		found[selector] = true
+		functions = append(functions, &Function{
+			Selector: selector,
+			Entry:    block.Jump,
+		})
+	}
+	return functions
+}
+
+// matchSelector matches PUSH4 selector, DUPn or nothing, EQ, PUSH target, JUMPI
+// at the end of instructions
+func matchSelector(instructions []*asm.Instruction) ([4]byte, bool) {
+	var selector [4]byte
+	var n = len(instructions)
+	if n < 4 || !instructions[n-2].Op.IsPush() || instructions[n-3].Op != evm.EQ {
+		return selector, false
+	}
+	var push = instructions[n-4]
+	if push.Op >= evm.DUP1 && push.Op <= evm.DUP16 && n >= 5 {
+		push = instructions[n-5]
+	}
+	if push.Op != evm.PUSH4 || push.Truncated {
+		return selector, false
+	}
+	copy(selector[:], push.Data)
+	return selector, true
+}
@@ -0,0 +1,63 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package cfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the graph in the DOT language of graphviz, the unreachable
+// blocks are gray, the jump edges are solid and the fall through edges are dashed
+func (c *CFG) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph cfg {")
+	fmt.Fprintln(bw, "\tnode [shape=box fontname=monospace];")
+	for _, block := range c.Blocks {
+		var lines []string
+		for _, ins := range block.Instructions {
+			lines = append(lines, fmt.Sprintf("0x%04x  %s", ins.PC, ins))
+		}
+		lines = append(lines, fmt.Sprintf("gas: %d", block.Gas))
+		label := strings.ReplaceAll(strings.Join(lines, "\\l")+"\\l", "\"", "\\\"")
+		var style string
+		switch {
+		case !block.Reachable:
+			style = " style=filled fillcolor=lightgray"
+		case block.InvalidJump:
+			style = " color=red"
+		}
+		fmt.Fprintf(bw, "\t%s [label=\"%s\"%s];\n", nodeName(block), label, style)
+	}
+	for _, block := range c.Blocks {
+		if block.Next != nil {
+			fmt.Fprintf(bw, "\t%s -> %s [style=dashed];\n", nodeName(block), nodeName(block.Next))
+		}
+		if block.Jump != nil {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", nodeName(block), nodeName(block.Jump))
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func nodeName(block *Block) string {
+	return fmt.Sprintf("block_%x", block.Start)
+}
@@ -0,0 +1,116 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/thu-arxan/evm/abi"
+)
+
+func abiCmd(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: evm abi <encode | decode> [flags] [args]")
+		return errUsage
+	}
+	switch args[0] {
+	case "encode":
+		return abiEncodeCmd(args[1:], stdout, stderr)
+	case "decode":
+		return abiDecodeCmd(args[1:], stdout, stderr)
+	default:
+		return fmt.Errorf("unknown abi command %s", args[0])
+	}
+}
+
+func abiEncodeCmd(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("abi encode", stderr,
+		"usage: evm abi encode -abi <file> <method> [args...]",
+		"the method is empty string for constructor")
+	abiFile := flags.String("abi", "", "the abi json file")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *abiFile == "" || flags.NArg() < 1 {
+		flags.Usage()
+		return errUsage
+	}
+	data, err := abi.Pack(*abiFile, flags.Arg(0), flags.Args()[1:]...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "0x%x\n", data)
+	return nil
+}
+
+func abiDecodeCmd(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("abi decode", stderr,
+		"usage: evm abi decode -abi <file> <method> <hex>",
+		"       evm abi decode -abi <file> -input <hex>")
+	abiFile := flags.String("abi", "", "the abi json file")
+	input := flags.Bool("input", false, "decode calldata, and the method is found by selector")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *abiFile == "" || (*input && flags.NArg() != 1) || (!*input && flags.NArg() != 2) {
+		flags.Usage()
+		return errUsage
+	}
+	data, err := readHex(flags.Arg(flags.NArg() - 1))
+	if err != nil {
+		return err
+	}
+	var result interface{}
+	if *input {
+		contract, err := abi.New(*abiFile)
+		if err != nil {
+			return err
+		}
+		method, err := contract.MethodByID(data)
+		if err != nil {
+			return err
+		}
+		values, err := method.Inputs.UnpackValues(data[4:])
+		if err != nil {
+			return err
+		}
+		var args = make([]string, len(values))
+		for i := range values {
+			if address, ok := values[i].([]byte); ok && method.Inputs[i].Type.T == abi.AddressTy {
+				args[i] = fmt.Sprintf("%x", address)
+			} else {
+				args[i] = fmt.Sprintf("%v", values[i])
+			}
+		}
+		result = map[string]interface{}{
+			"method": method.Sig(),
+			"args":   args,
+		}
+	} else {
+		values, err := abi.Unpack(*abiFile, flags.Arg(0), data)
+		if err != nil {
+			return err
+		}
+		result = values
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
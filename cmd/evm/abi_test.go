@@ -0,0 +1,58 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const balanceABI = "../../tests/sols/Balance_sol_Balance.abi"
+
+func TestAbiCmd(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, abiCmd([]string{"encode", "-abi", balanceABI, "add", "5"}, &stdout, &stderr))
+	require.Equal(t, fmt.Sprintf("0x1003e2d2%064x\n", 5), stdout.String())
+
+	// decode calldata
+	stdout.Reset()
+	require.NoError(t, abiCmd([]string{"decode", "-abi", balanceABI, "-input", fmt.Sprintf("0x1003e2d2%064x", 5)}, &stdout, &stderr))
+	var call struct {
+		Method string   `json:"method"`
+		Args   []string `json:"args"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &call))
+	require.Equal(t, "add(uint256)", call.Method)
+	require.Equal(t, []string{"5"}, call.Args)
+
+	// decode return data
+	stdout.Reset()
+	require.NoError(t, abiCmd([]string{"decode", "-abi", balanceABI, "get", fmt.Sprintf("0x%064x", 15)}, &stdout, &stderr))
+	var values []string
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &values))
+	require.Equal(t, []string{"15"}, values)
+
+	require.Equal(t, errUsage, abiCmd(nil, &stdout, &stderr))
+	require.Equal(t, errUsage, abiCmd([]string{"encode", "add"}, &stdout, &stderr))
+	require.Equal(t, errUsage, abiCmd([]string{"decode", "-abi", balanceABI, "get"}, &stdout, &stderr))
+	require.Error(t, abiCmd([]string{"unknown"}, &stdout, &stderr))
+	require.Error(t, abiCmd([]string{"encode", "-abi", balanceABI, "unknown"}, &stdout, &stderr))
+}
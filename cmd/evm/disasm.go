@@ -0,0 +1,49 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/thu-arxan/evm/asm"
+)
+
+func disasmCmd(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("disasm", stderr, "usage: evm disasm [flags] <hex | file>")
+	jsonOutput := flags.Bool("json", false, "print instructions as json")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	code, err := readHex(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	program := asm.Disassemble(code)
+	if *jsonOutput {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(program)
+	}
+	_, err = program.WriteTo(stdout)
+	return err
+}
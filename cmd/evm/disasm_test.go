@@ -0,0 +1,53 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisasmCmd(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, disasmCmd([]string{"0x6001600055fe"}, &stdout, &stderr))
+	require.Equal(t, "0x0000  PUSH1 0x01\n0x0002  PUSH1 0x00\n0x0004  SSTORE\n0x0005  INVALID\n", stdout.String())
+
+	stdout.Reset()
+	require.NoError(t, disasmCmd([]string{"-json", "0x600155"}, &stdout, &stderr))
+	var program struct {
+		Instructions []struct {
+			PC     uint64 `json:"pc"`
+			Op     string `json:"op"`
+			Opcode byte   `json:"opcode"`
+			Data   string `json:"data"`
+		} `json:"instructions"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &program))
+	require.Len(t, program.Instructions, 2)
+	require.Equal(t, "PUSH1", program.Instructions[0].Op)
+	require.EqualValues(t, 0x60, program.Instructions[0].Opcode)
+	require.Equal(t, "0x01", program.Instructions[0].Data)
+	require.EqualValues(t, 2, program.Instructions[1].PC)
+	require.Equal(t, "SSTORE", program.Instructions[1].Op)
+
+	require.Equal(t, errUsage, disasmCmd(nil, &stdout, &stderr))
+	require.Equal(t, errUsage, disasmCmd([]string{"0x00", "0x00"}, &stdout, &stderr))
+	require.Error(t, disasmCmd([]string{"0xzz"}, &stdout, &stderr))
+}
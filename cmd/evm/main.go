@@ -0,0 +1,125 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+// evm is a command line tool to run, trace and disassemble bytecode
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/thu-arxan/evm/util"
+)
+
+const usage = `usage: evm <command> [flags] [args]
+
+commands:
+  run          run code or a contract on a json prestate
+  trace        run like run and print the trace of every opcode
+  disasm       disassemble bytecode
+  abi encode   encode calldata by abi
+  abi decode   decode return data or calldata by abi
+  t8n          apply transactions on alloc in the format of geth evm t8n
+  statetest    run the json fixtures of GeneralStateTests and VMTests
+
+run "evm <command> -h" for the flags of a command
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = runCmd(os.Args[2:], false, os.Stdout, os.Stderr)
+	case "trace":
+		err = runCmd(os.Args[2:], true, os.Stdout, os.Stderr)
+	case "disasm":
+		err = disasmCmd(os.Args[2:], os.Stdout, os.Stderr)
+	case "abi":
+		err = abiCmd(os.Args[2:], os.Stdout, os.Stderr)
+	case "t8n":
+		err = t8nCmd(os.Args[2:], os.Stdin, os.Stdout, os.Stderr)
+	case "statetest":
+		err = statetestCmd(os.Args[2:], os.Stdout, os.Stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	switch {
+	case err == flag.ErrHelp:
+	case err == errUsage:
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "evm:", err)
+		os.Exit(1)
+	}
+}
+
+// errUsage is returned by a command if its flags or arguments are invalid,
+// and the usage has been printed
+var errUsage = errors.New("invalid usage")
+
+// newFlagSet return a flag set which prints usage and errors to stderr
+func newFlagSet(name string, stderr io.Writer, usage ...string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		for _, line := range usage {
+			fmt.Fprintln(stderr, line)
+		}
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parse args, and return errUsage if they are invalid, or
+// flag.ErrHelp if the help is asked
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// readHex read hex from a file if arg is an existing file, or decode arg as hex
+func readHex(arg string) ([]byte, error) {
+	if _, err := os.Stat(arg); err == nil {
+		data, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		arg = string(data)
+	}
+	bytes, err := util.HexToBytes(strings.TrimSpace(arg))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %v", err)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,62 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHex(t *testing.T) {
+	data, err := readHex("0x6001")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x60, 0x01}, data)
+
+	// the file is trimmed, such as the .bin of solc
+	path := filepath.Join(t.TempDir(), "code.bin")
+	require.NoError(t, os.WriteFile(path, []byte("6002\n"), 0644))
+	data, err = readHex(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x60, 0x02}, data)
+
+	_, err = readHex("0xzz")
+	require.Error(t, err)
+}
+
+func TestParseFlags(t *testing.T) {
+	var stderr bytes.Buffer
+	flags := newFlagSet("test", &stderr, "usage: evm test [flags]")
+	gas := flags.Uint64("gas", 1, "the gas")
+	require.NoError(t, parseFlags(flags, []string{"-gas", "10", "arg"}))
+	require.EqualValues(t, 10, *gas)
+	require.Equal(t, []string{"arg"}, flags.Args())
+
+	for _, args := range [][]string{{"-gas", "abc"}, {"-unknown"}} {
+		stderr.Reset()
+		flags := newFlagSet("test", &stderr, "usage: evm test [flags]")
+		flags.Uint64("gas", 1, "the gas")
+		require.Equal(t, errUsage, parseFlags(flags, args), args)
+		require.Contains(t, stderr.String(), "usage: evm test [flags]")
+	}
+	flags = newFlagSet("test", &stderr)
+	require.Equal(t, flag.ErrHelp, parseFlags(flags, []string{"-h"}))
+}
@@ -0,0 +1,231 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/state"
+	"github.com/thu-arxan/evm/tracer"
+	"github.com/thu-arxan/evm/util"
+)
+
+type jsonLog struct {
+	Address string   `json:"address"`
+	Topics  []string `json:"topics"`
+	Data    string   `json:"data"`
+}
+
+type runResult struct {
+	Output  string      `json:"output"`
+	GasUsed string      `json:"gasUsed"`
+	Refund  string      `json:"refund"`
+	Address string      `json:"address,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Logs    []*jsonLog  `json:"logs"`
+	Post    state.Alloc `json:"post"`
+}
+
+func runCmd(args []string, trace bool, stdout, stderr io.Writer) error {
+	var name = "run"
+	if trace {
+		name = "trace"
+	}
+	flags := newFlagSet(name, stderr, fmt.Sprintf("usage: evm %s [flags]", name))
+	var (
+		code       = flags.String("code", "", "the code in hex or a file contains hex such as .bin, default is the code of receiver")
+		input      = flags.String("input", "", "the input in hex or a file contains hex")
+		create     = flags.Bool("create", false, "run code as init code and create a contract")
+		gas        = flags.Uint64("gas", 10000000, "the gas limit of execution")
+		value      = flags.Uint64("value", 0, "the value transferred to receiver")
+		sender     = flags.String("sender", "0x73656e646572", "the address of sender")
+		receiver   = flags.String("receiver", "0x7265636569766572", "the address of receiver")
+		prestate   = flags.String("prestate", "", "the json file of prestate in the format of genesis alloc")
+		number     = flags.Uint64("number", 0, "the block number")
+		timestamp  = flags.Int64("timestamp", 0, "the block timestamp")
+		coinbase   = flags.String("coinbase", "", "the address of coinbase")
+		gasLimit   = flags.Uint64("gaslimit", 0, "the block gas limit")
+		difficulty = flags.Uint64("difficulty", 0, "the block difficulty")
+		gasPrice   = flags.Uint64("gasprice", 0, "the gas price")
+	)
+	var (
+		memory    *bool
+		noStack   *bool
+		profile   *bool
+		reference *string
+	)
+	if trace {
+		memory = flags.Bool("memory", false, "print memory in trace")
+		noStack = flags.Bool("nostack", false, "do not print stack in trace")
+		profile = flags.Bool("profile", false, "print a gas profile instead of the trace of every opcode")
+		reference = flags.String("reference", "", "the json file of a geth trace, and print the first step differs from it instead of the trace")
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	if *prestate != "" {
+		alloc, err := state.ReadAlloc(*prestate)
+		if err != nil {
+			return err
+		}
+		if err := alloc.Write(bc, memoryDB.NewWriteBatch()); err != nil {
+			return err
+		}
+	}
+	var ctx = &evm.Context{
+		Value:       *value,
+		BlockHeight: *number,
+		BlockTime:   *timestamp,
+		Difficulty:  *difficulty,
+		GasLimit:    *gasLimit,
+		GasPrice:    *gasPrice,
+	}
+	var gasLeft = *gas
+	ctx.Gas = &gasLeft
+	if *coinbase != "" {
+		ctx.CoinBase = example.HexToAddress(*coinbase).Bytes()
+	}
+	var codeBytes []byte
+	var err error
+	if *code != "" {
+		if codeBytes, err = readHex(*code); err != nil {
+			return err
+		}
+	}
+	if *input != "" {
+		if ctx.Input, err = readHex(*input); err != nil {
+			return err
+		}
+	}
+
+	var want []*tracer.StructLog
+	if trace && *reference != "" {
+		if *profile {
+			return fmt.Errorf("-profile could not be used with -reference")
+		}
+		if want, err = readStructLogs(*reference); err != nil {
+			return err
+		}
+	}
+
+	var structLogger *tracer.StructLogger
+	var profiler *tracer.Profiler
+	vm := evm.New(bc, memoryDB, ctx)
+	if trace && *profile {
+		profiler = tracer.NewProfiler()
+		vm.SetTracer(profiler)
+	} else if trace {
+		structLogger = tracer.NewStructLogger(&tracer.StructLoggerConfig{
+			EnableMemory: *memory,
+			DisableStack: *noStack,
+		})
+		vm.SetTracer(structLogger)
+	}
+
+	var result = &runResult{}
+	var output []byte
+	var caller = example.HexToAddress(*sender)
+	if *create {
+		if codeBytes == nil {
+			return fmt.Errorf("-code is required by -create")
+		}
+		// the init code is followed by the input, which is the abi encoded arguments of constructor
+		ctx.Input = append(codeBytes, ctx.Input...)
+		var address evm.Address
+		output, address, err = vm.Create(caller)
+		if address != nil {
+			result.Address = fmt.Sprintf("0x%x", address.Bytes())
+		}
+	} else {
+		var callee = example.HexToAddress(*receiver)
+		if codeBytes == nil {
+			codeBytes = memoryDB.GetAccount(callee).GetCode()
+		}
+		output, err = vm.Call(caller, callee, codeBytes)
+	}
+	result.Output = fmt.Sprintf("0x%x", output)
+	result.GasUsed = fmt.Sprintf("0x%x", *gas-gasLeft)
+	result.Refund = fmt.Sprintf("0x%x", vm.GetRefund())
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Logs = make([]*jsonLog, 0)
+	for _, log := range memoryDB.GetLog() {
+		var l = &jsonLog{
+			Address: fmt.Sprintf("0x%x", log.Address.Bytes()),
+			Topics:  make([]string, len(log.Topics)),
+			Data:    "0x" + util.Hex(log.Data),
+		}
+		for i := range log.Topics {
+			l.Topics[i] = fmt.Sprintf("0x%x", log.Topics[i].Bytes())
+		}
+		result.Logs = append(result.Logs, l)
+	}
+	result.Post = state.Dump(memoryDB)
+
+	if want != nil {
+		if d := tracer.Diff(structLogger.Logs(), want); d != nil {
+			fmt.Fprintln(stdout, d)
+			return fmt.Errorf("trace differs from %s", *reference)
+		}
+		fmt.Fprintf(stdout, "trace is the same as %s in %d steps\n", *reference, len(want))
+		return nil
+	}
+	if structLogger != nil {
+		if err := structLogger.WriteJSON(stdout); err != nil {
+			return err
+		}
+	}
+	if profiler != nil {
+		if err := profiler.WriteReport(stdout, 20); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout)
+	}
+	encoder := json.NewEncoder(stdout)
+	if !trace {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(result)
+}
+
+func readStructLogs(path string) ([]*tracer.StructLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	logs, err := tracer.ReadStructLogs(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trace %s: %v", path, err)
+	}
+	return logs, nil
+}
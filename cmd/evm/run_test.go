@@ -0,0 +1,138 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+package main
+
+import (
+	"github.com/thu-arxan/evm/asm"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const receiver = "0x0000000000000000000000000000007265636569766572"
+
+// writePrestate writes a prestate whose receiver stores 1 at slot 0, logs, and returns 42
+func writePrestate(t *testing.T) string {
+	code := asm.MustAssemble(`
+		PUSH1 1
+		PUSH1 0
+		SSTORE
+		PUSH1 0x2a
+		PUSH1 0
+		MSTORE
+		PUSH1 0
+		PUSH1 0
+		LOG0
+		PUSH1 32
+		PUSH1 0
+		RETURN
+	`)
+	path := filepath.Join(t.TempDir(), "prestate.json")
+	prestate := fmt.Sprintf(`{"%s": {"balance": "0x10", "code": "0x%x", "storage": {"0x01": "0x02"}}}`, receiver[len(receiver)-40:], code)
+	require.NoError(t, os.WriteFile(path, []byte(prestate), 0644))
+	return path
+}
+
+func TestRunCmd(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, runCmd([]string{"-prestate", writePrestate(t), "-gas", "100000"}, false, &stdout, &stderr))
+	var result runResult
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+	require.Equal(t, fmt.Sprintf("0x%064x", 0x2a), result.Output)
+	// 20000 for SSTORE, 375 for LOG0, 3 for memory and 3 for the other 9 opcodes
+	require.Equal(t, fmt.Sprintf("0x%x", 20000+375+3+3*9), result.GasUsed)
+	require.Equal(t, "0x0", result.Refund)
+	require.Empty(t, result.Error)
+	require.Len(t, result.Logs, 1)
+	require.Equal(t, "0x0000000000000000000000007265636569766572", result.Logs[0].Address)
+	require.Empty(t, result.Logs[0].Topics)
+	// the prestate is loaded and written
+	account := result.Post["0x0000000000000000000000007265636569766572"]
+	require.NotNil(t, account)
+	require.EqualValues(t, 0x10, account.Balance)
+	require.Len(t, account.Storage, 2)
+
+	// the code and input are read from hex or file
+	code := asm.MustAssemble(`
+		PUSH1 0
+		CALLDATALOAD
+		PUSH1 0
+		MSTORE
+		PUSH1 32
+		PUSH1 0
+		RETURN
+	`)
+	input := filepath.Join(t.TempDir(), "input")
+	require.NoError(t, os.WriteFile(input, []byte(fmt.Sprintf("0x%064x\n", 7)), 0644))
+	stdout.Reset()
+	require.NoError(t, runCmd([]string{"-code", fmt.Sprintf("0x%x", code), "-input", input}, false, &stdout, &stderr))
+	result = runResult{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+	require.Equal(t, fmt.Sprintf("0x%064x", 7), result.Output)
+
+	// the error of execution is in the result
+	stdout.Reset()
+	require.NoError(t, runCmd([]string{"-prestate", writePrestate(t), "-gas", "100"}, false, &stdout, &stderr))
+	result = runResult{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+	require.NotEmpty(t, result.Error)
+	require.Equal(t, "0x64", result.GasUsed)
+}
+
+func TestRunCmdFlags(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, errUsage, runCmd([]string{"-gas", "abc"}, false, &stdout, &stderr))
+	require.Equal(t, errUsage, runCmd([]string{"arg"}, false, &stdout, &stderr))
+	require.Contains(t, stderr.String(), "usage: evm run [flags]")
+	require.Equal(t, flag.ErrHelp, runCmd([]string{"-h"}, false, &stdout, &stderr))
+	// the flags of trace are not defined for run
+	require.Equal(t, errUsage, runCmd([]string{"-memory"}, false, &stdout, &stderr))
+
+	require.Error(t, runCmd([]string{"-create"}, false, &stdout, &stderr))
+	require.Error(t, runCmd([]string{"-code", "0xzz"}, false, &stdout, &stderr))
+	require.Error(t, runCmd([]string{"-prestate", filepath.Join(t.TempDir(), "absent.json")}, false, &stdout, &stderr))
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"0x01": {"balance": "abc"}}`), 0644))
+	require.Error(t, runCmd([]string{"-prestate", invalid}, false, &stdout, &stderr))
+	require.Empty(t, stdout.String())
+}
+
+func TestTraceCmd(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, runCmd([]string{"-prestate", writePrestate(t), "-nostack"}, true, &stdout, &stderr))
+	// a line per opcode, and the result at last
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 13)
+	var step map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &step))
+	require.Equal(t, "PUSH1", step["opName"])
+	require.EqualValues(t, 2, step["pc"])
+	// the stack is not printed by -nostack
+	require.Empty(t, step["stack"])
+	var result runResult
+	require.NoError(t, json.Unmarshal([]byte(lines[12]), &result))
+	require.Equal(t, fmt.Sprintf("0x%064x", 0x2a), result.Output)
+
+	require.Error(t, runCmd([]string{"-profile", "-reference", "trace.json"}, true, &stdout, &stderr))
+}
@@ -0,0 +1,81 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/thu-arxan/evm/statetest"
+)
+
+func statetestCmd(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("statetest", stderr, "usage: evm statetest [flags] <dir | file>...")
+	forks := flags.String("fork", "", "the forks to run separated by comma, default is all forks, and only Istanbul is supported")
+	skipFile := flags.String("skip", "", "the file of skip list, one regexp of test name per line")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+	var forkList []string
+	if *forks != "" {
+		forkList = strings.Split(*forks, ",")
+	}
+	var skip []string
+	if *skipFile != "" {
+		var err error
+		if skip, err = statetest.ReadSkipList(*skipFile); err != nil {
+			return err
+		}
+	}
+	runner, err := statetest.NewRunner(forkList, skip)
+	if err != nil {
+		return err
+	}
+	var results []*statetest.Result
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		var pathResults []*statetest.Result
+		if info.IsDir() {
+			pathResults, err = runner.RunDir(path)
+		} else {
+			pathResults, err = runner.RunFile(path)
+		}
+		if err != nil {
+			return err
+		}
+		results = append(results, pathResults...)
+	}
+	if err := statetest.WriteReport(stdout, results); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Status == statetest.Fail {
+			return fmt.Errorf("some tests failed")
+		}
+	}
+	return nil
+}
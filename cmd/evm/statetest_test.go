@@ -0,0 +1,40 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatetestCmd(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, statetestCmd([]string{"-fork", "Istanbul", "../../statetest/testdata"}, &stdout, &stderr))
+	require.Contains(t, stdout.String(), "Istanbul  3     0     1")
+	require.NotContains(t, stdout.String(), "Berlin")
+
+	// the skipped tests are not failed
+	stdout.Reset()
+	require.NoError(t, statetestCmd([]string{"../../statetest/testdata/GeneralStateTests/sstore.json"}, &stdout, &stderr))
+	require.Contains(t, stdout.String(), "Berlin    0     0     1")
+
+	require.Equal(t, errUsage, statetestCmd(nil, &stdout, &stderr))
+	require.Error(t, statetestCmd([]string{"absent"}, &stdout, &stderr))
+	require.Error(t, statetestCmd([]string{"-skip", "absent.txt", "../../statetest/testdata"}, &stdout, &stderr))
+}
@@ -0,0 +1,105 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/thu-arxan/evm/state"
+	"github.com/thu-arxan/evm/t8n"
+)
+
+func t8nCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := newFlagSet("t8n", stderr, "usage: evm t8n [flags]")
+	var (
+		allocPath    = flags.String("input.alloc", "alloc.json", "the prestate alloc, stdin means reading {alloc, env, txs} from stdin")
+		envPath      = flags.String("input.env", "env.json", "the block env, or stdin")
+		txsPath      = flags.String("input.txs", "txs.json", "the transactions, or stdin")
+		baseDir      = flags.String("output.basedir", "", "the directory of output files")
+		resultPath   = flags.String("output.result", "result.json", "the result file, stdout means printing")
+		outAllocPath = flags.String("output.alloc", "alloc.json", "the post alloc file, stdout means printing")
+		chainID      = flags.Uint64("state.chainid", 1, "the chain id used to sign transactions with secretKey")
+		reward       = flags.Int64("state.reward", 0, "the block reward of coinbase, and -1 disables it")
+		fork         = flags.String("state.fork", "", "the fork of rules, only Istanbul is supported because the gas rules of evm are Istanbul")
+	)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	var input struct {
+		Alloc state.Alloc        `json:"alloc"`
+		Env   *t8n.Env           `json:"env"`
+		Txs   []*t8n.Transaction `json:"txs"`
+	}
+	if *allocPath == "stdin" || *envPath == "stdin" || *txsPath == "stdin" {
+		if err := json.NewDecoder(stdin).Decode(&input); err != nil {
+			return fmt.Errorf("stdin: %v", err)
+		}
+	}
+	for _, v := range []struct {
+		path string
+		dst  interface{}
+	}{{*allocPath, &input.Alloc}, {*envPath, &input.Env}, {*txsPath, &input.Txs}} {
+		if v.path == "stdin" {
+			continue
+		}
+		data, err := ioutil.ReadFile(v.path)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, v.dst); err != nil {
+			return fmt.Errorf("%s: %v", v.path, err)
+		}
+	}
+	if input.Env == nil {
+		return fmt.Errorf("env is required")
+	}
+
+	result, alloc, err := t8n.Transition(&t8n.Config{ChainID: *chainID, Reward: *reward, Fork: *fork}, input.Alloc, input.Env, input.Txs)
+	if err != nil {
+		return err
+	}
+	var printed = make(map[string]interface{})
+	for _, v := range []struct {
+		name  string
+		path  string
+		value interface{}
+	}{{"result", *resultPath, result}, {"alloc", *outAllocPath, alloc}} {
+		if v.path == "stdout" {
+			printed[v.name] = v.value
+			continue
+		}
+		data, err := json.MarshalIndent(v.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(*baseDir, v.path), data, 0644); err != nil {
+			return err
+		}
+	}
+	if len(printed) > 0 {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(printed)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const t8nInput = `{
+	"alloc": {"0x00000000000000000000000000000000000000aa": {"balance": "0x10"}},
+	"env": {"currentCoinbase": "0x00000000000000000000000000000000000000cc", "currentGasLimit": "0x100000",
+		"currentNumber": "1", "currentTimestamp": "1000"},
+	"txs": []
+}`
+
+func TestT8nCmd(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-input.alloc", "stdin", "-input.env", "stdin", "-input.txs", "stdin", "-output.result", "stdout", "-output.alloc", "stdout", "-state.reward", "-1"}
+	require.NoError(t, t8nCmd(args, strings.NewReader(t8nInput), &stdout, &stderr))
+	var output struct {
+		Result map[string]interface{} `json:"result"`
+		Alloc  map[string]interface{} `json:"alloc"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Contains(t, output.Result, "stateRoot")
+	require.Len(t, output.Alloc, 1)
+	require.Contains(t, output.Alloc, "0x00000000000000000000000000000000000000aa")
+
+	// the result and alloc are written into files
+	dir := t.TempDir()
+	stdout.Reset()
+	args = []string{"-input.alloc", "stdin", "-input.env", "stdin", "-input.txs", "stdin", "-output.basedir", dir}
+	require.NoError(t, t8nCmd(args, strings.NewReader(t8nInput), &stdout, &stderr))
+	require.Empty(t, stdout.String())
+	for _, name := range []string{"result.json", "alloc.json"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, errUsage, t8nCmd([]string{"-state.reward", "abc"}, nil, &stdout, &stderr))
+	require.Error(t, t8nCmd([]string{"-input.alloc", filepath.Join(dir, "absent.json")}, nil, &stdout, &stderr))
+	// the env is required
+	require.Error(t, t8nCmd([]string{"-input.alloc", "stdin", "-input.env", "stdin", "-input.txs", "stdin"}, strings.NewReader(`{"alloc": {}}`), &stdout, &stderr))
+	// only the gas rules of Istanbul are implemented
+	args = []string{"-input.alloc", "stdin", "-input.env", "stdin", "-input.txs", "stdin", "-output.result", "stdout", "-state.fork", "Berlin"}
+	require.Error(t, t8nCmd(args, strings.NewReader(t8nInput), &stdout, &stderr))
+}
@@ -0,0 +1,140 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package coverage
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/crypto"
+)
+
+// Branch is the outcome count of a JUMPI
+type Branch struct {
+	Taken    uint64
+	NotTaken uint64
+}
+
+// Code is the coverage of a bytecode
+type Code struct {
+	Code []byte
+	// Hits is the executed count of every pc
+	Hits map[uint64]uint64
+	// Branches is the outcome count of every executed JUMPI
+	Branches map[uint64]*Branch
+}
+
+func newCode(code []byte) *Code {
+	return &Code{
+		Code:     code,
+		Hits:     make(map[uint64]uint64),
+		Branches: make(map[uint64]*Branch),
+	}
+}
+
+func (c *Code) branch(pc uint64) *Branch {
+	branch, ok := c.Branches[pc]
+	if !ok {
+		branch = &Branch{}
+		c.Branches[pc] = branch
+	}
+	return branch
+}
+
+// Collector is a tracer which records executed pcs and JUMPI outcomes per code
+// hash, and it could be set to many evm runs one by one to collect the coverage
+// of a test suite.
+// Note: Collector is not thread safety, please use a collector per goroutine
+// and Merge them if runs are concurrent.
+type Collector struct {
+	codes  map[string]*Code
+	frames []*Code
+	// taken is the outcome of the running JUMPI
+	taken bool
+}
+
+// NewCollector is the constructor of Collector
+func NewCollector() *Collector {
+	return &Collector{
+		codes: make(map[string]*Code),
+	}
+}
+
+// Code return the coverage of code, and nil if the code never runs
+func (c *Collector) Code(code []byte) *Code {
+	return c.codes[string(crypto.Keccak256(code))]
+}
+
+// Merge merges the coverage of other into c
+func (c *Collector) Merge(other *Collector) {
+	for hash, code := range other.codes {
+		cov, ok := c.codes[hash]
+		if !ok {
+			cov = newCode(code.Code)
+			c.codes[hash] = cov
+		}
+		for pc, hits := range code.Hits {
+			cov.Hits[pc] += hits
+		}
+		for pc, branch := range code.Branches {
+			b := cov.branch(pc)
+			b.Taken += branch.Taken
+			b.NotTaken += branch.NotTaken
+		}
+	}
+}
+
+// CaptureEnter is the implementation of evm.Tracer
+func (c *Collector) CaptureEnter(frame *evm.Frame) {
+	hash := string(crypto.Keccak256(frame.Code))
+	code, ok := c.codes[hash]
+	if !ok {
+		code = newCode(frame.Code)
+		c.codes[hash] = code
+	}
+	c.frames = append(c.frames, code)
+}
+
+// CaptureState is the implementation of evm.Tracer
+func (c *Collector) CaptureState(step *evm.Step) {
+	if step.Op == evm.JUMPI {
+		cond := step.Stack.Back(1)
+		c.taken = cond != nil && cond.Sign() != 0
+	}
+}
+
+// CaptureStateEnd is the implementation of evm.Tracer
+func (c *Collector) CaptureStateEnd(step *evm.Step) {
+	if len(c.frames) == 0 {
+		return
+	}
+	code := c.frames[len(c.frames)-1]
+	code.Hits[step.PC]++
+	if step.Op == evm.JUMPI && step.Err == nil {
+		if c.taken {
+			code.branch(step.PC).Taken++
+		} else {
+			code.branch(step.PC).NotTaken++
+		}
+	}
+}
+
+// CaptureExit is the implementation of evm.Tracer
+func (c *Collector) CaptureExit(frame *evm.Frame, output []byte, gasUsed uint64, err error) {
+	if len(c.frames) > 0 {
+		c.frames = c.frames[:len(c.frames)-1]
+	}
+}
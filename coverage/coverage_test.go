@@ -0,0 +1,98 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package coverage
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/srcmap"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+var source = `contract B {
+    function f(bool x) public {
+        if (x) {
+            return;
+        }
+    }
+}
+`
+
+// PUSH1 0 CALLDATALOAD PUSH1 7 JUMPI STOP JUMPDEST STOP
+var code = util.Hex2Bytes("600035600757005b00")
+
+func TestCollector(t *testing.T) {
+	collector := run(t, 0, 1, 1)
+	cov := collector.Code(code)
+	require.NotNil(t, cov)
+	require.EqualValues(t, 3, cov.Hits[5])
+	require.EqualValues(t, 1, cov.Hits[6])
+	require.EqualValues(t, 2, cov.Hits[8])
+	require.Equal(t, &Branch{Taken: 2, NotTaken: 1}, cov.Branches[5])
+	require.Nil(t, collector.Code([]byte{0x00}))
+
+	other := run(t, 1)
+	other.Merge(collector)
+	require.Equal(t, &Branch{Taken: 3, NotTaken: 1}, other.Code(code).Branches[5])
+	require.EqualValues(t, 3, other.Code(code).Hits[8])
+}
+
+func TestLCOV(t *testing.T) {
+	var cond = strings.Index(source, "x) {")
+	var ret = strings.Index(source, "return;")
+	var end = strings.Index(source, "}\n    }")
+	// the instructions of condition, the STOP of the end and the instructions of return
+	var srcmapRuntime = fmt.Sprintf("%d:1:0;;;;%d:1:0;%d:7:0;", cond, end, ret)
+	mapper, err := srcmap.NewMapper(code, srcmapRuntime, []*srcmap.Source{srcmap.NewSource("B.sol", source)})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	collector := run(t, 0, 1, 1)
+	require.NoError(t, collector.WriteLCOV(&buf, []*Contract{{Code: code, Mapper: mapper}}))
+	require.Equal(t, "TN:\nSF:B.sol\nBRDA:3,0,0,2\nBRDA:3,0,1,1\nBRF:2\nBRH:2\nDA:3,3\nDA:4,2\nDA:5,1\nLF:3\nLH:3\nend_of_record\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, NewCollector().WriteLCOV(&buf, []*Contract{{Code: code, Mapper: mapper}}))
+	require.Equal(t, "TN:\nSF:B.sol\nBRDA:3,0,0,-\nBRDA:3,0,1,-\nBRF:2\nBRH:0\nDA:3,0\nDA:4,0\nDA:5,0\nLF:3\nLH:0\nend_of_record\n", buf.String())
+}
+
+func run(t *testing.T, inputs ...uint64) *Collector {
+	collector := NewCollector()
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	for _, input := range inputs {
+		var gas uint64 = 100000
+		vm := evm.New(bc, memoryDB, &evm.Context{
+			Input: core.Uint64ToWord256(input).Bytes(),
+			Gas:   &gas,
+		})
+		vm.SetTracer(collector)
+		_, err := vm.Call(example.RandomAddress(), example.RandomAddress(), code)
+		require.NoError(t, err)
+	}
+	return collector
+}
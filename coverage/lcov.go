@@ -0,0 +1,142 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/srcmap"
+)
+
+// Contract is a contract whose coverage will be reported
+type Contract struct {
+	// Code is the bytecode which runs, normally it is the deployed bytecode
+	Code   []byte
+	Mapper *srcmap.Mapper
+}
+
+type branchRecord struct {
+	line     int
+	executed bool
+	taken    uint64
+	notTaken uint64
+}
+
+type fileCoverage struct {
+	lines    map[int]uint64
+	branches []*branchRecord
+}
+
+// WriteLCOV writes the line and branch coverage of contracts in LCOV format.
+// An instruction counts for a line only if its source range is in the line, and
+// the hit count of a line is the max hit count of its instructions. Every JUMPI
+// mapped to source is reported as a branch block of two branches, the first one
+// is taken and the second one is not taken.
+func (c *Collector) WriteLCOV(w io.Writer, contracts []*Contract) error {
+	var files = make(map[string]*fileCoverage)
+	for _, contract := range contracts {
+		var cov = c.Code(contract.Code)
+		if cov == nil {
+			cov = newCode(contract.Code)
+		}
+		var lines = make(map[string]map[int]uint64)
+		for pc := range contract.Code {
+			location := contract.Mapper.Locate(uint64(pc))
+			if location == nil {
+				continue
+			}
+			file, ok := files[location.File]
+			if !ok {
+				file = &fileCoverage{lines: make(map[int]uint64)}
+				files[location.File] = file
+			}
+			hits := cov.Hits[uint64(pc)]
+			if location.Line == location.EndLine {
+				if lines[location.File] == nil {
+					lines[location.File] = make(map[int]uint64)
+				}
+				if hits >= lines[location.File][location.Line] {
+					lines[location.File][location.Line] = hits
+				}
+			}
+			if evm.OpCode(contract.Code[pc]) == evm.JUMPI {
+				record := &branchRecord{
+					line:     location.Line,
+					executed: hits > 0,
+				}
+				if branch, ok := cov.Branches[uint64(pc)]; ok {
+					record.taken, record.notTaken = branch.Taken, branch.NotTaken
+				}
+				file.branches = append(file.branches, record)
+			}
+		}
+		for name, hits := range lines {
+			for line, hit := range hits {
+				files[name].lines[line] += hit
+			}
+		}
+	}
+
+	var names = make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		writeFile(bw, name, files[name])
+	}
+	return bw.Flush()
+}
+
+func writeFile(w io.Writer, name string, file *fileCoverage) {
+	fmt.Fprintf(w, "TN:\nSF:%s\n", name)
+	var branchesHit int
+	for block, branch := range file.branches {
+		if !branch.executed {
+			fmt.Fprintf(w, "BRDA:%d,%d,0,-\nBRDA:%d,%d,1,-\n", branch.line, block, branch.line, block)
+			continue
+		}
+		fmt.Fprintf(w, "BRDA:%d,%d,0,%d\nBRDA:%d,%d,1,%d\n", branch.line, block, branch.taken, branch.line, block, branch.notTaken)
+		if branch.taken > 0 {
+			branchesHit++
+		}
+		if branch.notTaken > 0 {
+			branchesHit++
+		}
+	}
+	fmt.Fprintf(w, "BRF:%d\nBRH:%d\n", 2*len(file.branches), branchesHit)
+
+	var lines = make([]int, 0, len(file.lines))
+	for line := range file.lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	var linesHit int
+	for _, line := range lines {
+		fmt.Fprintf(w, "DA:%d,%d\n", line, file.lines[line])
+		if file.lines[line] > 0 {
+			linesHit++
+		}
+	}
+	fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(lines), linesHit)
+}
@@ -17,8 +17,13 @@
 package crypto
 
 import (
-	"github.com/thu-arxan/evm/util/math"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
 	"math/big"
+
+	"github.com/thu-arxan/evm/util"
+	"github.com/thu-arxan/evm/util/math"
 )
 
 // DigestLength sets the signature digest exact length
@@ -49,3 +54,31 @@ func zeroBytes(bytes []byte) {
 		bytes[i] = 0
 	}
 }
+
+// ToECDSA creates a private key of secp256k1 with the given D value
+func ToECDSA(d []byte) (*ecdsa.PrivateKey, error) {
+	priv := new(ecdsa.PrivateKey)
+	priv.PublicKey.Curve = S256()
+	if 8*len(d) != priv.Params().BitSize {
+		return nil, fmt.Errorf("invalid length, need %d bits", priv.Params().BitSize)
+	}
+	priv.D = new(big.Int).SetBytes(d)
+	if priv.D.Cmp(secp256k1N) >= 0 || priv.D.Sign() <= 0 {
+		return nil, errors.New("invalid private key")
+	}
+	priv.PublicKey.X, priv.PublicKey.Y = priv.PublicKey.Curve.ScalarBaseMult(d)
+	return priv, nil
+}
+
+// FromECDSAPub return the uncompressed public key, which is 0x04 || X || Y
+func FromECDSAPub(pub *ecdsa.PublicKey) []byte {
+	if pub == nil || pub.X == nil || pub.Y == nil {
+		return nil
+	}
+	return util.BytesCombine([]byte{4}, util.LeftPadBytes(pub.X.Bytes(), 32), util.LeftPadBytes(pub.Y.Bytes(), 32))
+}
+
+// PubkeyToAddress return the 20 bytes address of public key
+func PubkeyToAddress(pub *ecdsa.PublicKey) []byte {
+	return Keccak256(FromECDSAPub(pub)[1:])[12:]
+}
@@ -0,0 +1,240 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Package sm2 implements the signature of SM2 defined in GM/T 0003-2012 on
+// the recommended curve sm2p256v1, and the public key recovery from signature.
+package sm2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/thu-arxan/evm/crypto/sm3"
+)
+
+// DefaultID is the default user id used to compute ZA
+var DefaultID = []byte("1234567812345678")
+
+var (
+	errInvalidSignature = errors.New("invalid sm2 signature")
+	errInvalidPublicKey = errors.New("invalid sm2 public key")
+
+	one = big.NewInt(1)
+	two = big.NewInt(2)
+)
+
+var p256 *elliptic.CurveParams
+
+func init() {
+	p256 = &elliptic.CurveParams{Name: "sm2p256v1", BitSize: 256}
+	p256.P, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF00000000FFFFFFFFFFFFFFFF", 16)
+	p256.N, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFF7203DF6B21C6052B53BBF40939D54123", 16)
+	p256.B, _ = new(big.Int).SetString("28E9FA9E9D9F5E344D5A9E4BCF6509A7F39789F515AB8F92DDBCBD414D940E93", 16)
+	p256.Gx, _ = new(big.Int).SetString("32C4AE2C1F1981195F9904466A39C9948FE30BBFF2660BE1715A4589334C74C7", 16)
+	p256.Gy, _ = new(big.Int).SetString("BC3736A2F4F6779C59BDCEE36B692153D0A9877CC62A474002DF32E52139F0A0", 16)
+}
+
+// P256 return the recommended curve sm2p256v1, whose a is p-3
+func P256() elliptic.Curve {
+	return p256
+}
+
+// GenerateKey generate a private key whose d is in [1, n-2]
+func GenerateKey(rand io.Reader) (*ecdsa.PrivateKey, error) {
+	d, err := randInt(rand, new(big.Int).Sub(p256.N, two))
+	if err != nil {
+		return nil, err
+	}
+	return NewPrivateKey(d), nil
+}
+
+// NewPrivateKey return the private key of d
+func NewPrivateKey(d *big.Int) *ecdsa.PrivateKey {
+	priv := &ecdsa.PrivateKey{D: new(big.Int).Set(d)}
+	priv.Curve = p256
+	priv.X, priv.Y = p256.ScalarBaseMult(d.Bytes())
+	return priv
+}
+
+// ZA return the hash of user id, curve and public key, which is hashed
+// before the message to compute the digest
+func ZA(pub *ecdsa.PublicKey, id []byte) ([]byte, error) {
+	if len(id) >= 1<<13 {
+		return nil, errors.New("sm2 user id is too long")
+	}
+	h := sm3.New()
+	bits := len(id) * 8
+	h.Write([]byte{byte(bits >> 8), byte(bits)})
+	h.Write(id)
+	a := new(big.Int).Sub(p256.P, big.NewInt(3))
+	for _, value := range []*big.Int{a, p256.B, p256.Gx, p256.Gy, pub.X, pub.Y} {
+		h.Write(padded(value))
+	}
+	return h.Sum(nil), nil
+}
+
+// Digest return SM3(ZA || msg), which is the input of Sign and Verify
+func Digest(pub *ecdsa.PublicKey, id, msg []byte) ([]byte, error) {
+	za, err := ZA(pub, id)
+	if err != nil {
+		return nil, err
+	}
+	h := sm3.New()
+	h.Write(za)
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Sign sign digest, and v is the recovery id which could be used by Recover
+func Sign(rand io.Reader, priv *ecdsa.PrivateKey, digest []byte) (r, s *big.Int, v byte, err error) {
+	for {
+		k, err := randInt(rand, new(big.Int).Sub(p256.N, one))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if r, s, v, ok := signWithK(priv, digest, k); ok {
+			return r, s, v, nil
+		}
+	}
+}
+
+// signWithK return false if k could not be used
+func signWithK(priv *ecdsa.PrivateKey, digest []byte, k *big.Int) (r, s *big.Int, v byte, ok bool) {
+	n := p256.N
+	e := new(big.Int).SetBytes(digest)
+	x1, y1 := p256.ScalarBaseMult(k.Bytes())
+	r = new(big.Int).Add(e, x1)
+	r.Mod(r, n)
+	if r.Sign() == 0 || new(big.Int).Add(r, k).Cmp(n) == 0 {
+		return nil, nil, 0, false
+	}
+	// s = (1 + d)^-1 * (k - r * d) mod n
+	s = new(big.Int).Mul(r, priv.D)
+	s.Sub(k, s)
+	dInv := new(big.Int).Add(priv.D, one)
+	dInv.ModInverse(dInv, n)
+	s.Mul(s, dInv)
+	s.Mod(s, n)
+	if s.Sign() == 0 {
+		return nil, nil, 0, false
+	}
+	v = byte(y1.Bit(0))
+	if x1.Cmp(n) >= 0 {
+		v |= 2
+	}
+	return r, s, v, true
+}
+
+// Verify return if r and s is a valid signature of digest by pub
+func Verify(pub *ecdsa.PublicKey, digest []byte, r, s *big.Int) bool {
+	n := p256.N
+	if pub == nil || pub.X == nil || pub.Y == nil || !p256.IsOnCurve(pub.X, pub.Y) {
+		return false
+	}
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return false
+	}
+	t := new(big.Int).Add(r, s)
+	t.Mod(t, n)
+	if t.Sign() == 0 {
+		return false
+	}
+	x1, y1 := p256.ScalarBaseMult(s.Bytes())
+	x2, y2 := p256.ScalarMult(pub.X, pub.Y, t.Bytes())
+	x, _ := p256.Add(x1, y1, x2, y2)
+	e := new(big.Int).SetBytes(digest)
+	x.Add(x, e)
+	x.Mod(x, n)
+	return x.Cmp(r) == 0
+}
+
+// Recover return the public key which signs digest, v is the recovery id returned by Sign
+func Recover(digest []byte, r, s *big.Int, v byte) (*ecdsa.PublicKey, error) {
+	n := p256.N
+	if v > 3 || r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return nil, errInvalidSignature
+	}
+	t := new(big.Int).Add(r, s)
+	t.Mod(t, n)
+	if t.Sign() == 0 {
+		return nil, errInvalidSignature
+	}
+	// x1 = r - e mod n, and n is added if x1 >= n when signing
+	e := new(big.Int).SetBytes(digest)
+	x1 := new(big.Int).Sub(r, e)
+	x1.Mod(x1, n)
+	if v&2 != 0 {
+		x1.Add(x1, n)
+	}
+	if x1.Cmp(p256.P) >= 0 {
+		return nil, errInvalidSignature
+	}
+	y1 := decompressY(x1, uint(v&1))
+	if y1 == nil {
+		return nil, errInvalidSignature
+	}
+	// P = (R - sG) / t
+	sx, sy := p256.ScalarBaseMult(s.Bytes())
+	sy.Sub(p256.P, sy)
+	x, y := p256.Add(x1, y1, sx, sy)
+	tInv := new(big.Int).ModInverse(t, n)
+	x, y = p256.ScalarMult(x, y, tInv.Bytes())
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, errInvalidPublicKey
+	}
+	return &ecdsa.PublicKey{Curve: p256, X: x, Y: y}, nil
+}
+
+// decompressY return the y of x whose lowest bit is bit, or nil if x is not on curve
+func decompressY(x *big.Int, bit uint) *big.Int {
+	p := p256.P
+	// y^2 = x^3 - 3x + b
+	y2 := new(big.Int).Mul(x, x)
+	y2.Mul(y2, x)
+	threeX := new(big.Int).Lsh(x, 1)
+	threeX.Add(threeX, x)
+	y2.Sub(y2, threeX)
+	y2.Add(y2, p256.B)
+	y2.Mod(y2, p)
+	y := new(big.Int).ModSqrt(y2, p)
+	if y == nil {
+		return nil
+	}
+	if y.Bit(0) != bit {
+		y.Sub(p, y)
+	}
+	return y
+}
+
+// randInt return a random integer in [1, max]
+func randInt(rand io.Reader, max *big.Int) (*big.Int, error) {
+	var buf = make([]byte, 40)
+	if _, err := io.ReadFull(rand, buf); err != nil {
+		return nil, err
+	}
+	k := new(big.Int).SetBytes(buf)
+	k.Mod(k, max)
+	return k.Add(k, one), nil
+}
+
+func padded(value *big.Int) []byte {
+	var buf = make([]byte, 32)
+	return value.FillBytes(buf)
+}
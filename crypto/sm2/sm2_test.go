@@ -0,0 +1,89 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sm2
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func hexToBig(s string) *big.Int {
+	value, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic(s)
+	}
+	return value
+}
+
+// The example of signature in appendix A of GM/T 0003.5-2012
+func TestSignVector(t *testing.T) {
+	priv := NewPrivateKey(hexToBig("3945208F7B2144B13F36E38AC6D39F95889393692860B51A42FB81EF4DF7C5B8"))
+	require.Equal(t, hexToBig("09F9DF311E5421A150DD7D161E4BC5C672179FAD1833FC076BB08FF356F35020"), priv.X)
+	require.Equal(t, hexToBig("CCEA490CE26775A52DC6EA718CC1AA600AED05FBF35E084A6632F6072DA9AD13"), priv.Y)
+
+	za, err := ZA(&priv.PublicKey, DefaultID)
+	require.NoError(t, err)
+	require.Equal(t, "b2e14c5c79c6df5b85f4fe7ed8db7a262b9da7e07ccb0ea9f4747b8ccda8a4f3", hex.EncodeToString(za))
+	digest, err := Digest(&priv.PublicKey, DefaultID, []byte("message digest"))
+	require.NoError(t, err)
+	require.Equal(t, "f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640", hex.EncodeToString(digest))
+
+	r, s, v, ok := signWithK(priv, digest, hexToBig("59276E27D506861A16680F3AD9C02DCCEF3CC1FA3CDBE4CE6D54B80DEAC1BC21"))
+	require.True(t, ok)
+	require.Equal(t, hexToBig("F5A03B0648D2C4630EEAC513E1BB81A15944DA3827D5B74143AC7EACEEE720B3"), r)
+	require.Equal(t, hexToBig("B1B6AA29DF212FD8763182BC0D421CA1BB9038FD1F7F42D4840B69C485BBC1AA"), s)
+	require.True(t, Verify(&priv.PublicKey, digest, r, s))
+
+	pub, err := Recover(digest, r, s, v)
+	require.NoError(t, err)
+	require.Equal(t, priv.X, pub.X)
+	require.Equal(t, priv.Y, pub.Y)
+}
+
+func TestSignAndRecover(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		priv, err := GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		digest, err := Digest(&priv.PublicKey, DefaultID, []byte{byte(i)})
+		require.NoError(t, err)
+		r, s, v, err := Sign(rand.Reader, priv, digest)
+		require.NoError(t, err)
+		require.True(t, Verify(&priv.PublicKey, digest, r, s))
+
+		pub, err := Recover(digest, r, s, v)
+		require.NoError(t, err)
+		require.Equal(t, priv.X, pub.X)
+		require.Equal(t, priv.Y, pub.Y)
+		// the other parity recovers another key
+		pub, err = Recover(digest, r, s, v^1)
+		if err == nil {
+			require.NotEqual(t, priv.X, pub.X)
+		}
+
+		digest[0] ^= 1
+		require.False(t, Verify(&priv.PublicKey, digest, r, s))
+		require.False(t, Verify(&priv.PublicKey, digest, new(big.Int), s))
+		require.False(t, Verify(&priv.PublicKey, digest, r, new(big.Int).Set(p256.N)))
+	}
+	_, err := Recover(make([]byte, 32), big.NewInt(1), big.NewInt(1), 4)
+	require.Error(t, err)
+}
@@ -0,0 +1,60 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sm3
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The examples in appendix A of GM/T 0004-2012
+func TestSum(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		output string
+	}{
+		{"abc", "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0"},
+		{strings.Repeat("abcd", 16), "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732"},
+		{"", "1ab21d8355cfa17f8e61194831e81a8f22bec8c728fefb747ed035eb5082aa2b"},
+	} {
+		sum := Sum([]byte(test.input))
+		require.Equal(t, test.output, hex.EncodeToString(sum[:]), test.input)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	input := []byte(strings.Repeat("abcdefg", 100))
+	want := Sum(input)
+	// write in pieces which cross the blocks
+	for _, size := range []int{1, 7, 63, 64, 65, 200} {
+		h := New()
+		for i := 0; i < len(input); i += size {
+			end := i + size
+			if end > len(input) {
+				end = len(input)
+			}
+			h.Write(input[i:end])
+		}
+		require.Equal(t, want[:], h.Sum(nil), "size %d", size)
+		// Sum does not change the state
+		require.Equal(t, want[:], h.Sum(nil), "size %d", size)
+	}
+}
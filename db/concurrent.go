@@ -0,0 +1,278 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package db
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thu-arxan/evm"
+)
+
+// Concurrent is a memory db which is safe for concurrent use. The state is
+// kept in immutable snapshots, and committing a write batch creates a new
+// snapshot by copy-on-write, so the readers get a consistent point-in-time
+// state by Snapshot and are never blocked by the writer.
+// The commits are serialized, which makes a single writer. The accounts and
+// the storages are kept in persistent hash tries, and a commit copies only the
+// paths to the written keys, so it costs O(writes * log(state)) and the rest
+// of the state is shared with the previous snapshot, see BenchmarkConcurrentCommit.
+// Note: A Cache or an EVM is still not thread safety, so every goroutine
+// should run its own EVM on the Concurrent or a Snapshot.
+type Concurrent struct {
+	// mu serializes the commits
+	mu sync.Mutex
+	// snapshot is the latest *Snapshot
+	snapshot atomic.Value
+
+	accountFunc func(address evm.Address) evm.Account
+}
+
+// NewConcurrent is the constructor of Concurrent
+func NewConcurrent(accountFunc func(address evm.Address) evm.Account) *Concurrent {
+	c := &Concurrent{
+		accountFunc: accountFunc,
+	}
+	c.snapshot.Store(&Snapshot{
+		accountFunc: accountFunc,
+	})
+	return c
+}
+
+// Snapshot return the latest snapshot, which is not changed by the later commits
+func (c *Concurrent) Snapshot() *Snapshot {
+	return c.snapshot.Load().(*Snapshot)
+}
+
+// Exist is the implementation of interface, which reads the latest snapshot
+func (c *Concurrent) Exist(address evm.Address) bool {
+	return c.Snapshot().Exist(address)
+}
+
+// GetAccount is the implementation of interface, which reads the latest snapshot
+func (c *Concurrent) GetAccount(address evm.Address) evm.Account {
+	return c.Snapshot().GetAccount(address)
+}
+
+// GetStorage is the implementation of interface, which reads the latest snapshot
+func (c *Concurrent) GetStorage(address evm.Address, key []byte) []byte {
+	return c.Snapshot().GetStorage(address, key)
+}
+
+// NewWriteBatch is the implementation of interface, and the writes are
+// applied as a new snapshot if the batch is committed
+func (c *Concurrent) NewWriteBatch() evm.WriteBatch {
+	return &ConcurrentBatch{
+		c:        c,
+		accounts: make(map[string]evm.Account),
+		storages: make(map[string]map[string][]byte),
+		deleted:  make(map[string]bool),
+	}
+}
+
+// GetLog return the logs of latest snapshot
+func (c *Concurrent) GetLog() []*evm.Log {
+	return c.Snapshot().GetLog()
+}
+
+// Accounts return the accounts of latest snapshot
+func (c *Concurrent) Accounts() []evm.Account {
+	return c.Snapshot().Accounts()
+}
+
+// Storages return the storages of an account in latest snapshot
+func (c *Concurrent) Storages(address evm.Address) map[string][]byte {
+	return c.Snapshot().Storages(address)
+}
+
+// Snapshot is an immutable state of Concurrent, which could be read by many
+// goroutines. The accounts are copied when they are read, so modifying them
+// does not change the snapshot.
+type Snapshot struct {
+	// seq is the count of commits before the snapshot
+	seq uint64
+	// accounts is keyed by address, and the value is evm.Account
+	accounts hamt
+	// storages is keyed by address, and the value is the hamt of storages
+	// keyed by storage key, whose value is []byte
+	storages hamt
+	logs     []*evm.Log
+
+	accountFunc func(address evm.Address) evm.Account
+}
+
+// Seq return the count of commits before the snapshot
+func (s *Snapshot) Seq() uint64 {
+	return s.seq
+}
+
+// Exist is the implementation of interface
+func (s *Snapshot) Exist(address evm.Address) bool {
+	_, ok := s.accounts.Get(string(address.Bytes()))
+	return ok
+}
+
+// GetAccount is the implementation of interface
+func (s *Snapshot) GetAccount(address evm.Address) evm.Account {
+	if account, ok := s.accounts.Get(string(address.Bytes())); ok {
+		return account.(evm.Account).Copy()
+	}
+	return s.accountFunc(address)
+}
+
+// GetStorage is the implementation of interface
+func (s *Snapshot) GetStorage(address evm.Address, key []byte) []byte {
+	if value, ok := s.storage(string(address.Bytes())).Get(string(key)); ok {
+		return value.([]byte)
+	}
+	return nil
+}
+
+// storage return the storages of an account, which is empty if it has none
+func (s *Snapshot) storage(addr string) hamt {
+	if storages, ok := s.storages.Get(addr); ok {
+		return storages.(hamt)
+	}
+	return hamt{}
+}
+
+// NewWriteBatch is the implementation of interface, and the batch could not
+// be committed if anything is written, so only read-only calls could run on a snapshot
+func (s *Snapshot) NewWriteBatch() evm.WriteBatch {
+	return &readOnlyBatch{}
+}
+
+// GetLog return logs
+func (s *Snapshot) GetLog() []*evm.Log {
+	// the capacity is limited, so appending to the result does not change the logs shared by snapshots
+	return s.logs[:len(s.logs):len(s.logs)]
+}
+
+// Accounts return the accounts which are not suicided, and they are sorted by address
+func (s *Snapshot) Accounts() []evm.Account {
+	var accounts = make([]evm.Account, 0, s.accounts.Len())
+	s.accounts.Range(func(key string, value interface{}) bool {
+		if account := value.(evm.Account); !account.HasSuicide() {
+			accounts = append(accounts, account.Copy())
+		}
+		return true
+	})
+	sort.Slice(accounts, func(i, j int) bool {
+		return string(accounts[i].GetAddress().Bytes()) < string(accounts[j].GetAddress().Bytes())
+	})
+	return accounts
+}
+
+// Storages return the storages of an account, which are keyed by the string of storage key
+func (s *Snapshot) Storages(address evm.Address) map[string][]byte {
+	var storages = make(map[string][]byte)
+	s.storage(string(address.Bytes())).Range(func(key string, value interface{}) bool {
+		storages[key] = value.([]byte)
+		return true
+	})
+	return storages
+}
+
+// ConcurrentBatch is the write batch of Concurrent, which is buffered until Commit
+type ConcurrentBatch struct {
+	c        *Concurrent
+	accounts map[string]evm.Account
+	storages map[string]map[string][]byte
+	// deleted is the accounts deleted before the buffered writes
+	deleted map[string]bool
+	logs    []*evm.Log
+}
+
+// SetStorage is the implementation of interface
+func (b *ConcurrentBatch) SetStorage(address evm.Address, key, value []byte) {
+	addr := string(address.Bytes())
+	if _, ok := b.storages[addr]; !ok {
+		b.storages[addr] = make(map[string][]byte)
+	}
+	b.storages[addr][string(key)] = value
+}
+
+// UpdateAccount is the implementation of interface, and the account is
+// copied, so modifying it after commit does not change the snapshot
+func (b *ConcurrentBatch) UpdateAccount(account evm.Account) error {
+	b.accounts[string(account.GetAddress().Bytes())] = account.Copy()
+	return nil
+}
+
+// DeleteAccount is the implementation of interface, and the writes of the
+// account before it in the batch are dropped
+func (b *ConcurrentBatch) DeleteAccount(address evm.Address) {
+	addr := string(address.Bytes())
+	delete(b.accounts, addr)
+	delete(b.storages, addr)
+	b.deleted[addr] = true
+}
+
+// AddLog is the implementation of interface
+func (b *ConcurrentBatch) AddLog(log *evm.Log) {
+	b.logs = append(b.logs, log)
+}
+
+// Commit is the implementation of interface, which creates a new snapshot
+// from the latest one, the batch should not be used after Commit
+func (b *ConcurrentBatch) Commit() error {
+	c := b.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev := c.Snapshot()
+	s := &Snapshot{
+		seq:         prev.seq + 1,
+		accounts:    prev.accounts,
+		storages:    prev.storages,
+		logs:        prev.logs,
+		accountFunc: c.accountFunc,
+	}
+	// the hamts of previous snapshot are never modified, only the paths to the
+	// written keys are copied
+	for addr := range b.deleted {
+		s.accounts = s.accounts.Delete(addr)
+		s.storages = s.storages.Delete(addr)
+	}
+	for addr, account := range b.accounts {
+		s.accounts = s.accounts.Set(addr, account)
+	}
+	for addr, storages := range b.storages {
+		storage := s.storage(addr)
+		for key, value := range storages {
+			storage = storage.Set(key, value)
+		}
+		s.storages = s.storages.Set(addr, storage)
+	}
+	for _, log := range b.logs {
+		// the logs beyond the length of previous snapshot are never read by it
+		log.Index = uint(len(s.logs))
+		s.logs = append(s.logs, log)
+	}
+	c.snapshot.Store(s)
+	b.Discard()
+	return nil
+}
+
+// Discard is the implementation of interface
+func (b *ConcurrentBatch) Discard() {
+	b.accounts = make(map[string]evm.Account)
+	b.storages = make(map[string]map[string][]byte)
+	b.deleted = make(map[string]bool)
+	b.logs = nil
+}
@@ -0,0 +1,194 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package db
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/example"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentSnapshot(t *testing.T) {
+	c := NewConcurrent(example.NewBlockchain().NewAccount)
+	alice, bob := example.HexToAddress("a1"), example.HexToAddress("b0")
+	empty := c.Snapshot()
+
+	wb := c.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 100, 1, nil)))
+	require.NoError(t, wb.UpdateAccount(newAccount("b0", 10, 0, nil)))
+	wb.SetStorage(alice, []byte{1}, []byte{1})
+	wb.SetStorage(bob, []byte{1}, []byte{1})
+	wb.AddLog(&evm.Log{Address: alice})
+	// the writes are not applied before commit
+	require.False(t, c.Exist(alice))
+	require.NoError(t, wb.Commit())
+	first := c.Snapshot()
+	require.EqualValues(t, 1, first.Seq())
+	require.EqualValues(t, 100, c.GetAccount(alice).GetBalance())
+	require.Len(t, c.GetLog(), 1)
+
+	// the later commits do not change the snapshots
+	wb = c.NewWriteBatch()
+	account := newAccount("a1", 200, 2, nil)
+	require.NoError(t, wb.UpdateAccount(account))
+	wb.SetStorage(alice, []byte{1}, []byte{2})
+	wb.DeleteAccount(bob)
+	wb.AddLog(&evm.Log{Address: alice})
+	require.NoError(t, wb.Commit())
+	// modifying the committed or read account does not change the snapshot
+	account.AddBalance(1)
+	c.GetAccount(alice).AddBalance(1)
+	require.EqualValues(t, 200, c.GetAccount(alice).GetBalance())
+	require.Equal(t, []byte{2}, c.GetStorage(alice, []byte{1}))
+	require.False(t, c.Exist(bob))
+	require.Len(t, c.GetLog(), 2)
+	require.EqualValues(t, 1, c.GetLog()[1].Index)
+
+	require.False(t, empty.Exist(alice))
+	require.Empty(t, empty.Accounts())
+	require.EqualValues(t, 100, first.GetAccount(alice).GetBalance())
+	require.Equal(t, []byte{1}, first.GetStorage(alice, []byte{1}))
+	require.Equal(t, map[string][]byte{"\x01": {1}}, first.Storages(bob))
+	require.Len(t, first.Accounts(), 2)
+	require.Len(t, first.GetLog(), 1)
+
+	// the snapshot is read-only
+	wb = first.NewWriteBatch()
+	require.NoError(t, wb.Commit())
+	wb.SetStorage(alice, []byte{1}, []byte{3})
+	require.True(t, errors.Is(wb.Commit(), ErrReadOnly))
+	require.Equal(t, []byte{1}, first.GetStorage(alice, []byte{1}))
+}
+
+// TestConcurrentRace should be run with -race, the readers check that every
+// snapshot is consistent while the writer commits
+func TestConcurrentRace(t *testing.T) {
+	const commits = 200
+	c := NewConcurrent(example.NewBlockchain().NewAccount)
+	alice := example.HexToAddress("a1")
+	key := core.Uint64ToWord256(1).Bytes()
+
+	var wg sync.WaitGroup
+	var done = make(chan struct{})
+	var errs = make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := c.Snapshot()
+				// the balance, storage and count of logs are all the seq of snapshot
+				balance := s.GetAccount(alice).GetBalance()
+				value := core.Uint64FromWord256(core.BytesToWord256(s.GetStorage(alice, key)))
+				if balance != s.Seq() || value != s.Seq() || uint64(len(s.GetLog())) != s.Seq() || len(s.Storages(alice)) != len(s.Accounts()) {
+					errs <- errors.New("inconsistent snapshot")
+					return
+				}
+			}
+		}()
+	}
+	for i := uint64(1); i <= commits; i++ {
+		wb := c.NewWriteBatch()
+		account := c.GetAccount(alice)
+		require.NoError(t, account.AddBalance(1))
+		require.NoError(t, wb.UpdateAccount(account))
+		wb.SetStorage(alice, key, core.Uint64ToWord256(i).Bytes())
+		wb.AddLog(&evm.Log{Address: alice})
+		require.NoError(t, wb.Commit())
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, commits, c.Snapshot().Seq())
+	require.EqualValues(t, commits, c.GetAccount(alice).GetBalance())
+}
+
+// BenchmarkConcurrentCommit commits a batch which writes one slot of one
+// account, and the cost grows with the log of the count of accounts and the
+// storages of the account rather than the count
+func BenchmarkConcurrentCommit(b *testing.B) {
+	for _, size := range []int{1000, 100000} {
+		b.Run(fmt.Sprintf("accounts-%d", size), func(b *testing.B) {
+			c := newLargeConcurrent(b, size, 1)
+			benchmarkCommit(b, c, 1)
+		})
+		b.Run(fmt.Sprintf("storages-%d", size), func(b *testing.B) {
+			c := newLargeConcurrent(b, 1, size)
+			benchmarkCommit(b, c, 1)
+		})
+	}
+}
+
+// BenchmarkConcurrentCommitWrites commits batches of different sizes on the
+// same state, and the cost grows with the writes of batch
+func BenchmarkConcurrentCommitWrites(b *testing.B) {
+	c := newLargeConcurrent(b, 10000, 10)
+	for _, writes := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("writes-%d", writes), func(b *testing.B) {
+			benchmarkCommit(b, c, writes)
+		})
+	}
+}
+
+// newLargeConcurrent return a Concurrent with accounts, and every account has storages
+func newLargeConcurrent(b *testing.B, accounts, storages int) *Concurrent {
+	bc := example.NewBlockchain()
+	c := NewConcurrent(bc.NewAccount)
+	wb := c.NewWriteBatch()
+	for i := 0; i < accounts; i++ {
+		address := bc.BytesToAddress(core.Uint64ToWord256(uint64(i + 1)).Bytes()[12:])
+		account := bc.NewAccount(address)
+		require.NoError(b, account.AddBalance(1))
+		require.NoError(b, wb.UpdateAccount(account))
+		for j := 0; j < storages; j++ {
+			wb.SetStorage(address, core.Uint64ToWord256(uint64(j)).Bytes(), []byte{1})
+		}
+	}
+	require.NoError(b, wb.Commit())
+	return c
+}
+
+// benchmarkCommit commits batches which write a slot of each of the first writes accounts
+func benchmarkCommit(b *testing.B, c *Concurrent, writes int) {
+	bc := example.NewBlockchain()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wb := c.NewWriteBatch()
+		for j := 0; j < writes; j++ {
+			address := bc.BytesToAddress(core.Uint64ToWord256(uint64(j + 1)).Bytes()[12:])
+			wb.SetStorage(address, core.Zero256.Bytes(), core.Uint64ToWord256(uint64(i)).Bytes())
+		}
+		if err := wb.Commit(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
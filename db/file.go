@@ -0,0 +1,922 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/crypto"
+	"github.com/thu-arxan/evm/rlp"
+)
+
+// File is a db persisted in an append-only log file.
+// Every committed write batch is appended as one record, which is
+// length(4 bytes) || crc32(4 bytes) || entries, and the entries are accounts,
+// codes, storages and logs. Codes are keyed by code hash, so the same code is
+// only written once. The offsets of latest values are indexed in memory, which
+// is rebuilt by scanning the file when it is opened. Deleting an account
+// appends a delete entry, which drops the account and all its storages.
+// SetHeight and RollbackTo append a height entry and a rollback entry, so the
+// versions of blocks are rebuilt by scanning the file as well.
+// A record which is not completely written, such as the process crashes while
+// appending, is truncated when the file is opened again, so a write batch is
+// either applied or not.
+// Note: File is not thread safety.
+type File struct {
+	file *os.File
+	// sync is file.Sync, which is replaced to inject failures in tests
+	sync func() error
+	// size is the offset of next record
+	size int64
+
+	accounts map[string]location
+	codes    map[string]location
+	// storages is keyed by address and then storage key
+	storages map[string]map[string]location
+	logs     []location
+
+	history
+	// versions is sorted by height
+	versions []*fileVersion
+
+	bc evm.Blockchain
+}
+
+// fileVersion is the locations before the writes of a block, and nil means
+// the account or storage is not exist
+type fileVersion struct {
+	height   uint64
+	accounts map[string]*location
+	storages map[string]map[string]*location
+	// logs is the count of logs before the block
+	logs int
+}
+
+// location is the position of a value in file
+type location struct {
+	offset int64
+	length int
+}
+
+// the kinds of entry
+const (
+	entryAccount byte = iota + 1
+	entryCode
+	entryStorage
+	entryLog
+	entryDelete
+	entryHeight
+	entryRollback
+)
+
+const recordHeaderLength = 8
+
+var errBrokenRecord = errors.New("broken record")
+
+// fileAccount is the value of an account entry
+type fileAccount struct {
+	Balance  uint64
+	Nonce    uint64
+	Suicided bool
+	// CodeHash is empty if there is no code
+	CodeHash []byte
+}
+
+// fileLog is the value of a log entry
+type fileLog struct {
+	Address     []byte
+	Topics      [][]byte
+	Data        []byte
+	BlockNumber uint64
+	TxHash      []byte
+	TxIndex     uint64
+	BlockHash   []byte
+	Index       uint64
+}
+
+// OpenFile open the db at path, and create it if not exist. bc is used to create
+// accounts and addresses of logs which are read from file.
+func OpenFile(path string, bc evm.Blockchain) (*File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{
+		file:     file,
+		sync:     file.Sync,
+		accounts: make(map[string]location),
+		codes:    make(map[string]location),
+		storages: make(map[string]map[string]location),
+		bc:       bc,
+	}
+	if err := f.recover(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// recover rebuild the index by scanning records, and truncate the broken tail
+func (f *File) recover() error {
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	for f.size < info.Size() {
+		record, err := f.readRecord(f.size, info.Size())
+		if err == errBrokenRecord {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := f.index(record, f.size+recordHeaderLength); err != nil {
+			return err
+		}
+		f.size += recordHeaderLength + int64(len(record))
+	}
+	if f.size < info.Size() {
+		if err := f.file.Truncate(f.size); err != nil {
+			return err
+		}
+		return f.file.Sync()
+	}
+	return nil
+}
+
+// readRecord return the entries of record at offset, or errBrokenRecord if
+// the record is incomplete or the checksum mismatches
+func (f *File) readRecord(offset, fileSize int64) ([]byte, error) {
+	if fileSize-offset < recordHeaderLength {
+		return nil, errBrokenRecord
+	}
+	var header = make([]byte, recordHeaderLength)
+	if _, err := f.file.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[:4]))
+	if fileSize-offset-recordHeaderLength < length {
+		return nil, errBrokenRecord
+	}
+	var record = make([]byte, length)
+	if _, err := f.file.ReadAt(record, offset+recordHeaderLength); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errBrokenRecord
+	}
+	return record, nil
+}
+
+// walkRecord calls fn with every entry in record, which starts at offset of file
+func walkRecord(record []byte, offset int64, fn func(kind byte, key []byte, loc location) error) error {
+	var r = bytes.NewReader(record)
+	for r.Len() > 0 {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		key, err := readBytes(r)
+		if err != nil {
+			return err
+		}
+		length, err := binary.ReadUvarint(r)
+		if err != nil || length > uint64(r.Len()) {
+			return fmt.Errorf("invalid entry at %d", offset)
+		}
+		loc := location{
+			offset: offset + int64(len(record)-r.Len()),
+			length: int(length),
+		}
+		r.Seek(int64(length), io.SeekCurrent)
+		if err := fn(kind, key, loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate return an error if index would fail on record, and nothing is changed
+func validate(record []byte, offset int64) error {
+	return walkRecord(record, offset, func(kind byte, key []byte, loc location) error {
+		switch kind {
+		case entryAccount, entryCode, entryLog, entryDelete:
+			return nil
+		case entryStorage:
+			_, _, err := splitStorageKey(key)
+			return err
+		case entryHeight, entryRollback:
+			if loc.length != 8 {
+				return fmt.Errorf("invalid height entry at %d", loc.offset)
+			}
+			return nil
+		default:
+			return fmt.Errorf("unknown entry kind %d", kind)
+		}
+	})
+}
+
+// index update the locations of entries in record, which starts at offset of file,
+// and the record is validated first so the index is not changed if it is invalid
+func (f *File) index(record []byte, offset int64) error {
+	if err := validate(record, offset); err != nil {
+		return err
+	}
+	return walkRecord(record, offset, func(kind byte, key []byte, loc location) error {
+		switch kind {
+		case entryAccount:
+			f.setAccount(string(key), loc)
+		case entryCode:
+			f.codes[string(key)] = loc
+		case entryStorage:
+			address, key, _ := splitStorageKey(key)
+			f.setStorage(address, key, loc)
+		case entryLog:
+			f.version()
+			f.logs = append(f.logs, loc)
+		case entryDelete:
+			f.deleteAccount(string(key))
+		case entryHeight, entryRollback:
+			height := binary.BigEndian.Uint64(record[loc.offset-offset:][:loc.length])
+			if kind == entryHeight {
+				f.height = height
+				f.prune()
+			} else {
+				f.rollback(height)
+			}
+		}
+		return nil
+	})
+}
+
+func (f *File) read(loc location) ([]byte, error) {
+	var value = make([]byte, loc.length)
+	if _, err := f.file.ReadAt(value, loc.offset); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Close close the file
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// Exist is the implementation of interface
+func (f *File) Exist(address evm.Address) bool {
+	return f.accountAt(string(address.Bytes()), f.height) != nil
+}
+
+// TryExist is the implementation of evm.FallibleDB
+func (f *File) TryExist(address evm.Address) (bool, error) {
+	return f.Exist(address), nil
+}
+
+// GetAccount is the implementation of interface
+// Note: It panics if the file could not be read, and TryGetAccount reports the error instead.
+func (f *File) GetAccount(address evm.Address) evm.Account {
+	account, err := f.TryGetAccount(address)
+	if err != nil {
+		panic(err)
+	}
+	return account
+}
+
+// TryGetAccount is the implementation of evm.FallibleDB
+func (f *File) TryGetAccount(address evm.Address) (evm.Account, error) {
+	return f.tryGetAccountAt(address, f.height)
+}
+
+func (f *File) tryGetAccountAt(address evm.Address, height uint64) (evm.Account, error) {
+	account := f.bc.NewAccount(address)
+	loc := f.accountAt(string(address.Bytes()), height)
+	if loc == nil {
+		return account, nil
+	}
+	value, err := f.read(*loc)
+	if err != nil {
+		return nil, err
+	}
+	var a fileAccount
+	if err := rlp.DecodeBytes(value, &a); err != nil {
+		return nil, err
+	}
+	if err := account.AddBalance(a.Balance); err != nil {
+		return nil, err
+	}
+	account.SetNonce(a.Nonce)
+	if len(a.CodeHash) != 0 {
+		loc, ok := f.codes[string(a.CodeHash)]
+		if !ok {
+			return nil, fmt.Errorf("code %x is not found", a.CodeHash)
+		}
+		code, err := f.read(loc)
+		if err != nil {
+			return nil, err
+		}
+		account.SetCode(code)
+	}
+	if a.Suicided {
+		account.Suicide()
+	}
+	return account, nil
+}
+
+// GetStorage is the implementation of interface
+// Note: It panics if the file could not be read, and TryGetStorage reports the error instead.
+func (f *File) GetStorage(address evm.Address, key []byte) []byte {
+	value, err := f.TryGetStorage(address, key)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// TryGetStorage is the implementation of evm.FallibleDB
+func (f *File) TryGetStorage(address evm.Address, key []byte) ([]byte, error) {
+	return f.tryGetStorageAt(address, key, f.height)
+}
+
+func (f *File) tryGetStorageAt(address evm.Address, key []byte, height uint64) ([]byte, error) {
+	loc := f.storageAt(string(address.Bytes()), string(key), height)
+	if loc == nil {
+		return nil, nil
+	}
+	return f.read(*loc)
+}
+
+// NewWriteBatch is the implementation of interface, and the writes are
+// applied only if the batch is committed
+func (f *File) NewWriteBatch() evm.WriteBatch {
+	return &FileBatch{
+		f:     f,
+		codes: make(map[string]bool),
+	}
+}
+
+// GetLog return logs
+// Note: It panics if the file could not be read.
+func (f *File) GetLog() []*evm.Log {
+	return f.readLogs(f.logs)
+}
+
+func (f *File) readLogs(locs []location) []*evm.Log {
+	var logs = make([]*evm.Log, len(locs))
+	for i, loc := range locs {
+		value, err := f.read(loc)
+		if err != nil {
+			panic(err)
+		}
+		var l fileLog
+		if err := rlp.DecodeBytes(value, &l); err != nil {
+			panic(err)
+		}
+		logs[i] = &evm.Log{
+			Address:     f.bc.BytesToAddress(l.Address),
+			Topics:      make([]core.Word256, len(l.Topics)),
+			Data:        l.Data,
+			BlockNumber: l.BlockNumber,
+			TxHash:      l.TxHash,
+			TxIndex:     uint(l.TxIndex),
+			BlockHash:   l.BlockHash,
+			Index:       uint(l.Index),
+		}
+		for j, topic := range l.Topics {
+			logs[i].Topics[j] = core.BytesToWord256(topic)
+		}
+	}
+	return logs
+}
+
+// Accounts return the accounts which are not suicided, and they are sorted by address
+func (f *File) Accounts() []evm.Account {
+	return f.accountsAt(f.height)
+}
+
+func (f *File) accountsAt(height uint64) []evm.Account {
+	var locs = make(map[string]*location, len(f.accounts))
+	for key := range f.accounts {
+		loc := f.accounts[key]
+		locs[key] = &loc
+	}
+	var versions = f.above(height)
+	for i := len(versions) - 1; i >= 0; i-- {
+		for key, loc := range versions[i].accounts {
+			locs[key] = loc
+		}
+	}
+	var keys = make([]string, 0, len(locs))
+	for key, loc := range locs {
+		if loc != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var accounts = make([]evm.Account, 0, len(keys))
+	for _, key := range keys {
+		account, err := f.tryGetAccountAt(f.bc.BytesToAddress([]byte(key)), height)
+		if err != nil {
+			panic(err)
+		}
+		if !account.HasSuicide() {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+// Storages return the storages of an account, which are keyed by the string of storage key
+func (f *File) Storages(address evm.Address) map[string][]byte {
+	return f.storagesAt(string(address.Bytes()), f.height)
+}
+
+func (f *File) storagesAt(addr string, height uint64) map[string][]byte {
+	var locs = make(map[string]*location)
+	for key := range f.storages[addr] {
+		loc := f.storages[addr][key]
+		locs[key] = &loc
+	}
+	var versions = f.above(height)
+	for i := len(versions) - 1; i >= 0; i-- {
+		for key, loc := range versions[i].storages[addr] {
+			locs[key] = loc
+		}
+	}
+	var storages = make(map[string][]byte)
+	for key, loc := range locs {
+		if loc == nil {
+			continue
+		}
+		value, err := f.read(*loc)
+		if err != nil {
+			panic(err)
+		}
+		storages[key] = value
+	}
+	return storages
+}
+
+// Height return the current height
+func (f *File) Height() uint64 {
+	return f.height
+}
+
+// SetHeight set the current height, and the writes after it belong to the
+// block at height. The height should not be lower than current height.
+func (f *File) SetHeight(height uint64) error {
+	if err := f.checkHeight(height); err != nil {
+		return err
+	}
+	if height == f.height {
+		return nil
+	}
+	return f.appendHeight(entryHeight, height)
+}
+
+// SetPruning keep the versions of latest blocks only, so the state older than
+// blocks before current height could not be read or rolled back to, and 0
+// means all versions are kept, which is the default.
+// Note: The pruning is not persisted, and the file is not compacted, so all
+// versions are kept again when the file is opened until SetPruning is called.
+func (f *File) SetPruning(blocks uint64) {
+	f.pruning = blocks
+	f.prune()
+}
+
+// At return a read-only view of the state at height, which is valid until the
+// height is pruned or rolled back. The view at current height sees the later
+// writes of current block.
+func (f *File) At(height uint64) (evm.DB, error) {
+	if err := f.check(height); err != nil {
+		return nil, err
+	}
+	return &fileView{f: f, height: height}, nil
+}
+
+// RollbackTo undo the writes of blocks higher than height, and height becomes
+// the current height. The rollback is appended as a record, so it is
+// persisted as well.
+func (f *File) RollbackTo(height uint64) error {
+	if err := f.check(height); err != nil {
+		return err
+	}
+	return f.appendHeight(entryRollback, height)
+}
+
+func (f *File) appendHeight(kind byte, height uint64) error {
+	var value [8]byte
+	binary.BigEndian.PutUint64(value[:], height)
+	b := &FileBatch{f: f}
+	b.write(kind, nil, value[:])
+	return b.Commit()
+}
+
+// rollback undo the versions higher than height
+func (f *File) rollback(height uint64) {
+	for len(f.versions) > 0 {
+		v := f.versions[len(f.versions)-1]
+		if v.height <= height {
+			break
+		}
+		for addr, loc := range v.accounts {
+			if loc == nil {
+				delete(f.accounts, addr)
+			} else {
+				f.accounts[addr] = *loc
+			}
+		}
+		for addr, storages := range v.storages {
+			for key, loc := range storages {
+				f.restoreStorage(addr, key, loc)
+			}
+		}
+		f.logs = f.logs[:v.logs]
+		f.versions = f.versions[:len(f.versions)-1]
+	}
+	f.height = height
+}
+
+// prune drop the versions which are not higher than base
+func (f *File) prune() {
+	if !f.history.prune() {
+		return
+	}
+	var i = 0
+	for i < len(f.versions) && f.versions[i].height <= f.base {
+		i++
+	}
+	f.versions = f.versions[i:]
+}
+
+// version return the version of current height, or nil if it is not recorded
+func (f *File) version() *fileVersion {
+	if !f.recording() {
+		return nil
+	}
+	if len(f.versions) > 0 && f.versions[len(f.versions)-1].height == f.height {
+		return f.versions[len(f.versions)-1]
+	}
+	v := &fileVersion{
+		height:   f.height,
+		accounts: make(map[string]*location),
+		storages: make(map[string]map[string]*location),
+		logs:     len(f.logs),
+	}
+	f.versions = append(f.versions, v)
+	return v
+}
+
+func (f *File) setAccount(addr string, loc location) {
+	if v := f.version(); v != nil {
+		v.recordAccount(addr, f.accounts)
+	}
+	f.accounts[addr] = loc
+}
+
+func (f *File) setStorage(addr, key string, loc location) {
+	if v := f.version(); v != nil {
+		v.recordStorage(addr, key, f.storages[addr])
+	}
+	if _, ok := f.storages[addr]; !ok {
+		f.storages[addr] = make(map[string]location)
+	}
+	f.storages[addr][key] = loc
+}
+
+func (f *File) deleteAccount(addr string) {
+	if v := f.version(); v != nil {
+		v.recordAccount(addr, f.accounts)
+		for key := range f.storages[addr] {
+			v.recordStorage(addr, key, f.storages[addr])
+		}
+	}
+	delete(f.accounts, addr)
+	delete(f.storages, addr)
+}
+
+// restoreStorage set the location of storage, and nil means deleting it
+func (f *File) restoreStorage(addr, key string, loc *location) {
+	if loc != nil {
+		if _, ok := f.storages[addr]; !ok {
+			f.storages[addr] = make(map[string]location)
+		}
+		f.storages[addr][key] = *loc
+		return
+	}
+	delete(f.storages[addr], key)
+	if len(f.storages[addr]) == 0 {
+		delete(f.storages, addr)
+	}
+}
+
+func (v *fileVersion) recordAccount(addr string, accounts map[string]location) {
+	if _, ok := v.accounts[addr]; ok {
+		return
+	}
+	if loc, ok := accounts[addr]; ok {
+		v.accounts[addr] = &loc
+	} else {
+		v.accounts[addr] = nil
+	}
+}
+
+func (v *fileVersion) recordStorage(addr, key string, storages map[string]location) {
+	if _, ok := v.storages[addr]; !ok {
+		v.storages[addr] = make(map[string]*location)
+	}
+	if _, ok := v.storages[addr][key]; ok {
+		return
+	}
+	if loc, ok := storages[key]; ok {
+		v.storages[addr][key] = &loc
+	} else {
+		v.storages[addr][key] = nil
+	}
+}
+
+// above return the versions higher than height
+func (f *File) above(height uint64) []*fileVersion {
+	var i = len(f.versions)
+	for i > 0 && f.versions[i-1].height > height {
+		i--
+	}
+	return f.versions[i:]
+}
+
+// accountAt return the location of account at height, or nil if it is not exist.
+// The location is kept by the lowest version above height which records it.
+func (f *File) accountAt(addr string, height uint64) *location {
+	for _, v := range f.above(height) {
+		if loc, ok := v.accounts[addr]; ok {
+			return loc
+		}
+	}
+	if loc, ok := f.accounts[addr]; ok {
+		return &loc
+	}
+	return nil
+}
+
+func (f *File) storageAt(addr, key string, height uint64) *location {
+	for _, v := range f.above(height) {
+		if loc, ok := v.storages[addr][key]; ok {
+			return loc
+		}
+	}
+	if loc, ok := f.storages[addr][key]; ok {
+		return &loc
+	}
+	return nil
+}
+
+func (f *File) logsAt(height uint64) []location {
+	if versions := f.above(height); len(versions) > 0 {
+		return f.logs[:versions[0].logs]
+	}
+	return f.logs
+}
+
+// fileView is the read-only state of File at height
+type fileView struct {
+	f      *File
+	height uint64
+}
+
+// Exist is the implementation of interface
+func (v *fileView) Exist(address evm.Address) bool {
+	return v.f.accountAt(string(address.Bytes()), v.height) != nil
+}
+
+// TryExist is the implementation of evm.FallibleDB
+func (v *fileView) TryExist(address evm.Address) (bool, error) {
+	return v.Exist(address), nil
+}
+
+// GetAccount is the implementation of interface
+// Note: It panics if the file could not be read, and TryGetAccount reports the error instead.
+func (v *fileView) GetAccount(address evm.Address) evm.Account {
+	account, err := v.TryGetAccount(address)
+	if err != nil {
+		panic(err)
+	}
+	return account
+}
+
+// TryGetAccount is the implementation of evm.FallibleDB
+func (v *fileView) TryGetAccount(address evm.Address) (evm.Account, error) {
+	return v.f.tryGetAccountAt(address, v.height)
+}
+
+// GetStorage is the implementation of interface
+// Note: It panics if the file could not be read, and TryGetStorage reports the error instead.
+func (v *fileView) GetStorage(address evm.Address, key []byte) []byte {
+	value, err := v.TryGetStorage(address, key)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// TryGetStorage is the implementation of evm.FallibleDB
+func (v *fileView) TryGetStorage(address evm.Address, key []byte) ([]byte, error) {
+	return v.f.tryGetStorageAt(address, key, v.height)
+}
+
+// NewWriteBatch is the implementation of interface, and the batch could not be committed if anything is written
+func (v *fileView) NewWriteBatch() evm.WriteBatch {
+	return &readOnlyBatch{}
+}
+
+// GetLog return the logs at height
+// Note: It panics if the file could not be read.
+func (v *fileView) GetLog() []*evm.Log {
+	return v.f.readLogs(v.f.logsAt(v.height))
+}
+
+// Accounts return the accounts at height
+func (v *fileView) Accounts() []evm.Account {
+	return v.f.accountsAt(v.height)
+}
+
+// Storages return the storages of an account at height
+func (v *fileView) Storages(address evm.Address) map[string][]byte {
+	return v.f.storagesAt(string(address.Bytes()), v.height)
+}
+
+// FileBatch is the write batch of File, which is buffered until Commit
+type FileBatch struct {
+	f       *File
+	entries bytes.Buffer
+	// codes is the code hashes written by the batch
+	codes map[string]bool
+	logs  int
+	err   error
+}
+
+// SetStorage is the implementation of interface
+func (b *FileBatch) SetStorage(address evm.Address, key []byte, value []byte) {
+	b.write(entryStorage, storageKey(address, key), value)
+}
+
+// DeleteAccount is the implementation of interface
+func (b *FileBatch) DeleteAccount(address evm.Address) {
+	b.write(entryDelete, address.Bytes(), nil)
+}
+
+// UpdateAccount is the implementation of interface
+func (b *FileBatch) UpdateAccount(account evm.Account) error {
+	var a = fileAccount{
+		Balance:  account.GetBalance(),
+		Nonce:    account.GetNonce(),
+		Suicided: account.HasSuicide(),
+	}
+	if code := account.GetCode(); len(code) != 0 {
+		a.CodeHash = crypto.Keccak256(code)
+		if _, ok := b.f.codes[string(a.CodeHash)]; !ok && !b.codes[string(a.CodeHash)] {
+			b.codes[string(a.CodeHash)] = true
+			b.write(entryCode, a.CodeHash, code)
+		}
+	}
+	value, err := rlp.EncodeToBytes(&a)
+	if err != nil {
+		return err
+	}
+	b.write(entryAccount, account.GetAddress().Bytes(), value)
+	return nil
+}
+
+// AddLog is the implementation of interface
+func (b *FileBatch) AddLog(log *evm.Log) {
+	log.Index = uint(len(b.f.logs) + b.logs)
+	b.logs++
+	var l = fileLog{
+		Address:     log.Address.Bytes(),
+		Topics:      make([][]byte, len(log.Topics)),
+		Data:        log.Data,
+		BlockNumber: log.BlockNumber,
+		TxHash:      log.TxHash,
+		TxIndex:     uint64(log.TxIndex),
+		BlockHash:   log.BlockHash,
+		Index:       uint64(log.Index),
+	}
+	for i := range log.Topics {
+		l.Topics[i] = log.Topics[i].Bytes()
+	}
+	value, err := rlp.EncodeToBytes(&l)
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.write(entryLog, nil, value)
+}
+
+// Commit is the implementation of interface, which append the batch as one
+// record and sync the file, the batch should not be used after Commit
+func (b *FileBatch) Commit() error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.entries.Len() == 0 {
+		return nil
+	}
+	f := b.f
+	record := b.entries.Bytes()
+	var data = make([]byte, recordHeaderLength+len(record))
+	binary.BigEndian.PutUint32(data[:4], uint32(len(record)))
+	binary.BigEndian.PutUint32(data[4:8], crc32.ChecksumIEEE(record))
+	copy(data[recordHeaderLength:], record)
+	// the record is validated before it is written, so it could be indexed
+	if err := validate(record, f.size+recordHeaderLength); err != nil {
+		return err
+	}
+	// the record is truncated if any step fails, otherwise it would be indexed
+	// when the file is opened again, and the next record would overwrite it
+	if _, err := f.file.WriteAt(data, f.size); err != nil {
+		f.file.Truncate(f.size)
+		return err
+	}
+	if err := f.sync(); err != nil {
+		f.file.Truncate(f.size)
+		return err
+	}
+	if err := f.index(record, f.size+recordHeaderLength); err != nil {
+		f.file.Truncate(f.size)
+		return err
+	}
+	f.size += int64(len(data))
+	return nil
+}
+
+// Discard is the implementation of interface
+func (b *FileBatch) Discard() {
+	b.entries.Reset()
+	b.codes = make(map[string]bool)
+	b.logs = 0
+	b.err = nil
+}
+
+func (b *FileBatch) write(kind byte, key, value []byte) {
+	b.entries.WriteByte(kind)
+	writeBytes(&b.entries, key)
+	writeBytes(&b.entries, value)
+}
+
+func writeBytes(w *bytes.Buffer, data []byte) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(data)))
+	w.Write(buf[:n])
+	w.Write(data)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var data = make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
+
+// storageKey is the key of storage entry, which is the length prefixed address and storage key
+func storageKey(address evm.Address, key []byte) []byte {
+	var buf bytes.Buffer
+	writeBytes(&buf, address.Bytes())
+	buf.Write(key)
+	return buf.Bytes()
+}
+
+func splitStorageKey(data []byte) (address, key string, err error) {
+	var r = bytes.NewReader(data)
+	addr, err := readBytes(r)
+	if err != nil {
+		return "", "", err
+	}
+	return string(addr), string(data[len(data)-r.Len():]), nil
+}
@@ -0,0 +1,301 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package db
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/asm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/errors"
+	"github.com/thu-arxan/evm/example"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func openFile(t *testing.T, path string) *File {
+	f, err := OpenFile(path, example.NewBlockchain())
+	require.NoError(t, err)
+	return f
+}
+
+func newAccount(address string, balance, nonce uint64, code []byte) evm.Account {
+	account := example.NewAccount(example.HexToAddress(address))
+	account.AddBalance(balance)
+	account.SetNonce(nonce)
+	account.SetCode(code)
+	return account
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evm.db")
+	f := openFile(t, path)
+	alice, bob := example.HexToAddress("a1"), example.HexToAddress("b0")
+	code := []byte{0x60, 0x01, 0x60, 0x02, 0x01}
+
+	wb := f.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 100, 1, code)))
+	require.NoError(t, wb.UpdateAccount(newAccount("b0", 200, 0, code)))
+	wb.SetStorage(alice, []byte{1}, []byte{0x11})
+	wb.AddLog(&evm.Log{Address: alice, Topics: []core.Word256{core.BytesToWord256([]byte{1})}, Data: []byte("log"), BlockNumber: 1})
+	// the writes are not applied before commit
+	require.False(t, f.Exist(alice))
+	require.Nil(t, f.GetStorage(alice, []byte{1}))
+	require.NoError(t, wb.Commit())
+	require.True(t, f.Exist(alice))
+	// the code is only written once
+	require.Len(t, f.codes, 1)
+
+	// the later values overwrite the former
+	wb = f.NewWriteBatch()
+	wb.SetStorage(alice, []byte{1}, []byte{0x12})
+	wb.SetStorage(alice, []byte{2}, []byte{0x22})
+	suicided := newAccount("b0", 200, 0, code)
+	suicided.Suicide()
+	require.NoError(t, wb.UpdateAccount(suicided))
+	wb.AddLog(&evm.Log{Address: bob, Data: []byte("second")})
+	require.NoError(t, wb.Commit())
+	require.NoError(t, f.Close())
+
+	f = openFile(t, path)
+	defer f.Close()
+	account := f.GetAccount(alice)
+	require.EqualValues(t, 100, account.GetBalance())
+	require.EqualValues(t, 1, account.GetNonce())
+	require.Equal(t, code, account.GetCode())
+	require.True(t, f.GetAccount(bob).HasSuicide())
+	require.Equal(t, []byte{0x12}, f.GetStorage(alice, []byte{1}))
+	require.Equal(t, map[string][]byte{"\x01": {0x12}, "\x02": {0x22}}, f.Storages(alice))
+	require.Len(t, f.Accounts(), 1)
+	// an account not exist is a default account
+	require.False(t, f.Exist(example.HexToAddress("c0")))
+	require.EqualValues(t, 0, f.GetAccount(example.HexToAddress("c0")).GetBalance())
+
+	logs := f.GetLog()
+	require.Len(t, logs, 2)
+	require.Equal(t, alice.Bytes(), logs[0].Address.Bytes())
+	require.Equal(t, []core.Word256{core.BytesToWord256([]byte{1})}, logs[0].Topics)
+	require.Equal(t, []byte("log"), logs[0].Data)
+	require.EqualValues(t, 1, logs[0].BlockNumber)
+	require.EqualValues(t, 1, logs[1].Index)
+}
+
+func TestFileDeleteAccount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evm.db")
+	f := openFile(t, path)
+	alice, bob := example.HexToAddress("a1"), example.HexToAddress("b0")
+	wb := f.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 100, 1, nil)))
+	require.NoError(t, wb.UpdateAccount(newAccount("b0", 100, 1, nil)))
+	wb.SetStorage(alice, []byte{1}, []byte{1})
+	wb.SetStorage(bob, []byte{1}, []byte{1})
+	require.NoError(t, wb.Commit())
+
+	wb = f.NewWriteBatch()
+	wb.DeleteAccount(alice)
+	require.NoError(t, wb.Commit())
+	require.False(t, f.Exist(alice))
+	require.Nil(t, f.GetStorage(alice, []byte{1}))
+	require.NoError(t, f.Close())
+
+	// the deletion is kept after reopen, and the account could be created again
+	f = openFile(t, path)
+	require.False(t, f.Exist(alice))
+	require.Empty(t, f.Storages(alice))
+	require.Equal(t, []byte{1}, f.GetStorage(bob, []byte{1}))
+	wb = f.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 10, 0, nil)))
+	wb.SetStorage(alice, []byte{2}, []byte{2})
+	require.NoError(t, wb.Commit())
+	require.NoError(t, f.Close())
+
+	f = openFile(t, path)
+	defer f.Close()
+	require.EqualValues(t, 10, f.GetAccount(alice).GetBalance())
+	require.Equal(t, map[string][]byte{"\x02": {2}}, f.Storages(alice))
+}
+
+func TestFileRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evm.db")
+	f := openFile(t, path)
+	wb := f.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 100, 0, nil)))
+	require.NoError(t, wb.Commit())
+	size := f.size
+	wb = f.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 50, 1, nil)))
+	wb.SetStorage(example.HexToAddress("a1"), []byte{1}, []byte{1})
+	require.NoError(t, wb.Commit())
+	full := f.size
+	require.NoError(t, f.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	// the second record is partially written or broken, so it is dropped
+	var broken = [][]byte{
+		data[:full-1],
+		data[:size+3],
+		append(append([]byte{}, data[:full-1]...), data[full-1]^1),
+	}
+	for i, data := range broken {
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		f = openFile(t, path)
+		require.Equal(t, size, f.size, i)
+		require.EqualValues(t, 100, f.GetAccount(example.HexToAddress("a1")).GetBalance(), i)
+		require.Nil(t, f.GetStorage(example.HexToAddress("a1"), []byte{1}), i)
+		require.NoError(t, f.Close())
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, size, info.Size(), i)
+	}
+
+	// the db could be written after recovery
+	f = openFile(t, path)
+	wb = f.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 10, 2, nil)))
+	require.NoError(t, wb.Commit())
+	require.NoError(t, f.Close())
+	f = openFile(t, path)
+	defer f.Close()
+	require.EqualValues(t, 10, f.GetAccount(example.HexToAddress("a1")).GetBalance())
+}
+
+func TestFileWithEVM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evm.db")
+	// counter increases the word at slot 0 and logs it
+	counter := asm.MustAssemble(`
+		PUSH1 0
+		SLOAD
+		PUSH1 1
+		ADD
+		DUP1
+		PUSH1 0
+		SSTORE
+		PUSH1 0
+		MSTORE
+		PUSH1 0x20
+		PUSH1 0
+		LOG0
+	`)
+	callee := example.HexToAddress("cc")
+	for i := 1; i <= 3; i++ {
+		bc := example.NewBlockchain()
+		f, err := OpenFile(path, bc)
+		require.NoError(t, err)
+		var gas uint64 = 100000
+		vm := evm.New(bc, f, &evm.Context{Gas: &gas})
+		_, err = vm.Call(example.HexToAddress("aa"), callee, counter)
+		require.NoError(t, err)
+		require.Equal(t, core.Uint64ToWord256(uint64(i)).Bytes(), f.GetStorage(callee, core.Zero256.Bytes()))
+		require.Len(t, f.GetLog(), i)
+		require.NoError(t, f.Close())
+	}
+}
+
+func TestFileFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evm.db")
+	bc := example.NewBlockchain()
+	f, err := OpenFile(path, bc)
+	require.NoError(t, err)
+	callee := example.HexToAddress("cc")
+	wb := f.NewWriteBatch()
+	wb.SetStorage(callee, core.Zero256.Bytes(), core.Uint64ToWord256(1).Bytes())
+	require.NoError(t, wb.Commit())
+	// the reads fail once the file is closed
+	require.NoError(t, f.Close())
+	_, err = f.TryGetStorage(callee, core.Zero256.Bytes())
+	require.Error(t, err)
+	require.Panics(t, func() { f.GetStorage(callee, core.Zero256.Bytes()) })
+
+	var gas uint64 = 100000
+	vm := evm.New(bc, f, &evm.Context{Gas: &gas})
+	_, err = vm.Call(example.HexToAddress("aa"), callee, asm.MustAssemble(`
+		PUSH1 0
+		SLOAD
+	`))
+	require.IsType(t, &errors.DBError{}, err)
+}
+
+// TestFileCommitFailure checks that a record is not left in the file if Commit
+// fails, so it is not indexed when the file is opened again
+func TestFileCommitFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evm.db")
+	f := openFile(t, path)
+	fileSize := func() int64 {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		return info.Size()
+	}
+	wb := f.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("aa", 1, 0, nil)))
+	require.NoError(t, wb.Commit())
+	size := fileSize()
+
+	// the sync fails
+	errSync := fmt.Errorf("sync failed")
+	f.sync = func() error { return errSync }
+	wb = f.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("bb", 1, 0, nil)))
+	require.Equal(t, errSync, wb.Commit())
+	f.sync = f.file.Sync
+	require.Equal(t, size, fileSize())
+	require.False(t, f.Exist(example.HexToAddress("bb")))
+
+	// the record could not be indexed
+	b := f.NewWriteBatch().(*FileBatch)
+	require.NoError(t, b.UpdateAccount(newAccount("bb", 1, 0, nil)))
+	b.write(entryStorage, []byte{1}, []byte{1})
+	require.Error(t, b.Commit())
+	require.Equal(t, size, fileSize())
+	require.False(t, f.Exist(example.HexToAddress("bb")))
+
+	wb = f.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("cc", 1, 0, nil)))
+	require.NoError(t, wb.Commit())
+	require.NoError(t, f.Close())
+
+	f = openFile(t, path)
+	defer f.Close()
+	require.True(t, f.Exist(example.HexToAddress("aa")))
+	require.False(t, f.Exist(example.HexToAddress("bb")))
+	require.True(t, f.Exist(example.HexToAddress("cc")))
+}
+
+func TestFileHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evm.db")
+	f := openFile(t, path)
+	testHistory(t, f)
+	require.NoError(t, f.Close())
+
+	// the heights and rollbacks are replayed, and the pruning is not persisted
+	f = openFile(t, path)
+	defer f.Close()
+	require.EqualValues(t, 2, f.Height())
+	require.EqualValues(t, 200, f.GetAccount(example.HexToAddress("a1")).GetBalance())
+	checkAt(t, f, 1)
+	checkAt(t, f, 2)
+	require.NoError(t, f.RollbackTo(1))
+	checkAt(t, f, 1)
+	require.NoError(t, f.Close())
+	f = openFile(t, path)
+	require.EqualValues(t, 1, f.Height())
+	checkAt(t, f, 1)
+}
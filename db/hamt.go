@@ -0,0 +1,246 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package db
+
+import (
+	"hash/fnv"
+	"math/bits"
+)
+
+// hamt is a persistent hash array mapped trie keyed by string. It is never
+// modified in place: set and delete return a new hamt which shares all the
+// nodes but the path to the key with the old one, so they cost O(log n) and
+// the old hamt could still be read by other goroutines.
+type hamt struct {
+	root *hamtNode
+	size int
+}
+
+// hamtNode has a child or a leaf for every bit set in bitmap, which is
+// indexed by 5 bits of the key hash at its depth. The node below the last
+// bits of hash keeps the leaves whose hashes collide, and its bitmap is unused.
+type hamtNode struct {
+	bitmap  uint32
+	entries []hamtEntry
+}
+
+// hamtEntry is a child node if node is not nil, or a leaf, which keeps the
+// hash of its key so it could be pushed down without hashing again
+type hamtEntry struct {
+	node  *hamtNode
+	hash  uint64
+	key   string
+	value interface{}
+}
+
+const hamtBits = 5
+
+func hamtHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// Len return the count of keys
+func (m hamt) Len() int {
+	return m.size
+}
+
+// Get return the value of key and if it exists
+func (m hamt) Get(key string) (interface{}, bool) {
+	hash := hamtHash(key)
+	node := m.root
+	for shift := uint(0); node != nil; shift += hamtBits {
+		if shift >= 64 {
+			for _, e := range node.entries {
+				if e.key == key {
+					return e.value, true
+				}
+			}
+			return nil, false
+		}
+		bit := uint32(1) << ((hash >> shift) & 31)
+		if node.bitmap&bit == 0 {
+			return nil, false
+		}
+		e := node.entries[bits.OnesCount32(node.bitmap&(bit-1))]
+		if e.node == nil {
+			if e.key == key {
+				return e.value, true
+			}
+			return nil, false
+		}
+		node = e.node
+	}
+	return nil, false
+}
+
+// Set return a hamt in which key is set to value
+func (m hamt) Set(key string, value interface{}) hamt {
+	root, added := m.root.set(hamtHash(key), 0, key, value)
+	if added {
+		m.size++
+	}
+	m.root = root
+	return m
+}
+
+// Delete return a hamt without key
+func (m hamt) Delete(key string) hamt {
+	root, deleted := m.root.delete(hamtHash(key), 0, key)
+	if deleted {
+		m.size--
+		m.root = root
+	}
+	return m
+}
+
+// Range call fn on every key and value until it returns false
+func (m hamt) Range(fn func(key string, value interface{}) bool) {
+	m.root.walk(fn)
+}
+
+// set return a copy of node with key set, and if the key is added
+func (node *hamtNode) set(hash uint64, shift uint, key string, value interface{}) (*hamtNode, bool) {
+	if node == nil {
+		node = &hamtNode{}
+	}
+	if shift >= 64 {
+		for i, e := range node.entries {
+			if e.key == key {
+				n := node.clone()
+				n.entries[i].value = value
+				return n, false
+			}
+		}
+		n := node.clone()
+		n.entries = append(n.entries, hamtEntry{hash: hash, key: key, value: value})
+		return n, true
+	}
+	bit := uint32(1) << ((hash >> shift) & 31)
+	pos := bits.OnesCount32(node.bitmap & (bit - 1))
+	if node.bitmap&bit == 0 {
+		n := &hamtNode{
+			bitmap:  node.bitmap | bit,
+			entries: make([]hamtEntry, len(node.entries)+1),
+		}
+		copy(n.entries, node.entries[:pos])
+		n.entries[pos] = hamtEntry{hash: hash, key: key, value: value}
+		copy(n.entries[pos+1:], node.entries[pos:])
+		return n, true
+	}
+	e := node.entries[pos]
+	n := node.clone()
+	switch {
+	case e.node != nil:
+		child, added := e.node.set(hash, shift+hamtBits, key, value)
+		n.entries[pos] = hamtEntry{node: child}
+		return n, added
+	case e.key == key:
+		n.entries[pos].value = value
+		return n, false
+	default:
+		// push the existing leaf down and set the key beside it
+		child, _ := (*hamtNode)(nil).set(e.hash, shift+hamtBits, e.key, e.value)
+		child, _ = child.set(hash, shift+hamtBits, key, value)
+		n.entries[pos] = hamtEntry{node: child}
+		return n, true
+	}
+}
+
+// delete return a copy of node without key, which is nil if it is empty, and
+// if the key is deleted
+func (node *hamtNode) delete(hash uint64, shift uint, key string) (*hamtNode, bool) {
+	if node == nil {
+		return nil, false
+	}
+	if shift >= 64 {
+		for i, e := range node.entries {
+			if e.key == key {
+				return node.without(i, 0), true
+			}
+		}
+		return node, false
+	}
+	bit := uint32(1) << ((hash >> shift) & 31)
+	if node.bitmap&bit == 0 {
+		return node, false
+	}
+	pos := bits.OnesCount32(node.bitmap & (bit - 1))
+	e := node.entries[pos]
+	if e.node == nil {
+		if e.key != key {
+			return node, false
+		}
+		return node.without(pos, bit), true
+	}
+	child, deleted := e.node.delete(hash, shift+hamtBits, key)
+	if !deleted {
+		return node, false
+	}
+	if child == nil {
+		return node.without(pos, bit), true
+	}
+	n := node.clone()
+	if len(child.entries) == 1 && child.entries[0].node == nil {
+		// pull a single leaf up, so the trie keeps shallow
+		n.entries[pos] = child.entries[0]
+	} else {
+		n.entries[pos] = hamtEntry{node: child}
+	}
+	return n, true
+}
+
+// without return a copy of node without the entry at pos, which is nil if it is empty
+func (node *hamtNode) without(pos int, bit uint32) *hamtNode {
+	if len(node.entries) == 1 {
+		return nil
+	}
+	n := &hamtNode{
+		bitmap:  node.bitmap &^ bit,
+		entries: make([]hamtEntry, 0, len(node.entries)-1),
+	}
+	n.entries = append(n.entries, node.entries[:pos]...)
+	n.entries = append(n.entries, node.entries[pos+1:]...)
+	return n
+}
+
+func (node *hamtNode) clone() *hamtNode {
+	n := &hamtNode{
+		bitmap:  node.bitmap,
+		entries: make([]hamtEntry, len(node.entries)),
+	}
+	copy(n.entries, node.entries)
+	return n
+}
+
+func (node *hamtNode) walk(fn func(key string, value interface{}) bool) bool {
+	if node == nil {
+		return true
+	}
+	for _, e := range node.entries {
+		if e.node != nil {
+			if !e.node.walk(fn) {
+				return false
+			}
+		} else if !fn(e.key, e.value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHamt(t *testing.T) {
+	var (
+		m        hamt
+		expected = make(map[string]int)
+		versions []hamt
+		maps     []map[string]int
+	)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprint(r.Intn(2000))
+		if r.Intn(3) == 0 {
+			m = m.Delete(key)
+			delete(expected, key)
+		} else {
+			m = m.Set(key, i)
+			expected[key] = i
+		}
+		if i%1000 == 0 {
+			copied := make(map[string]int, len(expected))
+			for k, v := range expected {
+				copied[k] = v
+			}
+			versions = append(versions, m)
+			maps = append(maps, copied)
+		}
+	}
+	versions = append(versions, m)
+	maps = append(maps, expected)
+	// every version keeps its own keys however the later ones change
+	for i, version := range versions {
+		require.Equal(t, len(maps[i]), version.Len())
+		var walked = make(map[string]int)
+		version.Range(func(key string, value interface{}) bool {
+			walked[key] = value.(int)
+			return true
+		})
+		require.Equal(t, maps[i], walked)
+		for j := 0; j < 2000; j++ {
+			key := fmt.Sprint(j)
+			value, ok := version.Get(key)
+			expectedValue, expectedOk := maps[i][key]
+			require.Equal(t, expectedOk, ok, key)
+			if ok {
+				require.Equal(t, expectedValue, value, key)
+			}
+		}
+	}
+}
+
+func TestHamtCollision(t *testing.T) {
+	// the keys share the same hash, so they are kept below the last bits of hash
+	var node *hamtNode
+	for i := 0; i < 3; i++ {
+		var added bool
+		node, added = node.set(42, 0, fmt.Sprint(i), i)
+		require.True(t, added)
+	}
+	m := hamt{root: node, size: 3}
+	node, added := node.set(42, 0, "1", 10)
+	require.False(t, added)
+	node, deleted := node.delete(42, 0, "0")
+	require.True(t, deleted)
+	_, deleted = node.delete(42, 0, "0")
+	require.False(t, deleted)
+	var walked = make(map[string]interface{})
+	hamt{root: node}.Range(func(key string, value interface{}) bool {
+		walked[key] = value
+		return true
+	})
+	require.Equal(t, map[string]interface{}{"1": 10, "2": 2}, walked)
+	// the old version is not changed
+	walked = make(map[string]interface{})
+	m.Range(func(key string, value interface{}) bool {
+		walked[key] = value
+		return true
+	})
+	require.Equal(t, map[string]interface{}{"0": 0, "1": 1, "2": 2}, walked)
+	node, _ = node.delete(42, 0, "1")
+	node, _ = node.delete(42, 0, "2")
+	require.Nil(t, node)
+}
@@ -0,0 +1,112 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thu-arxan/evm"
+)
+
+var (
+	// ErrReadOnly is returned by committing a write batch of a view at height
+	ErrReadOnly = errors.New("write to a read-only view")
+	// ErrPruned is returned if the state at height is pruned
+	ErrPruned = errors.New("height is pruned")
+)
+
+// history tracks the heights of a versioned db. The writes are recorded in
+// the version of current height, which keeps the values before the block, and
+// the state at an older height is read by undoing the versions above it.
+// The versions not higher than base are pruned, so base is the lowest height
+// could be read or rolled back to.
+type history struct {
+	height uint64
+	base   uint64
+	// pruning is the count of blocks whose versions are kept, and 0 means all
+	pruning uint64
+}
+
+// recording return if the writes of current height should be recorded
+func (h *history) recording() bool {
+	return h.height > h.base
+}
+
+// checkHeight check if the height could be set as current height
+func (h *history) checkHeight(height uint64) error {
+	if height < h.height {
+		return fmt.Errorf("height %d is lower than current height %d", height, h.height)
+	}
+	return nil
+}
+
+// check check if the state at height could be read or rolled back to
+func (h *history) check(height uint64) error {
+	if height > h.height {
+		return fmt.Errorf("height %d is higher than current height %d", height, h.height)
+	}
+	if height < h.base {
+		return fmt.Errorf("%w: %d is lower than %d", ErrPruned, height, h.base)
+	}
+	return nil
+}
+
+// prune raise base if the versions older than pruning blocks should be
+// dropped, and return if base is changed
+func (h *history) prune() bool {
+	if h.pruning == 0 || h.height <= h.pruning || h.height-h.pruning <= h.base {
+		return false
+	}
+	h.base = h.height - h.pruning
+	return true
+}
+
+// readOnlyBatch is the write batch of a view or snapshot, which could be
+// committed only if nothing is written, so a read-only call could run on it
+type readOnlyBatch struct {
+	written bool
+}
+
+func (b *readOnlyBatch) SetStorage(address evm.Address, key []byte, value []byte) {
+	b.written = true
+}
+
+func (b *readOnlyBatch) UpdateAccount(account evm.Account) error {
+	b.written = true
+	return ErrReadOnly
+}
+
+func (b *readOnlyBatch) DeleteAccount(address evm.Address) {
+	b.written = true
+}
+
+func (b *readOnlyBatch) AddLog(log *evm.Log) {
+	b.written = true
+}
+
+func (b *readOnlyBatch) Commit() error {
+	if b.written {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+func (b *readOnlyBatch) Discard() {
+	b.written = false
+}
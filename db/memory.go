@@ -19,29 +19,44 @@ package db
 
 import (
 	"errors"
+	"sort"
+
 	"github.com/thu-arxan/evm"
 	"github.com/thu-arxan/evm/util"
 )
 
-// Memory is a memory db
+// Memory is a memory db, which keeps the versions of recent blocks, so the
+// state at an older height could be read by At and rolled back by RollbackTo.
+// The writes belong to height 0 until SetHeight is called.
 type Memory struct {
-	accounts map[string]*accountInfo
-	storages map[string][]byte
+	accounts map[string]evm.Account
+	// storages is keyed by address and then storage key, so the storages
+	// of an account could be deleted with the account
+	storages map[string]map[string][]byte
 	logs     []*evm.Log
 
+	history
+	// versions is sorted by height
+	versions []*memoryVersion
+
 	accountFunc func(address evm.Address) evm.Account
 }
 
-type accountInfo struct {
-	account evm.Account
-	removed bool
+// memoryVersion is the values before the writes of a block, and nil means
+// the account or storage is not exist
+type memoryVersion struct {
+	height   uint64
+	accounts map[string]evm.Account
+	storages map[string]map[string][]byte
+	// logs is the count of logs before the block
+	logs int
 }
 
 // NewMemory is the constructor of Memory
 func NewMemory(accountFunc func(address evm.Address) evm.Account) *Memory {
 	return &Memory{
-		accounts:    make(map[string]*accountInfo),
-		storages:    make(map[string][]byte),
+		accounts:    make(map[string]evm.Account),
+		storages:    make(map[string]map[string][]byte),
 		logs:        make([]*evm.Log, 0),
 		accountFunc: accountFunc,
 	}
@@ -55,67 +70,60 @@ func (m *Memory) InitBalance(address evm.Address, balance uint64) error {
 	}
 	account := m.accountFunc(address)
 	account.AddBalance(balance)
-	m.accounts[key] = &accountInfo{
-		account: account,
-	}
+	m.setAccount(key, account)
 	return nil
 }
 
 // Exist is the implementation of interface
 func (m *Memory) Exist(address evm.Address) bool {
-	key := string(address.Bytes())
-	return util.Contain(m.accounts, key)
+	return m.accountAt(string(address.Bytes()), m.height) != nil
 }
 
-// GetAccount is the implementation of interface
+// GetAccount is the implementation of interface, and the default account is
+// not stored until it is updated, so reading does not change the state
+// Note: The account should not be modified in place, because it is kept by the versions as well.
 func (m *Memory) GetAccount(address evm.Address) evm.Account {
-	key := string(address.Bytes())
-	if account, ok := m.accounts[key]; ok {
-		return account.account
+	if account := m.accountAt(string(address.Bytes()), m.height); account != nil {
+		return account
 	}
-	account := m.accountFunc(address)
-	m.accounts[key] = &accountInfo{
-		account: account,
-	}
-	return account
+	return m.accountFunc(address)
 }
 
 // GetStorage is the implementation of interface
 func (m *Memory) GetStorage(address evm.Address, key []byte) []byte {
-	storageKey := string(util.BytesCombine(address.Bytes(), key))
-	if value, ok := m.storages[storageKey]; ok {
-		return value
-	}
-	return nil
+	return m.storageAt(string(address.Bytes()), string(key), m.height)
 }
 
-// NewWriteBatch is the implementation of interface
+// NewWriteBatch is the implementation of interface, and the writes are
+// applied only if the batch is committed
 func (m *Memory) NewWriteBatch() evm.WriteBatch {
-	return m
+	return &MemoryBatch{
+		m:        m,
+		accounts: make(map[string]evm.Account),
+		storages: make(map[string]map[string][]byte),
+		deleted:  make(map[string]bool),
+	}
 }
 
-// SetStorage is the implementation of interface
+// SetStorage set storage directly without a batch
 func (m *Memory) SetStorage(address evm.Address, key, value []byte) {
-	storageKey := string(util.BytesCombine(address.Bytes(), key))
-	m.storages[storageKey] = value
+	m.setStorage(string(address.Bytes()), string(key), value)
 }
 
-// UpdateAccount is the implementation of interface
+// UpdateAccount update account directly without a batch
 func (m *Memory) UpdateAccount(account evm.Account) error {
-	key := string(account.GetAddress().Bytes())
-	if util.Contain(m.accounts, key) {
-		if m.accounts[key].removed {
-			return errors.New("can not update on removed account")
-		}
-	}
-	m.accounts[key] = &accountInfo{
-		account: account,
-	}
+	m.setAccount(string(account.GetAddress().Bytes()), account)
 	return nil
 }
 
-// AddLog is the implementation of interface
+// DeleteAccount delete account and its storages directly without a batch
+func (m *Memory) DeleteAccount(address evm.Address) {
+	m.deleteAccount(string(address.Bytes()))
+}
+
+// AddLog add log directly without a batch
 func (m *Memory) AddLog(log *evm.Log) {
+	m.version()
 	// Note: We should set some infos like txIndex, blockHash and etc.
 	// We just set index as example.
 	log.Index = uint(len(m.logs))
@@ -126,3 +134,353 @@ func (m *Memory) AddLog(log *evm.Log) {
 func (m *Memory) GetLog() []*evm.Log {
 	return m.logs
 }
+
+// Accounts return the accounts which are not suicided, and they are sorted by address
+func (m *Memory) Accounts() []evm.Account {
+	return m.accountsAt(m.height)
+}
+
+// Storages return the storages of an account, which are keyed by the string of storage key
+func (m *Memory) Storages(address evm.Address) map[string][]byte {
+	return m.storagesAt(string(address.Bytes()), m.height)
+}
+
+// Height return the current height
+func (m *Memory) Height() uint64 {
+	return m.height
+}
+
+// SetHeight set the current height, and the writes after it belong to the
+// block at height. The height should not be lower than current height.
+func (m *Memory) SetHeight(height uint64) error {
+	if err := m.checkHeight(height); err != nil {
+		return err
+	}
+	m.height = height
+	m.prune()
+	return nil
+}
+
+// SetPruning keep the versions of latest blocks only, so the state older than
+// blocks before current height could not be read or rolled back to, and 0
+// means all versions are kept, which is the default.
+func (m *Memory) SetPruning(blocks uint64) {
+	m.pruning = blocks
+	m.prune()
+}
+
+// At return a read-only view of the state at height, which is valid until the
+// height is pruned or rolled back. The view at current height sees the later
+// writes of current block.
+func (m *Memory) At(height uint64) (evm.DB, error) {
+	if err := m.check(height); err != nil {
+		return nil, err
+	}
+	return &memoryView{m: m, height: height}, nil
+}
+
+// RollbackTo undo the writes of blocks higher than height, and height becomes
+// the current height
+func (m *Memory) RollbackTo(height uint64) error {
+	if err := m.check(height); err != nil {
+		return err
+	}
+	for len(m.versions) > 0 {
+		v := m.versions[len(m.versions)-1]
+		if v.height <= height {
+			break
+		}
+		for addr, account := range v.accounts {
+			if account == nil {
+				delete(m.accounts, addr)
+			} else {
+				m.accounts[addr] = account
+			}
+		}
+		for addr, storages := range v.storages {
+			for key, value := range storages {
+				m.restoreStorage(addr, key, value)
+			}
+		}
+		m.logs = m.logs[:v.logs]
+		m.versions = m.versions[:len(m.versions)-1]
+	}
+	m.height = height
+	return nil
+}
+
+// prune drop the versions which are not higher than base
+func (m *Memory) prune() {
+	if !m.history.prune() {
+		return
+	}
+	var i = 0
+	for i < len(m.versions) && m.versions[i].height <= m.base {
+		i++
+	}
+	m.versions = m.versions[i:]
+}
+
+// version return the version of current height, or nil if it is not recorded
+func (m *Memory) version() *memoryVersion {
+	if !m.recording() {
+		return nil
+	}
+	if len(m.versions) > 0 && m.versions[len(m.versions)-1].height == m.height {
+		return m.versions[len(m.versions)-1]
+	}
+	v := &memoryVersion{
+		height:   m.height,
+		accounts: make(map[string]evm.Account),
+		storages: make(map[string]map[string][]byte),
+		logs:     len(m.logs),
+	}
+	m.versions = append(m.versions, v)
+	return v
+}
+
+func (m *Memory) setAccount(addr string, account evm.Account) {
+	if v := m.version(); v != nil {
+		if _, ok := v.accounts[addr]; !ok {
+			v.accounts[addr] = m.accounts[addr]
+		}
+	}
+	m.accounts[addr] = account
+}
+
+func (m *Memory) setStorage(addr, key string, value []byte) {
+	if v := m.version(); v != nil {
+		v.recordStorage(addr, key, m.storages[addr][key])
+	}
+	if _, ok := m.storages[addr]; !ok {
+		m.storages[addr] = make(map[string][]byte)
+	}
+	m.storages[addr][key] = value
+}
+
+func (m *Memory) deleteAccount(addr string) {
+	if v := m.version(); v != nil {
+		if _, ok := v.accounts[addr]; !ok {
+			v.accounts[addr] = m.accounts[addr]
+		}
+		for key, value := range m.storages[addr] {
+			v.recordStorage(addr, key, value)
+		}
+	}
+	delete(m.accounts, addr)
+	delete(m.storages, addr)
+}
+
+// restoreStorage set the storage to value, and nil means deleting it
+func (m *Memory) restoreStorage(addr, key string, value []byte) {
+	if value != nil {
+		if _, ok := m.storages[addr]; !ok {
+			m.storages[addr] = make(map[string][]byte)
+		}
+		m.storages[addr][key] = value
+		return
+	}
+	delete(m.storages[addr], key)
+	if len(m.storages[addr]) == 0 {
+		delete(m.storages, addr)
+	}
+}
+
+func (v *memoryVersion) recordStorage(addr, key string, value []byte) {
+	if _, ok := v.storages[addr]; !ok {
+		v.storages[addr] = make(map[string][]byte)
+	}
+	if _, ok := v.storages[addr][key]; !ok {
+		v.storages[addr][key] = value
+	}
+}
+
+// above return the versions higher than height
+func (m *Memory) above(height uint64) []*memoryVersion {
+	var i = len(m.versions)
+	for i > 0 && m.versions[i-1].height > height {
+		i--
+	}
+	return m.versions[i:]
+}
+
+// accountAt return the account at height, or nil if it is not exist.
+// The value is kept by the lowest version above height which records it.
+func (m *Memory) accountAt(addr string, height uint64) evm.Account {
+	for _, v := range m.above(height) {
+		if account, ok := v.accounts[addr]; ok {
+			return account
+		}
+	}
+	return m.accounts[addr]
+}
+
+func (m *Memory) storageAt(addr, key string, height uint64) []byte {
+	for _, v := range m.above(height) {
+		if value, ok := v.storages[addr][key]; ok {
+			return value
+		}
+	}
+	return m.storages[addr][key]
+}
+
+func (m *Memory) accountsAt(height uint64) []evm.Account {
+	var accounts = make(map[string]evm.Account, len(m.accounts))
+	for key, account := range m.accounts {
+		accounts[key] = account
+	}
+	var versions = m.above(height)
+	for i := len(versions) - 1; i >= 0; i-- {
+		for key, account := range versions[i].accounts {
+			accounts[key] = account
+		}
+	}
+	var keys = make([]string, 0, len(accounts))
+	for key, account := range accounts {
+		if account != nil && !account.HasSuicide() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var result = make([]evm.Account, len(keys))
+	for i, key := range keys {
+		result[i] = accounts[key]
+	}
+	return result
+}
+
+func (m *Memory) storagesAt(addr string, height uint64) map[string][]byte {
+	var storages = make(map[string][]byte)
+	for key, value := range m.storages[addr] {
+		storages[key] = value
+	}
+	var versions = m.above(height)
+	for i := len(versions) - 1; i >= 0; i-- {
+		for key, value := range versions[i].storages[addr] {
+			if value == nil {
+				delete(storages, key)
+			} else {
+				storages[key] = value
+			}
+		}
+	}
+	return storages
+}
+
+func (m *Memory) logsAt(height uint64) []*evm.Log {
+	if versions := m.above(height); len(versions) > 0 {
+		return m.logs[:versions[0].logs]
+	}
+	return m.logs
+}
+
+// memoryView is the read-only state of Memory at height
+type memoryView struct {
+	m      *Memory
+	height uint64
+}
+
+// Exist is the implementation of interface
+func (v *memoryView) Exist(address evm.Address) bool {
+	return v.m.accountAt(string(address.Bytes()), v.height) != nil
+}
+
+// GetAccount is the implementation of interface, and the account should not be modified
+func (v *memoryView) GetAccount(address evm.Address) evm.Account {
+	if account := v.m.accountAt(string(address.Bytes()), v.height); account != nil {
+		return account
+	}
+	return v.m.accountFunc(address)
+}
+
+// GetStorage is the implementation of interface
+func (v *memoryView) GetStorage(address evm.Address, key []byte) []byte {
+	return v.m.storageAt(string(address.Bytes()), string(key), v.height)
+}
+
+// NewWriteBatch is the implementation of interface, and the batch could not be committed if anything is written
+func (v *memoryView) NewWriteBatch() evm.WriteBatch {
+	return &readOnlyBatch{}
+}
+
+// GetLog return the logs at height
+func (v *memoryView) GetLog() []*evm.Log {
+	return v.m.logsAt(v.height)
+}
+
+// Accounts return the accounts at height
+func (v *memoryView) Accounts() []evm.Account {
+	return v.m.accountsAt(v.height)
+}
+
+// Storages return the storages of an account at height
+func (v *memoryView) Storages(address evm.Address) map[string][]byte {
+	return v.m.storagesAt(string(address.Bytes()), v.height)
+}
+
+// MemoryBatch is the write batch of Memory, which is buffered until Commit
+type MemoryBatch struct {
+	m        *Memory
+	accounts map[string]evm.Account
+	storages map[string]map[string][]byte
+	// deleted is the accounts deleted before the buffered writes
+	deleted map[string]bool
+	logs    []*evm.Log
+}
+
+// SetStorage is the implementation of interface
+func (b *MemoryBatch) SetStorage(address evm.Address, key, value []byte) {
+	addr := string(address.Bytes())
+	if _, ok := b.storages[addr]; !ok {
+		b.storages[addr] = make(map[string][]byte)
+	}
+	b.storages[addr][string(key)] = value
+}
+
+// UpdateAccount is the implementation of interface
+func (b *MemoryBatch) UpdateAccount(account evm.Account) error {
+	b.accounts[string(account.GetAddress().Bytes())] = account
+	return nil
+}
+
+// DeleteAccount is the implementation of interface, and the writes of the
+// account before it in the batch are dropped
+func (b *MemoryBatch) DeleteAccount(address evm.Address) {
+	addr := string(address.Bytes())
+	delete(b.accounts, addr)
+	delete(b.storages, addr)
+	b.deleted[addr] = true
+}
+
+// AddLog is the implementation of interface
+func (b *MemoryBatch) AddLog(log *evm.Log) {
+	b.logs = append(b.logs, log)
+}
+
+// Commit is the implementation of interface, the batch should not be used after Commit
+func (b *MemoryBatch) Commit() error {
+	for addr := range b.deleted {
+		b.m.deleteAccount(addr)
+	}
+	for addr, account := range b.accounts {
+		b.m.setAccount(addr, account)
+	}
+	for addr, storages := range b.storages {
+		for key, value := range storages {
+			b.m.setStorage(addr, key, value)
+		}
+	}
+	for _, log := range b.logs {
+		b.m.AddLog(log)
+	}
+	b.Discard()
+	return nil
+}
+
+// Discard is the implementation of interface
+func (b *MemoryBatch) Discard() {
+	b.accounts = make(map[string]evm.Account)
+	b.storages = make(map[string]map[string][]byte)
+	b.deleted = make(map[string]bool)
+	b.logs = nil
+}
@@ -0,0 +1,210 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package db
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/example"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBatch(t *testing.T) {
+	m := NewMemory(example.NewBlockchain().NewAccount)
+	alice := example.HexToAddress("a1")
+
+	wb := m.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 100, 1, nil)))
+	wb.SetStorage(alice, []byte{1}, []byte{1})
+	wb.AddLog(&evm.Log{Address: alice})
+	// the writes are not applied before commit
+	require.False(t, m.Exist(alice))
+	require.Nil(t, m.GetStorage(alice, []byte{1}))
+	require.Empty(t, m.GetLog())
+	require.NoError(t, wb.Commit())
+	require.EqualValues(t, 100, m.GetAccount(alice).GetBalance())
+	require.Equal(t, []byte{1}, m.GetStorage(alice, []byte{1}))
+	require.Len(t, m.GetLog(), 1)
+
+	// the discarded writes are never applied
+	wb = m.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 50, 2, nil)))
+	wb.SetStorage(alice, []byte{1}, []byte{2})
+	wb.AddLog(&evm.Log{Address: alice})
+	wb.Discard()
+	require.NoError(t, wb.Commit())
+	require.EqualValues(t, 100, m.GetAccount(alice).GetBalance())
+	require.Equal(t, []byte{1}, m.GetStorage(alice, []byte{1}))
+	require.Len(t, m.GetLog(), 1)
+}
+
+func TestMemoryDeleteAccount(t *testing.T) {
+	m := NewMemory(example.NewBlockchain().NewAccount)
+	alice, bob := example.HexToAddress("a1"), example.HexToAddress("b0")
+	wb := m.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 100, 1, nil)))
+	require.NoError(t, wb.UpdateAccount(newAccount("b0", 100, 1, nil)))
+	wb.SetStorage(alice, []byte{1}, []byte{1})
+	wb.SetStorage(alice, []byte{2}, []byte{2})
+	wb.SetStorage(bob, []byte{1}, []byte{1})
+	require.NoError(t, wb.Commit())
+
+	// the storages are deleted with the account, and the writes before deleting are dropped
+	wb = m.NewWriteBatch()
+	wb.SetStorage(alice, []byte{3}, []byte{3})
+	wb.DeleteAccount(alice)
+	require.True(t, m.Exist(alice))
+	require.NoError(t, wb.Commit())
+	require.False(t, m.Exist(alice))
+	require.Nil(t, m.GetStorage(alice, []byte{1}))
+	require.Nil(t, m.GetStorage(alice, []byte{3}))
+	require.Empty(t, m.Storages(alice))
+	require.Equal(t, []byte{1}, m.GetStorage(bob, []byte{1}))
+
+	// the account could be created again
+	wb = m.NewWriteBatch()
+	wb.DeleteAccount(bob)
+	require.NoError(t, wb.UpdateAccount(newAccount("b0", 10, 0, nil)))
+	wb.SetStorage(bob, []byte{2}, []byte{2})
+	require.NoError(t, wb.Commit())
+	require.EqualValues(t, 10, m.GetAccount(bob).GetBalance())
+	require.Equal(t, map[string][]byte{"\x02": {2}}, m.Storages(bob))
+}
+
+// versioned is the db keeps the versions of blocks, such as Memory and File
+type versioned interface {
+	evm.DB
+	GetLog() []*evm.Log
+	Height() uint64
+	SetHeight(height uint64) error
+	SetPruning(blocks uint64)
+	At(height uint64) (evm.DB, error)
+	RollbackTo(height uint64) error
+}
+
+// writeBlocks write the blocks 1 to 3, in which the balance of a1 is 100 * height,
+// the storage 1 of a1 is height, and b0 is created at height 2 and deleted at height 3
+func writeBlocks(t *testing.T, db versioned) {
+	alice, bob := example.HexToAddress("a1"), example.HexToAddress("b0")
+	for height := uint64(1); height <= 3; height++ {
+		require.NoError(t, db.SetHeight(height))
+		wb := db.NewWriteBatch()
+		require.NoError(t, wb.UpdateAccount(newAccount("a1", 100*height, height, nil)))
+		wb.SetStorage(alice, []byte{1}, []byte{byte(height)})
+		switch height {
+		case 2:
+			require.NoError(t, wb.UpdateAccount(newAccount("b0", 10, 0, nil)))
+			wb.SetStorage(bob, []byte{1}, []byte{1})
+		case 3:
+			wb.DeleteAccount(bob)
+		}
+		wb.AddLog(&evm.Log{Address: alice})
+		require.NoError(t, wb.Commit())
+	}
+}
+
+// checkAt check the state at height which is written by writeBlocks
+func checkAt(t *testing.T, db versioned, height uint64) {
+	alice, bob := example.HexToAddress("a1"), example.HexToAddress("b0")
+	view, err := db.At(height)
+	require.NoError(t, err)
+	require.EqualValues(t, 100*height, view.GetAccount(alice).GetBalance())
+	require.Equal(t, []byte{byte(height)}, view.GetStorage(alice, []byte{1}))
+	require.Equal(t, height == 2, view.Exist(bob))
+	if height == 2 {
+		require.Equal(t, []byte{1}, view.GetStorage(bob, []byte{1}))
+	} else {
+		require.Nil(t, view.GetStorage(bob, []byte{1}))
+	}
+	require.Len(t, view.(interface{ GetLog() []*evm.Log }).GetLog(), int(height))
+	require.Len(t, view.(interface{ Accounts() []evm.Account }).Accounts(), map[uint64]int{1: 1, 2: 2, 3: 1}[height])
+	// the view is read-only
+	wb := view.NewWriteBatch()
+	require.True(t, errors.Is(wb.UpdateAccount(newAccount("a1", 1, 1, nil)), ErrReadOnly))
+	require.True(t, errors.Is(wb.Commit(), ErrReadOnly))
+}
+
+func testHistory(t *testing.T, db versioned) {
+	alice, bob := example.HexToAddress("a1"), example.HexToAddress("b0")
+	writeBlocks(t, db)
+	require.EqualValues(t, 3, db.Height())
+	for height := uint64(1); height <= 3; height++ {
+		checkAt(t, db, height)
+	}
+	// the state before height 1
+	view, err := db.At(0)
+	require.NoError(t, err)
+	require.False(t, view.Exist(alice))
+	_, err = db.At(4)
+	require.Error(t, err)
+	require.Error(t, db.SetHeight(2))
+
+	// rollback to height 2, and the blocks could be written again
+	require.NoError(t, db.RollbackTo(2))
+	require.EqualValues(t, 2, db.Height())
+	checkAt(t, db, 2)
+	require.EqualValues(t, 200, db.GetAccount(alice).GetBalance())
+	require.True(t, db.Exist(bob))
+	require.Len(t, db.GetLog(), 2)
+	require.NoError(t, db.SetHeight(3))
+	wb := db.NewWriteBatch()
+	require.NoError(t, wb.UpdateAccount(newAccount("a1", 1000, 3, nil)))
+	require.NoError(t, wb.Commit())
+	require.EqualValues(t, 1000, db.GetAccount(alice).GetBalance())
+	checkAt(t, db, 2)
+
+	// the versions older than 2 blocks are pruned
+	require.NoError(t, db.SetHeight(4))
+	db.SetPruning(2)
+	_, err = db.At(1)
+	require.True(t, errors.Is(err, ErrPruned))
+	require.True(t, errors.Is(db.RollbackTo(1), ErrPruned))
+	checkAt(t, db, 2)
+	require.NoError(t, db.RollbackTo(2))
+	checkAt(t, db, 2)
+	require.EqualValues(t, 200, db.GetAccount(alice).GetBalance())
+}
+
+func TestMemoryHistory(t *testing.T) {
+	testHistory(t, NewMemory(example.NewBlockchain().NewAccount))
+
+	// nothing is recorded if height is not set
+	m := NewMemory(example.NewBlockchain().NewAccount)
+	require.NoError(t, m.InitBalance(example.HexToAddress("a1"), 100))
+	require.Empty(t, m.versions)
+	view, err := m.At(0)
+	require.NoError(t, err)
+	require.EqualValues(t, 100, view.GetAccount(example.HexToAddress("a1")).GetBalance())
+}
+
+// TestMemoryGetAccountNotStored checks that reading an account which is not
+// exist returns the default account without storing it
+func TestMemoryGetAccountNotStored(t *testing.T) {
+	m := NewMemory(example.NewBlockchain().NewAccount)
+	alice := example.HexToAddress("a1")
+	account := m.GetAccount(alice)
+	require.NotNil(t, account)
+	require.Equal(t, alice.Bytes(), account.GetAddress().Bytes())
+	require.False(t, m.Exist(alice))
+	require.Empty(t, m.Accounts())
+
+	require.NoError(t, m.UpdateAccount(account))
+	require.True(t, m.Exist(alice))
+}
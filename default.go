@@ -19,6 +19,7 @@ package evm
 
 import (
 	"github.com/thu-arxan/evm/crypto"
+	"github.com/thu-arxan/evm/errors"
 	"github.com/thu-arxan/evm/rlp"
 )
 
@@ -35,3 +36,76 @@ func defaultCreate2Address(caller Address, salt, code []byte, toAddressFunc func
 	bytes := crypto.Keccak256([]byte{0xff}, caller.Bytes(), salt[:], crypto.Keccak256(code))[12:]
 	return toAddressFunc(bytes)
 }
+
+// defaultAccount is the default account of Cache if a db fails to load an
+// account and no accountFunc is given, it is only used before the execution
+// is aborted by the failure
+type defaultAccount struct {
+	address  Address
+	balance  uint64
+	code     []byte
+	nonce    uint64
+	suicided bool
+}
+
+func newDefaultAccount(address Address) Account {
+	return &defaultAccount{address: address}
+}
+
+func (a *defaultAccount) GetAddress() Address {
+	return a.address
+}
+
+func (a *defaultAccount) GetBalance() uint64 {
+	return a.balance
+}
+
+func (a *defaultAccount) AddBalance(balance uint64) error {
+	a.balance += balance
+	return nil
+}
+
+func (a *defaultAccount) SubBalance(balance uint64) error {
+	if a.balance < balance {
+		return errors.InsufficientBalance
+	}
+	a.balance -= balance
+	return nil
+}
+
+func (a *defaultAccount) GetCode() []byte {
+	return a.code
+}
+
+func (a *defaultAccount) SetCode(code []byte) {
+	a.code = code
+}
+
+func (a *defaultAccount) GetCodeHash() []byte {
+	if len(a.code) == 0 {
+		return make([]byte, 32)
+	}
+	return crypto.Keccak256(a.code)
+}
+
+func (a *defaultAccount) GetNonce() uint64 {
+	return a.nonce
+}
+
+func (a *defaultAccount) SetNonce(nonce uint64) {
+	a.nonce = nonce
+}
+
+func (a *defaultAccount) Suicide() {
+	a.suicided = true
+}
+
+func (a *defaultAccount) HasSuicide() bool {
+	return a.suicided
+}
+
+func (a *defaultAccount) Copy() Account {
+	var c = *a
+	c.code = append([]byte(nil), a.code...)
+	return &c
+}
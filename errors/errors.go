@@ -50,3 +50,20 @@ func (m *Maybe) PushError(err error) {
 func (m *Maybe) Error() error {
 	return m.err
 }
+
+// DBError is the failure of db backend, such as an I/O error. It is not a
+// consensus error since the execution does not fail by itself, so the
+// transaction should be executed again rather than be treated as failed.
+type DBError struct {
+	Err error
+}
+
+// Error is the implementation of interface
+func (e *DBError) Error() string {
+	return "db error: " + e.Err.Error()
+}
+
+// Unwrap return the error of backend
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
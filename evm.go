@@ -78,21 +78,69 @@ type EVM struct {
 	stackDepth     uint64
 	refund         uint64
 	sync           bool
+	tracer         Tracer
+	precompiles    *precompile.Set
+	natives        map[string]NativeContract
+	// readOnly is set while the code called by STATICCALL is running
+	readOnly bool
+	// creating is set if the next frame runs init code, and it is only used by tracer
+	creating bool
 }
 
-// New is the constructor of EVM
+// New is the constructor of EVM, and the failure of db is reported if db implements FallibleDB
 func New(bc Blockchain, db DB, ctx *Context) *EVM {
+	if fallible, ok := db.(FallibleDB); ok {
+		return NewWithFallibleDB(bc, fallible, ctx)
+	}
+	return newEVM(bc, NewCache(db), ctx)
+}
+
+// NewWithFallibleDB is the constructor of EVM on a FallibleDB, and the execution
+// is aborted with an *errors.DBError once the db fails
+func NewWithFallibleDB(bc Blockchain, db FallibleDB, ctx *Context) *EVM {
+	return newEVM(bc, NewFallibleCache(db, bc.NewAccount), ctx)
+}
+
+func newEVM(bc Blockchain, cache *Cache, ctx *Context) *EVM {
 	return &EVM{
 		bc:             bc,
-		cache:          NewCache(db),
+		cache:          cache,
 		memoryProvider: DefaultDynamicMemoryProvider,
 		ctx:            ctx,
 		sync:           true,
+		precompiles:    precompile.DefaultSet(),
 	}
 }
 
+// SetPrecompiles set the precompile contracts of evm, and nil means no precompile contract
+func (evm *EVM) SetPrecompiles(set *precompile.Set) {
+	evm.precompiles = set
+}
+
+// SetEIP161 decides if the empty accounts touched by the execution, such as the
+// target of a call, are deleted when the cache is synced, as EIP-161 does. It is
+// disabled by default, because the code given by Call may run on an existing
+// empty account, which should not be deleted by the call.
+func (evm *EVM) SetEIP161(enable bool) {
+	evm.cache.deleteEmpty = enable
+}
+
+// Precompiles return the precompile contracts of evm, which could be modified
+// to add, replace or disable contracts
+func (evm *EVM) Precompiles() *precompile.Set {
+	return evm.precompiles
+}
+
 // Create create a contract account, and return an error if there exist a contract on the address
 func (evm *EVM) Create(caller Address) ([]byte, Address, error) {
+	code, address, err := evm.create(caller)
+	if err := evm.cache.Error(); err != nil {
+		return nil, nil, err
+	}
+	return code, address, err
+}
+
+func (evm *EVM) create(caller Address) ([]byte, Address, error) {
 	if evm.origin == nil {
 		evm.origin = caller
 	}
@@ -120,6 +168,7 @@ func (evm *EVM) Create(caller Address) ([]byte, Address, error) {
 	if err := evm.transfer(caller, address, evm.ctx.Value); err != nil {
 		return nil, nil, err
 	}
+	evm.creating = true
 	code, err := evm.callWithDepth(caller, address, evm.ctx.Input)
 	if err != nil {
 		return nil, nil, err
@@ -138,8 +187,10 @@ func (evm *EVM) Create(caller Address) ([]byte, Address, error) {
 		return nil, nil, err
 	}
 
-	if evm.sync {
-		evm.cache.Sync()
+	if evm.shouldSync() {
+		if err := evm.cache.Sync(); err != nil {
+			return nil, nil, err
+		}
 	}
 	return code, address, nil
 }
@@ -150,6 +201,9 @@ func (evm *EVM) Call(caller, callee Address, code []byte) ([]byte, error) {
 		evm.origin = caller
 	}
 	if err := evm.transfer(caller, callee, evm.ctx.Value); err != nil {
+		if dbErr := evm.cache.Error(); dbErr != nil {
+			return nil, dbErr
+		}
 		return nil, err
 	}
 
@@ -158,18 +212,34 @@ func (evm *EVM) Call(caller, callee Address, code []byte) ([]byte, error) {
 
 // CallWithoutTransfer is call without transfer, and it will sync change to db if error is nil
 func (evm *EVM) CallWithoutTransfer(caller, callee Address, code []byte) (output []byte, err error) {
+	return evm.callCode(caller, callee, callee, code)
+}
+
+// callCode runs code of codeAddress on the storage of callee, they differ in DELEGATECALL
+// and CALLCODE, and the precompile contract is looked up by codeAddress
+func (evm *EVM) callCode(caller, callee, codeAddress Address, code []byte) (output []byte, err error) {
 	if evm.origin == nil {
 		evm.origin = caller
 	}
-	if precompile.IsPrecompile(callee.Bytes()) {
-		contract, err := precompile.New(callee.Bytes())
+	// the failure of db aborts the execution whatever the result is
+	defer func() {
+		if dbErr := evm.cache.Error(); dbErr != nil {
+			output, err = nil, dbErr
+		}
+	}()
+	if contract, ok := evm.natives[addressToString(codeAddress)]; ok {
+		output, err = evm.runNative(contract, caller, callee, codeAddress)
 		if err != nil {
 			return nil, err
 		}
+	} else if contract, ok := evm.precompiles.Get(codeAddress.Bytes()); ok {
 		if err := useGasNegative(evm.ctx.Gas, contract.RequiredGas(evm.ctx.Input)); err != nil {
 			return nil, err
 		}
 		output, err = contract.Run(evm.ctx.Input)
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		output, err = evm.callWithDepth(caller, callee, code)
 		if err != nil {
@@ -178,12 +248,24 @@ func (evm *EVM) CallWithoutTransfer(caller, callee Address, code []byte) (output
 	}
 
 	// sync change to db if no error
-	if evm.sync {
-		evm.cache.Sync()
+	if evm.shouldSync() {
+		if err = evm.cache.Sync(); err != nil {
+			return nil, err
+		}
 	}
 	return
 }
 
+// shouldSync return true if the cache should be synced to db, the calls made
+// by CALL family opcodes are synced by the outermost call only, otherwise the
+// changes of a succeeded inner call would be kept even if the outer one fails.
+// The yellow paper reverts the state to the one before a failed frame, which
+// includes the changes of the frames it made, so nothing is final until the
+// outermost frame succeeds.
+func (evm *EVM) shouldSync() bool {
+	return evm.sync && evm.stackDepth == 0
+}
+
 // GetRefund return the refund
 func (evm *EVM) GetRefund() uint64 {
 	return evm.refund
@@ -199,6 +281,8 @@ func (evm *EVM) subRefund(gas uint64) {
 
 func (evm *EVM) transfer(caller, callee Address, value uint64) error {
 	if value == 0 {
+		// the target of a call is touched even if nothing is transferred
+		evm.cache.touch(callee)
 		return nil
 	}
 
@@ -233,11 +317,12 @@ func (evm *EVM) callWithDepth(caller, callee Address, code []byte) ([]byte, erro
 		evm.stackDepth--
 		return output, err
 	}
+	evm.creating = false
 	return nil, nil
 }
 
 // call does not transfer 'value' or modify the callDepth.
-func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
+func (evm *EVM) call(caller, callee Address, code []byte) (output []byte, err error) {
 	var maybe = errors.NewMaybe()
 	var ctx = evm.ctx
 	var pc uint64
@@ -246,7 +331,35 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 
 	var returnData []byte
 
+	// step is the opcode traced but not finished yet
+	var frame *Frame
+	var step *Step
+	var creating = evm.creating
+	evm.creating = false
+	if evm.tracer != nil {
+		frame = &Frame{
+			Caller: caller,
+			Callee: callee,
+			Code:   code,
+			Input:  ctx.Input,
+			Value:  ctx.Value,
+			Gas:    *ctx.Gas,
+			Depth:  int(evm.stackDepth),
+			Create: creating,
+		}
+		evm.tracer.CaptureEnter(frame)
+		defer func() {
+			if step != nil {
+				evm.captureStateEnd(step, *ctx.Gas, err)
+			}
+			evm.tracer.CaptureExit(frame, output, frame.Gas-*ctx.Gas, err)
+		}()
+	}
+
 	for {
+		if err := evm.cache.Error(); err != nil {
+			return nil, err
+		}
 		if maybe.Error() != nil {
 			if maybe.Error() != errors.ExecutionReverted {
 				*ctx.Gas = 0
@@ -258,6 +371,12 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 		if debug {
 			log.Debugf("(pc) %-3d (op) %-14s (st) %-4d (gas) %d", pc, op.String(), stack.Len(), *ctx.Gas)
 		}
+		if evm.tracer != nil {
+			if step != nil {
+				evm.captureStateEnd(step, *ctx.Gas, nil)
+			}
+			step = evm.captureState(frame, pc, op, *ctx.Gas, stack, memory)
+		}
 
 		switch op {
 		case ADD: // 0x01
@@ -668,6 +787,10 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 			memOff := stack.PopBigInt()
 			inputOff := stack.PopBigInt()
 			length := stack.PopBigInt()
+			if err := checkCopy(*ctx.Gas, length); err != nil {
+				maybe.PushError(err)
+				continue
+			}
 			data := util.GetDataBig(ctx.Input, inputOff, length)
 			maybe.PushError(useGasNegative(ctx.Gas, gas.VeryLow))
 			gasCost := memory.Write(memOff, data) + wordGas(length.Uint64(), gas.Copy)
@@ -688,6 +811,10 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 			memOff := stack.PopBigInt()
 			codeOff := stack.PopBigInt()
 			length := stack.PopBigInt()
+			if err := checkCopy(*ctx.Gas, length); err != nil {
+				maybe.PushError(err)
+				continue
+			}
 			data := util.GetDataBig(code, codeOff, length)
 			maybe.PushError(useGasNegative(ctx.Gas, gas.VeryLow))
 			gasCost := memory.Write(memOff, data) + wordGas(length.Uint64(), gas.Copy)
@@ -720,6 +847,10 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 			memOff := stack.PopBigInt()
 			codeOff := stack.PopBigInt()
 			length := stack.PopBigInt()
+			if err := checkCopy(*ctx.Gas, length); err != nil {
+				maybe.PushError(err)
+				continue
+			}
 			data := util.GetDataBig(code, codeOff, length)
 			gasCost := memory.Write(memOff, data) + wordGas(length.Uint64(), gas.Copy)
 			maybe.PushError(useGasNegative(ctx.Gas, gasCost))
@@ -901,7 +1032,7 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 			if isEqual(data.Bytes(), currentData) {
 				maybe.PushError(useGasNegative(ctx.Gas, gas.SstoreNoopEIP2200))
 			} else {
-				originData := evm.cache.db.GetStorage(callee, loc.Bytes())
+				originData := evm.cache.getOriginStorage(callee, loc)
 				if isEqual(originData, currentData) {
 					if isEmptyValue(originData) {
 						maybe.PushError(useGasNegative(ctx.Gas, gas.SstoreInitEIP2200))
@@ -1068,6 +1199,8 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 				maybe.PushError(errors.InvalidAddress)
 			}
 
+			// the caller nonce is increased even if the creation fails
+			snapshot := evm.cache.snapshot()
 			newAccount := evm.bc.NewAccount(newAccountAddress)
 			newAccount.SetNonce(newAccount.GetNonce() + 1)
 			maybe.PushError(evm.cache.UpdateAccount(newAccount))
@@ -1078,10 +1211,13 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 			prevValue := ctx.Value
 			ctx.Input = nil
 			ctx.Value = contractValue
+			evm.creating = true
 			ret, callErr := evm.Call(callee, newAccountAddress, input)
+			evm.creating = false
 			ctx.Input = prevInput
 			ctx.Value = prevValue
 			if callErr != nil {
+				evm.cache.revert(snapshot)
 				stack.Push(core.Zero256)
 				// Note we both set the return buffer and return the result normally in order to service the error to
 				// EVM caller
@@ -1121,7 +1257,10 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 				gasLimit += gas.CallStipend
 			}
 			input, memoryGas := memory.Read(inOffset, inSize)
-			maybe.PushError(useGasNegative(ctx.Gas, memoryGas))
+			// the return window is expanded before the call and charged as memory expansion, as
+			// the yellow paper defines μ'_i = M(M(μ_i, inOffset, inSize), retOffset, retSize)
+			_, retMemoryGas := memory.Read(retOffset, new(big.Int).SetUint64(retSize))
+			maybe.PushError(useGasNegative(ctx.Gas, memoryGas+retMemoryGas))
 
 			// store prev ctx
 			prevInput := evm.ctx.Input
@@ -1134,18 +1273,21 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 			if debug {
 				log.Debugf("  %v", target.Bytes())
 			}
+			snapshot := evm.cache.snapshot()
 			if op == CALL {
 				returnData, err = evm.Call(callee, target, evm.getAccount(target).GetCode())
-			} else {
-				returnData, err = evm.Call(callee, callee, evm.getAccount(target).GetCode())
+			} else if err = evm.transfer(callee, callee, value); err == nil {
+				returnData, err = evm.callCode(callee, callee, target, evm.getAccount(target).GetCode())
 			}
 			if err != nil {
+				// the changes of a failed call are dropped, include a reverted one
+				evm.cache.revert(snapshot)
 				stack.Push(core.Zero256)
 			} else {
 				stack.Push(core.One256)
 			}
 			if err == nil || err.Error() == errors.ExecutionReverted.Error() {
-				memory.Write(retOffset, util.RightPadBytes(returnData, int(retSize)))
+				writeReturnData(memory, retOffset, returnData, retSize)
 			}
 			// restore ctx
 			ctx.Input = prevInput
@@ -1165,20 +1307,11 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 			target := stack.PopAddress()
 			inOffset, inSize := stack.PopBigInt(), stack.PopBigInt()
 			retOffset, retSize := stack.PopBigInt(), stack.PopUint64()
-			var memoryGas uint64
-			var input []byte
-			if op == STATICCALL {
-				x, _ := memory.CalMemGas(inOffset.Uint64(), inSize.Uint64())
-				y, _ := memory.CalMemGas(retOffset.Uint64(), retSize)
-				if x > y {
-					memoryGas = x
-				} else {
-					memoryGas = y
-				}
-				input, _ = memory.Read(inOffset, inSize)
-			} else {
-				input, memoryGas = memory.Read(inOffset, inSize)
-			}
+			input, memoryGas := memory.Read(inOffset, inSize)
+			// the return window is expanded before the call and charged as memory expansion, as
+			// the yellow paper defines μ'_i = M(M(μ_i, inOffset, inSize), retOffset, retSize)
+			_, retMemoryGas := memory.Read(retOffset, new(big.Int).SetUint64(retSize))
+			memoryGas += retMemoryGas
 			gas = staticCallGas(*ctx.Gas, memoryGas, gas)
 			maybe.PushError(useGasNegative(ctx.Gas, gas+memoryGas))
 			// store prev ctx
@@ -1192,19 +1325,26 @@ func (evm *EVM) call(caller, callee Address, code []byte) ([]byte, error) {
 			if debug {
 				log.Debugf("  %v", target.Bytes())
 			}
+			snapshot := evm.cache.snapshot()
 			if op == STATICCALL {
+				evm.cache.touch(target)
+				prevReadOnly := evm.readOnly
+				evm.readOnly = true
 				returnData, err = evm.CallWithoutTransfer(callee, target, evm.getAccount(target).GetCode())
+				evm.readOnly = prevReadOnly
 			} else {
-				returnData, err = evm.CallWithoutTransfer(caller, callee, evm.getAccount(target).GetCode())
+				returnData, err = evm.callCode(caller, callee, target, evm.getAccount(target).GetCode())
 			}
 
 			if err != nil {
+				// the changes of a failed call are dropped, include a reverted one
+				evm.cache.revert(snapshot)
 				stack.Push(core.Zero256)
 			} else {
 				stack.Push(core.One256)
 			}
 			if err == nil || err.Error() == errors.ExecutionReverted.Error() {
-				memory.Write(retOffset, util.RightPadBytes(returnData, int(retSize)))
+				writeReturnData(memory, retOffset, returnData, retSize)
 			}
 			// restore ctx
 			ctx.Input = prevInput
@@ -1371,3 +1511,34 @@ func isEmptyAccount(account Account) bool {
 func wordGas(length, copyGas uint64) uint64 {
 	return (length + 31) / 32 * copyGas
 }
+
+// writeReturnData copy the return data of a call into its return window, which
+// is expanded before the call. Only min(size, len(data)) bytes are written, so
+// the memory never grows past offset+size, and the rest of window is unchanged.
+// It follows the yellow paper: μ'_m[offset ... offset+n-1] = o[0 ... n-1] where
+// n = min(size, |o|).
+func writeReturnData(memory Memory, offset *big.Int, data []byte, size uint64) {
+	if uint64(len(data)) > size {
+		data = data[:size]
+	}
+	memory.Write(offset, data)
+}
+
+// checkCopy return an error if gas left is not enough to pay the copy of length bytes,
+// it should be called before the data is padded to length, which may be huge.
+// The yellow paper halts exceptionally before an operation whose cost, which
+// includes G_copy * ceil(length / 32) for a copy, is more than the gas left,
+// so the copy has no effect and nothing is allocated.
+func checkCopy(gasLeft uint64, length *big.Int) error {
+	if !length.IsUint64() {
+		return errors.InsufficientGas
+	}
+	words := length.Uint64() / 32
+	if length.Uint64()%32 != 0 {
+		words++
+	}
+	if words > gasLeft/gas.Copy {
+		return errors.InsufficientGas
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evm
+
+// ToFallibleDB adapt a DB to FallibleDB, and the adapted db never returns error
+func ToFallibleDB(db DB) FallibleDB {
+	return &fallibleDB{db: db}
+}
+
+type fallibleDB struct {
+	db DB
+}
+
+func (f *fallibleDB) TryExist(address Address) (bool, error) {
+	return f.db.Exist(address), nil
+}
+
+func (f *fallibleDB) TryGetAccount(address Address) (Account, error) {
+	return f.db.GetAccount(address), nil
+}
+
+func (f *fallibleDB) TryGetStorage(address Address, key []byte) ([]byte, error) {
+	return f.db.GetStorage(address, key), nil
+}
+
+func (f *fallibleDB) NewWriteBatch() WriteBatch {
+	return f.db.NewWriteBatch()
+}
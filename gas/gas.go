@@ -83,6 +83,7 @@ const (
 	IdentityBase       uint64 = 15  // Base price for a data copy operation
 	IdentityPerWord    uint64 = 3   // Per-work price for a data copy operation
 	ModExpQuadCoeffDiv uint64 = 20  // Divisor for the quadratic particle of the big int modular exponentiation
+	ModExpMinEIP2565   uint64 = 200 // Minimum price of the big int modular exponentiation since EIP-2565
 
 	Bn256AddByzantium             uint64 = 500    // Byzantium gas needed for an elliptic curve addition
 	Bn256AddIstanbul              uint64 = 150    // Gas needed for an elliptic curve addition
@@ -92,4 +93,19 @@ const (
 	Bn256PairingBaseIstanbul      uint64 = 45000  // Base price for an elliptic curve pairing check
 	Bn256PairingPerPointByzantium uint64 = 80000  // Byzantium per-point price for an elliptic curve pairing check
 	Bn256PairingPerPointIstanbul  uint64 = 34000  // Per-point price for an elliptic curve pairing check
+
+	Sm3Base    uint64 = 60   // Base price for a SM3 operation
+	Sm3PerWord uint64 = 12   // Per-word price for a SM3 operation
+	Sm2Verify  uint64 = 3000 // Price for a SM2 signature verification
+	Sm2Recover uint64 = 3000 // Price for a SM2 public key recovery
+	P256Verify uint64 = 3450 // Price for a secp256r1 signature verification of RIP-7212
+
+	Bls12381G1Add          uint64 = 375   // Price for BLS12-381 elliptic curve G1 point addition
+	Bls12381G1Mul          uint64 = 12000 // Price for BLS12-381 elliptic curve G1 point scalar multiplication
+	Bls12381G2Add          uint64 = 600   // Price for BLS12-381 elliptic curve G2 point addition
+	Bls12381G2Mul          uint64 = 22500 // Price for BLS12-381 elliptic curve G2 point scalar multiplication
+	Bls12381PairingBase    uint64 = 37700 // Base gas price for BLS12-381 elliptic curve pairing check
+	Bls12381PairingPerPair uint64 = 32600 // Per-point pair gas price for BLS12-381 elliptic curve pairing check
+	Bls12381MapG1          uint64 = 5500  // Gas price for BLS12-381 mapping field element to G1 operation
+	Bls12381MapG2          uint64 = 23800 // Gas price for BLS12-381 mapping field element to G2 operation
 )
@@ -0,0 +1,129 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evm
+
+import "github.com/thu-arxan/evm/gas"
+
+// constantGasTable is the gas every opcode pays first, the memory expansion
+// and other gas depend on operands are not included.
+// Note: It should be kept the same with the interpreter, which is checked by
+// TestConstantGas in tests.
+var constantGasTable = [256]uint64{
+	STOP:       gas.Zero,
+	ADD:        gas.VeryLow,
+	MUL:        gas.Low,
+	SUB:        gas.VeryLow,
+	DIV:        gas.Low,
+	SDIV:       gas.Low,
+	MOD:        gas.Low,
+	SMOD:       gas.Low,
+	ADDMOD:     gas.Mid,
+	MULMOD:     gas.Mid,
+	EXP:        gas.Exp,
+	SIGNEXTEND: gas.Low,
+
+	LT:     gas.VeryLow,
+	GT:     gas.VeryLow,
+	SLT:    gas.VeryLow,
+	SGT:    gas.VeryLow,
+	EQ:     gas.VeryLow,
+	ISZERO: gas.VeryLow,
+	AND:    gas.VeryLow,
+	OR:     gas.VeryLow,
+	XOR:    gas.VeryLow,
+	NOT:    gas.VeryLow,
+	BYTE:   gas.VeryLow,
+	SHL:    gas.VeryLow,
+	SHR:    gas.VeryLow,
+	SAR:    gas.VeryLow,
+
+	SHA3: gas.SHA3,
+
+	ADDRESS:        gas.Base,
+	BALANCE:        gas.Balance,
+	ORIGIN:         gas.Base,
+	CALLER:         gas.Base,
+	CALLVALUE:      gas.Base,
+	CALLDATALOAD:   gas.VeryLow,
+	CALLDATASIZE:   gas.Base,
+	CALLDATACOPY:   gas.VeryLow,
+	CODESIZE:       gas.Base,
+	CODECOPY:       gas.VeryLow,
+	GASPRICE:       gas.Base,
+	EXTCODESIZE:    gas.ExtCode,
+	EXTCODECOPY:    gas.ExtCode,
+	RETURNDATASIZE: gas.Base,
+	RETURNDATACOPY: gas.VeryLow,
+	EXTCODEHASH:    gas.ExtcodeHash,
+
+	BLOCKHASH:   gas.BlockHash,
+	COINBASE:    gas.Base,
+	TIMESTAMP:   gas.Base,
+	NUMBER:      gas.Base,
+	DIFFICULTY:  gas.Base,
+	GASLIMIT:    gas.Base,
+	CHAINID:     gas.Base,
+	SELFBALANCE: gas.Low,
+
+	POP:      gas.Base,
+	MLOAD:    gas.VeryLow,
+	MSTORE:   gas.VeryLow,
+	MSTORE8:  gas.VeryLow,
+	SLOAD:    gas.Sload,
+	SSTORE:   gas.Zero,
+	JUMP:     gas.Mid,
+	JUMPI:    gas.High,
+	PC:       gas.Base,
+	MSIZE:    gas.Base,
+	GAS:      gas.Base,
+	JUMPDEST: gas.JumpDest,
+
+	LOG0: gas.Log,
+	LOG1: gas.Log,
+	LOG2: gas.Log,
+	LOG3: gas.Log,
+	LOG4: gas.Log,
+
+	CREATE:       gas.Create,
+	CALL:         gas.Call,
+	CALLCODE:     gas.Call,
+	RETURN:       gas.Zero,
+	DELEGATECALL: gas.Call,
+	CREATE2:      gas.Create,
+	STATICCALL:   gas.Call,
+	REVERT:       gas.Zero,
+	INVALID:      gas.Zero,
+	SELFDESTRUCT: gas.SelfdestructEIP150,
+}
+
+func init() {
+	for op := PUSH1; op <= PUSH32; op++ {
+		constantGasTable[op] = gas.VeryLow
+	}
+	for op := DUP1; op <= DUP16; op++ {
+		constantGasTable[op] = gas.VeryLow
+	}
+	for op := SWAP1; op <= SWAP16; op++ {
+		constantGasTable[op] = gas.VeryLow
+	}
+}
+
+// ConstantGas return the gas an opcode always pays before it is executed
+func ConstantGas(op OpCode) uint64 {
+	return constantGasTable[op]
+}
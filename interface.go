@@ -59,12 +59,31 @@ type DB interface {
 	NewWriteBatch() WriteBatch
 }
 
-// WriteBatch define a batch which support some write operations
+// FallibleDB describe the db which could report the failure of backend, such as
+// a disk or network db. The methods are the same with DB except that an error is
+// returned, and the execution is aborted with an errors.DBError once it occurs.
+type FallibleDB interface {
+	TryExist(address Address) (bool, error)
+	// TryGetAccount return a default account if unexist
+	TryGetAccount(address Address) (Account, error)
+	// TryGetStorage return nil if key is not exist
+	TryGetStorage(address Address, key []byte) ([]byte, error)
+	NewWriteBatch() WriteBatch
+}
+
+// WriteBatch define a batch which support some write operations, and the
+// writes should be applied atomically once committed
 type WriteBatch interface {
 	SetStorage(address Address, key []byte, value []byte)
-	// Note: db should delete all storages if an account suicide
 	UpdateAccount(account Account) error
+	// DeleteAccount delete an account and all its storages, which is called if an
+	// account suicides, or is touched and empty if EIP-161 is enabled by EVM.SetEIP161
+	DeleteAccount(address Address)
 	AddLog(log *Log)
+	// Commit apply all writes of the batch, and nothing should be applied if it returns an error
+	Commit() error
+	// Discard drop all writes of the batch
+	Discard()
 }
 
 // Blockchain describe what function that blockchain system shoudld provide to support the evm
@@ -118,12 +118,23 @@ func (mem *dynamicMemory) CalMemGas(offset, length uint64) (uint64, error) {
 	return 0, nil
 }
 
+// memoryFee return the total gas paid for a memory of size bytes
+func memoryFee(size uint64) uint64 {
+	words := (size + 31) / 32
+	return words*gas.Memory + words*words/gas.QuadCoeffDiv
+}
+
 func (mem *dynamicMemory) Len() uint64 {
 	return uint64(len(mem.slice))
 }
 
 // Read is the implementation of Memory
 func (mem *dynamicMemory) Read(offset, length *big.Int) ([]byte, uint64) {
+	// Reading nothing never expands memory, whatever the offset is, as the yellow
+	// paper defines the memory expansion M(s, f, l) = s if l = 0
+	if length.Sign() == 0 {
+		return []byte{}, 0
+	}
 	// Ensures positive and not too wide
 	if !offset.IsUint64() {
 		mem.pushErr(fmt.Errorf("offset %v does not fit inside an unsigned 64-bit integer", offset))
@@ -151,6 +162,10 @@ func (mem *dynamicMemory) Read(offset, length *big.Int) ([]byte, uint64) {
 
 // Write is the implementation of Memory
 func (mem *dynamicMemory) Write(offset *big.Int, value []byte) uint64 {
+	// Writing nothing never expands memory, whatever the offset is, see Read
+	if len(value) == 0 {
+		return 0
+	}
 	// Ensures positive and not too wide
 	if !offset.IsUint64() {
 		mem.pushErr(fmt.Errorf("offset %v does not fit inside an unsigned 64-bit integer", offset))
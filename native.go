@@ -0,0 +1,153 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evm
+
+import (
+	"fmt"
+
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/errors"
+)
+
+// NativeContract is a contract implemented in go, unlike precompile.Contract it
+// could know who calls it and read or write state by NativeContext, so it could
+// be used to implement system contracts such as permission and governance.
+type NativeContract interface {
+	// RequiredGas is the gas charged before Run, and more gas could be charged by NativeContext.UseGas
+	RequiredGas(input []byte) uint64
+	Run(ctx *NativeContext) ([]byte, error)
+}
+
+// NativeContext is the context of a call to native contract
+type NativeContext struct {
+	Caller Address
+	// Callee is the account whose storage and balance are used, which differs
+	// from CodeAddress if the native contract is called by DELEGATECALL or CALLCODE
+	Callee      Address
+	CodeAddress Address
+	// Value has been transferred to Callee before Run
+	Value uint64
+	Input []byte
+	// ReadOnly is true if the native contract is called by STATICCALL, and any
+	// modification of state returns errors.IllegalWrite
+	ReadOnly bool
+
+	evm *EVM
+}
+
+// Gas return the gas left
+func (ctx *NativeContext) Gas() uint64 {
+	return *ctx.evm.ctx.Gas
+}
+
+// UseGas charge gas, and return errors.InsufficientGas if the gas left is not enough
+func (ctx *NativeContext) UseGas(amount uint64) error {
+	return useGasNegative(ctx.evm.ctx.Gas, amount)
+}
+
+// Context return the context of evm, which contains the block infos
+func (ctx *NativeContext) Context() *Context {
+	return ctx.evm.ctx
+}
+
+// Origin return the origin of transaction
+func (ctx *NativeContext) Origin() Address {
+	return ctx.evm.origin
+}
+
+// GetStorage return the storage of Callee, and it is 32 zero bytes if not exist
+func (ctx *NativeContext) GetStorage(key core.Word256) []byte {
+	return ctx.evm.cache.GetStorage(ctx.Callee, key)
+}
+
+// SetStorage set the storage of Callee
+func (ctx *NativeContext) SetStorage(key core.Word256, value []byte) error {
+	if ctx.ReadOnly {
+		return errors.IllegalWrite
+	}
+	ctx.evm.cache.SetStorage(ctx.Callee, key, value)
+	return nil
+}
+
+// GetBalance return the balance of an account
+func (ctx *NativeContext) GetBalance(address Address) uint64 {
+	return ctx.evm.cache.GetAccount(address).GetBalance()
+}
+
+// Transfer transfer value from Callee to an account
+func (ctx *NativeContext) Transfer(to Address, value uint64) error {
+	if ctx.ReadOnly && value != 0 {
+		return errors.IllegalWrite
+	}
+	return ctx.evm.transfer(ctx.Callee, to, value)
+}
+
+// AddLog add a log of Callee
+func (ctx *NativeContext) AddLog(topics []core.Word256, data []byte) error {
+	if ctx.ReadOnly {
+		return errors.IllegalWrite
+	}
+	ctx.evm.cache.AddLog(&Log{
+		Address: ctx.Callee,
+		Topics:  topics,
+		Data:    data,
+	})
+	return nil
+}
+
+// AddNativeContract add a native contract at address, and return an error if
+// there is already one. Native contracts take precedence over precompile contracts.
+func (evm *EVM) AddNativeContract(address Address, contract NativeContract) error {
+	key := addressToString(address)
+	if _, ok := evm.natives[key]; ok {
+		return fmt.Errorf("native contract at %x already exists", address.Bytes())
+	}
+	if evm.natives == nil {
+		evm.natives = make(map[string]NativeContract)
+	}
+	evm.natives[key] = contract
+	return nil
+}
+
+// RemoveNativeContract remove the native contract at address
+func (evm *EVM) RemoveNativeContract(address Address) {
+	delete(evm.natives, addressToString(address))
+}
+
+// runNative runs a native contract, and the state is modified in cache. The
+// changes made by a failed native contract are reverted, as a failed call does.
+func (evm *EVM) runNative(contract NativeContract, caller, callee, codeAddress Address) ([]byte, error) {
+	if err := useGasNegative(evm.ctx.Gas, contract.RequiredGas(evm.ctx.Input)); err != nil {
+		return nil, err
+	}
+	snapshot := evm.cache.snapshot()
+	output, err := contract.Run(&NativeContext{
+		Caller:      caller,
+		Callee:      callee,
+		CodeAddress: codeAddress,
+		Value:       evm.ctx.Value,
+		Input:       evm.ctx.Input,
+		ReadOnly:    evm.readOnly,
+		evm:         evm,
+	})
+	if err != nil {
+		evm.cache.revert(snapshot)
+		return nil, err
+	}
+	return output, nil
+}
@@ -0,0 +1,106 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Package native provides helpers to implement evm.NativeContract
+package native
+
+import (
+	"fmt"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/abi"
+)
+
+// Method is the handler of a method of abi, args are unpacked from input by the
+// inputs of method, and the values returned are packed by the outputs of method
+type Method func(ctx *evm.NativeContext, args []interface{}) ([]interface{}, error)
+
+type handler struct {
+	method abi.Method
+	gas    uint64
+	fn     Method
+}
+
+// Dispatcher is an evm.NativeContract which dispatches a call to the handler of
+// the method selected by the first 4 bytes of input, like a solidity contract.
+// Note: The handler of a view or pure method runs in read only mode.
+type Dispatcher struct {
+	abi      abi.ABI
+	handlers map[string]*handler
+}
+
+// NewDispatcher is the constructor of Dispatcher
+func NewDispatcher(contract abi.ABI) *Dispatcher {
+	return &Dispatcher{
+		abi:      contract,
+		handlers: make(map[string]*handler),
+	}
+}
+
+// Register set the handler of a method, and gas is charged before the handler runs
+func (d *Dispatcher) Register(name string, gas uint64, fn Method) error {
+	method, ok := d.abi.Methods[name]
+	if !ok {
+		return fmt.Errorf("method '%s' not found", name)
+	}
+	d.handlers[string(method.ID())] = &handler{
+		method: method,
+		gas:    gas,
+		fn:     fn,
+	}
+	return nil
+}
+
+// RequiredGas is the implementation of evm.NativeContract
+func (d *Dispatcher) RequiredGas(input []byte) uint64 {
+	if h := d.handler(input); h != nil {
+		return h.gas
+	}
+	return 0
+}
+
+// Run is the implementation of evm.NativeContract
+func (d *Dispatcher) Run(ctx *evm.NativeContext) ([]byte, error) {
+	h := d.handler(ctx.Input)
+	if h == nil {
+		if len(ctx.Input) < 4 {
+			return nil, fmt.Errorf("input is too short to select a method")
+		}
+		return nil, fmt.Errorf("no method with id 0x%x", ctx.Input[:4])
+	}
+	args, err := h.method.Inputs.UnpackValues(ctx.Input[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack input of %s: %v", h.method.Name, err)
+	}
+	if h.method.Const && !ctx.ReadOnly {
+		readOnly := *ctx
+		readOnly.ReadOnly = true
+		ctx = &readOnly
+	}
+	values, err := h.fn(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return h.method.Outputs.Pack(values...)
+}
+
+func (d *Dispatcher) handler(input []byte) *handler {
+	if len(input) < 4 {
+		return nil
+	}
+	return d.handlers[string(input[:4])]
+}
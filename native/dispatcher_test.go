@@ -0,0 +1,198 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package native
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/abi"
+	"github.com/thu-arxan/evm/asm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/errors"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+const feeConfigABI = `[
+	{"type":"function","name":"setFee","inputs":[{"name":"fee","type":"uint256"}],"outputs":[],"stateMutability":"nonpayable"},
+	{"type":"function","name":"fee","inputs":[],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"},
+	{"type":"function","name":"admin","inputs":[],"outputs":[{"name":"","type":"address"}],"stateMutability":"view"},
+	{"type":"function","name":"badView","inputs":[],"outputs":[],"stateMutability":"view"},
+	{"type":"function","name":"deposit","inputs":[],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"payable"}
+]`
+
+var feeSlot = core.Word256{31: 1}
+
+// feeConfig is a system contract which only could be modified by admin
+type feeConfig struct {
+	admin evm.Address
+}
+
+func newFeeConfig(t *testing.T, admin evm.Address) *Dispatcher {
+	contract, err := abi.JSON(strings.NewReader(feeConfigABI))
+	require.NoError(t, err)
+	var c = &feeConfig{admin: admin}
+	d := NewDispatcher(contract)
+	require.NoError(t, d.Register("setFee", 5000, c.setFee))
+	require.NoError(t, d.Register("fee", 200, c.fee))
+	require.NoError(t, d.Register("admin", 200, c.getAdmin))
+	require.NoError(t, d.Register("badView", 200, c.setFee))
+	require.NoError(t, d.Register("deposit", 200, c.deposit))
+	require.Error(t, d.Register("unknown", 200, c.fee))
+	return d
+}
+
+func (c *feeConfig) setFee(ctx *evm.NativeContext, args []interface{}) ([]interface{}, error) {
+	if string(ctx.Caller.Bytes()) != string(c.admin.Bytes()) {
+		return nil, errors.PermissionDenied
+	}
+	var fee = new(big.Int)
+	if len(args) > 0 {
+		fee = args[0].(*big.Int)
+	}
+	if err := ctx.SetStorage(feeSlot, core.LeftPadWord256(fee.Bytes()).Bytes()); err != nil {
+		return nil, err
+	}
+	return nil, ctx.AddLog(nil, core.LeftPadWord256(fee.Bytes()).Bytes())
+}
+
+func (c *feeConfig) fee(ctx *evm.NativeContext, args []interface{}) ([]interface{}, error) {
+	return []interface{}{new(big.Int).SetBytes(ctx.GetStorage(feeSlot))}, nil
+}
+
+func (c *feeConfig) getAdmin(ctx *evm.NativeContext, args []interface{}) ([]interface{}, error) {
+	return []interface{}{c.admin.Bytes()}, nil
+}
+
+func (c *feeConfig) deposit(ctx *evm.NativeContext, args []interface{}) ([]interface{}, error) {
+	return []interface{}{new(big.Int).SetUint64(ctx.GetBalance(ctx.Callee))}, nil
+}
+
+var (
+	admin      = example.HexToAddress("6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0")
+	feeAddress = example.HexToAddress("0000000000000000000000000000000000001000")
+)
+
+func TestDispatcher(t *testing.T) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	require.NoError(t, memoryDB.InitBalance(admin, 1000))
+	contract, err := abi.JSON(strings.NewReader(feeConfigABI))
+	require.NoError(t, err)
+	call := func(caller evm.Address, value uint64, method string, args ...string) ([]byte, uint64, error) {
+		input, err := contract.PackValues(method, args...)
+		require.NoError(t, err)
+		var gas uint64 = 100000
+		vm := evm.New(bc, memoryDB, &evm.Context{
+			Input: input,
+			Value: value,
+			Gas:   &gas,
+		})
+		require.NoError(t, vm.AddNativeContract(feeAddress, newFeeConfig(t, admin)))
+		require.Error(t, vm.AddNativeContract(feeAddress, newFeeConfig(t, admin)))
+		output, err := vm.Call(caller, feeAddress, nil)
+		return output, 100000 - gas, err
+	}
+
+	_, gasUsed, err := call(admin, 0, "setFee", "100")
+	require.NoError(t, err)
+	require.EqualValues(t, 5000, gasUsed)
+	require.Equal(t, core.LeftPadWord256([]byte{100}).Bytes(), memoryDB.GetStorage(feeAddress, feeSlot.Bytes()))
+	require.Len(t, memoryDB.GetLog(), 1)
+
+	_, _, err = call(example.RandomAddress(), 0, "setFee", "200")
+	require.Equal(t, errors.PermissionDenied, err)
+
+	output, gasUsed, err := call(example.RandomAddress(), 0, "fee")
+	require.NoError(t, err)
+	require.EqualValues(t, 200, gasUsed)
+	values, err := contract.UnpackValues("fee", output)
+	require.NoError(t, err)
+	require.Equal(t, []string{"100"}, values)
+
+	output, _, err = call(admin, 0, "admin")
+	require.NoError(t, err)
+	require.Equal(t, util.LeftPadBytes(admin.Bytes(), 32), output)
+
+	// the handler of view method runs in read only mode
+	_, _, err = call(admin, 0, "badView")
+	require.Equal(t, errors.IllegalWrite, err)
+
+	// the value is transferred before the native contract runs
+	output, _, err = call(admin, 10, "deposit")
+	require.NoError(t, err)
+	require.Equal(t, core.LeftPadWord256([]byte{10}).Bytes(), output)
+
+	_, _, err = call(admin, 0, "")
+	require.Error(t, err)
+}
+
+func TestDispatcherStaticCall(t *testing.T) {
+	contract, err := abi.JSON(strings.NewReader(feeConfigABI))
+	require.NoError(t, err)
+	input, err := contract.PackValues("setFee", "100")
+	require.NoError(t, err)
+	for _, op := range []string{"CALL", "STATICCALL"} {
+		var value string
+		if op == "CALL" {
+			value = "PUSH1 0"
+		}
+		// call setFee by op and return the result of call
+		code := asm.MustAssemble(`
+			CALLDATASIZE
+			PUSH1 0
+			PUSH1 0
+			CALLDATACOPY
+			PUSH1 0
+			PUSH1 0
+			CALLDATASIZE
+			PUSH1 0
+			` + value + `
+			PUSH 0x1000
+			GAS
+			` + op + `
+			PUSH1 0
+			MSTORE
+			PUSH1 0x20
+			PUSH1 0
+			RETURN
+		`)
+		bc := example.NewBlockchain()
+		memoryDB := db.NewMemory(bc.NewAccount)
+		var gas uint64 = 100000
+		vm := evm.New(bc, memoryDB, &evm.Context{
+			Input: input,
+			Gas:   &gas,
+		})
+		// the contract calls setFee is the admin
+		require.NoError(t, vm.AddNativeContract(feeAddress, newFeeConfig(t, example.HexToAddress("00000000000000000000000000000000000000aa"))))
+		output, err := vm.Call(admin, example.HexToAddress("00000000000000000000000000000000000000aa"), code)
+		require.NoError(t, err)
+		if op == "CALL" {
+			require.Equal(t, core.One256.Bytes(), output, op)
+		} else {
+			require.Equal(t, core.Zero256.Bytes(), output, op)
+		}
+	}
+}
@@ -51,6 +51,7 @@ func _() {
 	_ = x[SHL-27]
 	_ = x[SHR-28]
 	_ = x[SAR-29]
+	_ = x[SHA3-32]
 	_ = x[ADDRESS-48]
 	_ = x[BALANCE-49]
 	_ = x[ORIGIN-50]
@@ -171,22 +172,23 @@ func _() {
 const (
 	_OpCode_name_0 = "STOPADDMULSUBDIVSDIVMODSMODADDMODMULMODEXPSIGNEXTEND"
 	_OpCode_name_1 = "LTGTSLTSGTEQISZEROANDORXORNOTBYTESHLSHRSAR"
-	_OpCode_name_2 = "ADDRESSBALANCEORIGINCALLERCALLVALUECALLDATALOADCALLDATASIZECALLDATACOPYCODESIZECODECOPYGASPRICEEXTCODESIZEEXTCODECOPYRETURNDATASIZERETURNDATACOPYEXTCODEHASHBLOCKHASHCOINBASETIMESTAMPNUMBERDIFFICULTYGASLIMITCHAINIDSELFBALANCE"
-	_OpCode_name_3 = "POPMLOADMSTOREMSTORE8SLOADSSTOREJUMPJUMPIPCMSIZEGASJUMPDEST"
-	_OpCode_name_4 = "PUSH1PUSH2PUSH3PUSH4PUSH5PUSH6PUSH7PUSH8PUSH9PUSH10PUSH11PUSH12PUSH13PUSH14PUSH15PUSH16PUSH17PUSH18PUSH19PUSH20PUSH21PUSH22PUSH23PUSH24PUSH25PUSH26PUSH27PUSH28PUSH29PUSH30PUSH31PUSH32DUP1DUP2DUP3DUP4DUP5DUP6DUP7DUP8DUP9DUP10DUP11DUP12DUP13DUP14DUP15DUP16SWAP1SWAP2SWAP3SWAP4SWAP5SWAP6SWAP7SWAP8SWAP9SWAP10SWAP11SWAP12SWAP13SWAP14SWAP15SWAP16LOG0LOG1LOG2LOG3LOG4"
-	_OpCode_name_5 = "CREATECALLCALLCODERETURNDELEGATECALLCREATE2"
-	_OpCode_name_6 = "STATICCALL"
-	_OpCode_name_7 = "REVERTINVALIDSELFDESTRUCT"
+	_OpCode_name_2 = "SHA3"
+	_OpCode_name_3 = "ADDRESSBALANCEORIGINCALLERCALLVALUECALLDATALOADCALLDATASIZECALLDATACOPYCODESIZECODECOPYGASPRICEEXTCODESIZEEXTCODECOPYRETURNDATASIZERETURNDATACOPYEXTCODEHASHBLOCKHASHCOINBASETIMESTAMPNUMBERDIFFICULTYGASLIMITCHAINIDSELFBALANCE"
+	_OpCode_name_4 = "POPMLOADMSTOREMSTORE8SLOADSSTOREJUMPJUMPIPCMSIZEGASJUMPDEST"
+	_OpCode_name_5 = "PUSH1PUSH2PUSH3PUSH4PUSH5PUSH6PUSH7PUSH8PUSH9PUSH10PUSH11PUSH12PUSH13PUSH14PUSH15PUSH16PUSH17PUSH18PUSH19PUSH20PUSH21PUSH22PUSH23PUSH24PUSH25PUSH26PUSH27PUSH28PUSH29PUSH30PUSH31PUSH32DUP1DUP2DUP3DUP4DUP5DUP6DUP7DUP8DUP9DUP10DUP11DUP12DUP13DUP14DUP15DUP16SWAP1SWAP2SWAP3SWAP4SWAP5SWAP6SWAP7SWAP8SWAP9SWAP10SWAP11SWAP12SWAP13SWAP14SWAP15SWAP16LOG0LOG1LOG2LOG3LOG4"
+	_OpCode_name_6 = "CREATECALLCALLCODERETURNDELEGATECALLCREATE2"
+	_OpCode_name_7 = "STATICCALL"
+	_OpCode_name_8 = "REVERTINVALIDSELFDESTRUCT"
 )
 
 var (
 	_OpCode_index_0 = [...]uint8{0, 4, 7, 10, 13, 16, 20, 23, 27, 33, 39, 42, 52}
 	_OpCode_index_1 = [...]uint8{0, 2, 4, 7, 10, 12, 18, 21, 23, 26, 29, 33, 36, 39, 42}
-	_OpCode_index_2 = [...]uint8{0, 7, 14, 20, 26, 35, 47, 59, 71, 79, 87, 95, 106, 117, 131, 145, 156, 165, 173, 182, 188, 198, 206, 213, 224}
-	_OpCode_index_3 = [...]uint8{0, 3, 8, 14, 21, 26, 32, 36, 41, 43, 48, 51, 59}
-	_OpCode_index_4 = [...]uint16{0, 5, 10, 15, 20, 25, 30, 35, 40, 45, 51, 57, 63, 69, 75, 81, 87, 93, 99, 105, 111, 117, 123, 129, 135, 141, 147, 153, 159, 165, 171, 177, 183, 187, 191, 195, 199, 203, 207, 211, 215, 219, 224, 229, 234, 239, 244, 249, 254, 259, 264, 269, 274, 279, 284, 289, 294, 299, 305, 311, 317, 323, 329, 335, 341, 345, 349, 353, 357, 361}
-	_OpCode_index_5 = [...]uint8{0, 6, 10, 18, 24, 36, 43}
-	_OpCode_index_7 = [...]uint8{0, 6, 13, 25}
+	_OpCode_index_3 = [...]uint8{0, 7, 14, 20, 26, 35, 47, 59, 71, 79, 87, 95, 106, 117, 131, 145, 156, 165, 173, 182, 188, 198, 206, 213, 224}
+	_OpCode_index_4 = [...]uint8{0, 3, 8, 14, 21, 26, 32, 36, 41, 43, 48, 51, 59}
+	_OpCode_index_5 = [...]uint16{0, 5, 10, 15, 20, 25, 30, 35, 40, 45, 51, 57, 63, 69, 75, 81, 87, 93, 99, 105, 111, 117, 123, 129, 135, 141, 147, 153, 159, 165, 171, 177, 183, 187, 191, 195, 199, 203, 207, 211, 215, 219, 224, 229, 234, 239, 244, 249, 254, 259, 264, 269, 274, 279, 284, 289, 294, 299, 305, 311, 317, 323, 329, 335, 341, 345, 349, 353, 357, 361}
+	_OpCode_index_6 = [...]uint8{0, 6, 10, 18, 24, 36, 43}
+	_OpCode_index_8 = [...]uint8{0, 6, 13, 25}
 )
 
 func (i OpCode) String() string {
@@ -196,23 +198,25 @@ func (i OpCode) String() string {
 	case 16 <= i && i <= 29:
 		i -= 16
 		return _OpCode_name_1[_OpCode_index_1[i]:_OpCode_index_1[i+1]]
+	case i == 32:
+		return _OpCode_name_2
 	case 48 <= i && i <= 71:
 		i -= 48
-		return _OpCode_name_2[_OpCode_index_2[i]:_OpCode_index_2[i+1]]
+		return _OpCode_name_3[_OpCode_index_3[i]:_OpCode_index_3[i+1]]
 	case 80 <= i && i <= 91:
 		i -= 80
-		return _OpCode_name_3[_OpCode_index_3[i]:_OpCode_index_3[i+1]]
+		return _OpCode_name_4[_OpCode_index_4[i]:_OpCode_index_4[i+1]]
 	case 96 <= i && i <= 164:
 		i -= 96
-		return _OpCode_name_4[_OpCode_index_4[i]:_OpCode_index_4[i+1]]
+		return _OpCode_name_5[_OpCode_index_5[i]:_OpCode_index_5[i+1]]
 	case 240 <= i && i <= 245:
 		i -= 240
-		return _OpCode_name_5[_OpCode_index_5[i]:_OpCode_index_5[i+1]]
+		return _OpCode_name_6[_OpCode_index_6[i]:_OpCode_index_6[i+1]]
 	case i == 250:
-		return _OpCode_name_6
+		return _OpCode_name_7
 	case 253 <= i && i <= 255:
 		i -= 253
-		return _OpCode_name_7[_OpCode_index_7[i]:_OpCode_index_7[i+1]]
+		return _OpCode_name_8[_OpCode_index_8[i]:_OpCode_index_8[i+1]]
 	default:
 		return "OpCode(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
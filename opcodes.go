@@ -17,6 +17,8 @@
 
 package evm
 
+import "strings"
+
 // OpCode is the type of operation code
 //go:generate stringer -type=OpCode
 type OpCode byte
@@ -57,7 +59,7 @@ const (
 
 // 20s: SHA3
 const (
-	SHA3 = 0x20
+	SHA3 OpCode = 0x20
 )
 
 // 30s: Environmental Information
@@ -207,3 +209,44 @@ const (
 	INVALID      OpCode = 0xfe
 	SELFDESTRUCT OpCode = 0xff
 )
+
+// IsPush return if op is one of PUSH1...PUSH32
+func (op OpCode) IsPush() bool {
+	return op >= PUSH1 && op <= PUSH32
+}
+
+// PushSize return the size of immediate data of PUSH, and 0 if op is not PUSH
+func (op OpCode) PushSize() int {
+	if op.IsPush() {
+		return int(op-PUSH1) + 1
+	}
+	return 0
+}
+
+// IsDefined return if op is defined, INVALID is defined although it always aborts
+func (op OpCode) IsDefined() bool {
+	_, ok := opCodeNames[op]
+	return ok
+}
+
+// opCodeNames is the name of every defined opcode
+var opCodeNames = make(map[OpCode]string)
+
+// stringToOpCode is the opcode of every name
+var stringToOpCode = make(map[string]OpCode)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		op := OpCode(i)
+		if name := op.String(); !strings.HasPrefix(name, "OpCode(") {
+			opCodeNames[op] = name
+			stringToOpCode[name] = op
+		}
+	}
+}
+
+// StringToOpCode return the opcode of name, such as PUSH1 and SHA3
+func StringToOpCode(name string) (OpCode, bool) {
+	op, ok := stringToOpCode[name]
+	return op, ok
+}
@@ -0,0 +1,347 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package precompile
+
+import (
+	"errors"
+	"github.com/thu-arxan/evm/gas"
+	"math/big"
+
+	"github.com/thu-arxan/evm/crypto/bls12381"
+)
+
+// The precompile contracts of BLS12-381 defined in EIP-2537, which are added since Prague.
+// Every base field element is encoded in 64 bytes whose top 16 bytes are zero, an element
+// of Fp2 is encoded as c0 || c1, and a point is encoded as x || y where (0, 0) is the point
+// at infinity. The points of addition are only checked to be on curve, while the points of
+// multi-scalar multiplication and pairing should also be in the correct subgroup.
+
+const (
+	bls12381FpLength      = 64
+	bls12381G1PointLength = 128
+	bls12381G2PointLength = 256
+	bls12381ScalarLength  = 32
+)
+
+var (
+	errBLS12381InvalidInputLength          = errors.New("invalid input length")
+	errBLS12381InvalidFieldElementTopBytes = errors.New("invalid field element top bytes")
+	errBLS12381G1PointSubgroup             = errors.New("g1 point is not on correct subgroup")
+	errBLS12381G2PointSubgroup             = errors.New("g2 point is not on correct subgroup")
+)
+
+// bls12381G1MSMDiscount is the discount per mille of G1 multi-scalar
+// multiplication with k pairs at k-1, and the last one is used if k is larger
+var bls12381G1MSMDiscount = [128]uint64{1000, 949, 848, 797, 764, 750, 738, 728, 719, 712, 705, 698, 692, 687, 682, 677, 673, 669, 665, 661, 658, 654, 651, 648, 645, 642, 640, 637, 635, 632, 630, 627, 625, 623, 621, 619, 617, 615, 613, 611, 609, 608, 606, 604, 603, 601, 599, 598, 596, 595, 593, 592, 591, 589, 588, 586, 585, 584, 582, 581, 580, 579, 577, 576, 575, 574, 573, 572, 570, 569, 568, 567, 566, 565, 564, 563, 562, 561, 560, 559, 558, 557, 556, 555, 554, 553, 552, 551, 550, 549, 548, 547, 547, 546, 545, 544, 543, 542, 541, 540, 540, 539, 538, 537, 536, 536, 535, 534, 533, 532, 532, 531, 530, 529, 528, 528, 527, 526, 525, 525, 524, 523, 522, 522, 521, 520, 520, 519}
+
+// bls12381G2MSMDiscount is the discount per mille of G2 multi-scalar multiplication
+var bls12381G2MSMDiscount = [128]uint64{1000, 1000, 923, 884, 855, 832, 812, 796, 782, 770, 759, 749, 740, 732, 724, 717, 711, 704, 699, 693, 688, 683, 679, 674, 670, 666, 663, 659, 655, 652, 649, 646, 643, 640, 637, 634, 632, 629, 627, 624, 622, 620, 618, 615, 613, 611, 609, 607, 606, 604, 602, 600, 598, 597, 595, 593, 592, 590, 589, 587, 586, 584, 583, 582, 580, 579, 578, 576, 575, 574, 573, 571, 570, 569, 568, 567, 566, 565, 563, 562, 561, 560, 559, 558, 557, 556, 555, 554, 553, 552, 552, 551, 550, 549, 548, 547, 546, 545, 545, 544, 543, 542, 541, 541, 540, 539, 538, 537, 537, 536, 535, 535, 534, 533, 532, 532, 531, 530, 530, 529, 528, 528, 527, 526, 526, 525, 524, 524}
+
+// msmGas return the gas of multi-scalar multiplication with k pairs
+func msmGas(k, mulGas uint64, discounts *[128]uint64) uint64 {
+	if k == 0 {
+		return 0
+	}
+	discount := discounts[len(discounts)-1]
+	if k <= uint64(len(discounts)) {
+		discount = discounts[k-1]
+	}
+	return k * mulGas * discount / 1000
+}
+
+// bls12381G1Add implements EIP-2537 G1ADD at 0x0b
+type bls12381G1Add struct{}
+
+func (c *bls12381G1Add) RequiredGas(input []byte) uint64 {
+	return gas.Bls12381G1Add
+}
+
+func (c *bls12381G1Add) Run(input []byte) ([]byte, error) {
+	if len(input) != 2*bls12381G1PointLength {
+		return nil, errBLS12381InvalidInputLength
+	}
+	g := bls12381.NewG1()
+	p0, err := decodeBLS12381G1(g, input[:bls12381G1PointLength])
+	if err != nil {
+		return nil, err
+	}
+	p1, err := decodeBLS12381G1(g, input[bls12381G1PointLength:])
+	if err != nil {
+		return nil, err
+	}
+	r := g.New()
+	g.Add(r, p0, p1)
+	return encodeBLS12381G1(g, r), nil
+}
+
+// bls12381G1MSM implements EIP-2537 G1MSM at 0x0c
+type bls12381G1MSM struct{}
+
+func (c *bls12381G1MSM) RequiredGas(input []byte) uint64 {
+	k := uint64(len(input) / (bls12381G1PointLength + bls12381ScalarLength))
+	return msmGas(k, gas.Bls12381G1Mul, &bls12381G1MSMDiscount)
+}
+
+func (c *bls12381G1MSM) Run(input []byte) ([]byte, error) {
+	const pairLength = bls12381G1PointLength + bls12381ScalarLength
+	k := len(input) / pairLength
+	if len(input) == 0 || len(input)%pairLength != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	g := bls12381.NewG1()
+	points := make([]*bls12381.PointG1, k)
+	scalars := make([]*big.Int, k)
+	for i := 0; i < k; i++ {
+		offset := i * pairLength
+		p, err := decodeBLS12381G1(g, input[offset:offset+bls12381G1PointLength])
+		if err != nil {
+			return nil, err
+		}
+		if !g.InCorrectSubgroup(p) {
+			return nil, errBLS12381G1PointSubgroup
+		}
+		points[i] = p
+		scalars[i] = decodeBLS12381Scalar(g.Q(), input[offset+bls12381G1PointLength:offset+pairLength])
+	}
+	r := g.New()
+	if k == 1 {
+		g.MulScalarBig(r, points[0], scalars[0])
+	} else if _, err := g.MultiExpBig(r, points, scalars); err != nil {
+		return nil, err
+	}
+	return encodeBLS12381G1(g, r), nil
+}
+
+// bls12381G2Add implements EIP-2537 G2ADD at 0x0d
+type bls12381G2Add struct{}
+
+func (c *bls12381G2Add) RequiredGas(input []byte) uint64 {
+	return gas.Bls12381G2Add
+}
+
+func (c *bls12381G2Add) Run(input []byte) ([]byte, error) {
+	if len(input) != 2*bls12381G2PointLength {
+		return nil, errBLS12381InvalidInputLength
+	}
+	g := bls12381.NewG2()
+	p0, err := decodeBLS12381G2(g, input[:bls12381G2PointLength])
+	if err != nil {
+		return nil, err
+	}
+	p1, err := decodeBLS12381G2(g, input[bls12381G2PointLength:])
+	if err != nil {
+		return nil, err
+	}
+	r := g.New()
+	g.Add(r, p0, p1)
+	return encodeBLS12381G2(g, r), nil
+}
+
+// bls12381G2MSM implements EIP-2537 G2MSM at 0x0e
+type bls12381G2MSM struct{}
+
+func (c *bls12381G2MSM) RequiredGas(input []byte) uint64 {
+	k := uint64(len(input) / (bls12381G2PointLength + bls12381ScalarLength))
+	return msmGas(k, gas.Bls12381G2Mul, &bls12381G2MSMDiscount)
+}
+
+func (c *bls12381G2MSM) Run(input []byte) ([]byte, error) {
+	const pairLength = bls12381G2PointLength + bls12381ScalarLength
+	k := len(input) / pairLength
+	if len(input) == 0 || len(input)%pairLength != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	g := bls12381.NewG2()
+	points := make([]*bls12381.PointG2, k)
+	scalars := make([]*big.Int, k)
+	for i := 0; i < k; i++ {
+		offset := i * pairLength
+		p, err := decodeBLS12381G2(g, input[offset:offset+bls12381G2PointLength])
+		if err != nil {
+			return nil, err
+		}
+		if !g.InCorrectSubgroup(p) {
+			return nil, errBLS12381G2PointSubgroup
+		}
+		points[i] = p
+		scalars[i] = decodeBLS12381Scalar(g.Q(), input[offset+bls12381G2PointLength:offset+pairLength])
+	}
+	r := g.New()
+	if k == 1 {
+		g.MulScalarBig(r, points[0], scalars[0])
+	} else if _, err := g.MultiExpBig(r, points, scalars); err != nil {
+		return nil, err
+	}
+	return encodeBLS12381G2(g, r), nil
+}
+
+// bls12381Pairing implements EIP-2537 PAIRING_CHECK at 0x0f
+type bls12381Pairing struct{}
+
+func (c *bls12381Pairing) RequiredGas(input []byte) uint64 {
+	k := uint64(len(input) / (bls12381G1PointLength + bls12381G2PointLength))
+	return gas.Bls12381PairingBase + k*gas.Bls12381PairingPerPair
+}
+
+func (c *bls12381Pairing) Run(input []byte) ([]byte, error) {
+	const pairLength = bls12381G1PointLength + bls12381G2PointLength
+	k := len(input) / pairLength
+	if len(input) == 0 || len(input)%pairLength != 0 {
+		return nil, errBLS12381InvalidInputLength
+	}
+	e := bls12381.NewEngine()
+	for i := 0; i < k; i++ {
+		offset := i * pairLength
+		p1, err := decodeBLS12381G1(e.G1, input[offset:offset+bls12381G1PointLength])
+		if err != nil {
+			return nil, err
+		}
+		p2, err := decodeBLS12381G2(e.G2, input[offset+bls12381G1PointLength:offset+pairLength])
+		if err != nil {
+			return nil, err
+		}
+		if !e.G1.InCorrectSubgroup(p1) {
+			return nil, errBLS12381G1PointSubgroup
+		}
+		if !e.G2.InCorrectSubgroup(p2) {
+			return nil, errBLS12381G2PointSubgroup
+		}
+		e.AddPair(p1, p2)
+	}
+	var output = make([]byte, 32)
+	if e.Check() {
+		output[31] = 1
+	}
+	return output, nil
+}
+
+// bls12381MapG1 implements EIP-2537 MAP_FP_TO_G1 at 0x10
+type bls12381MapG1 struct{}
+
+func (c *bls12381MapG1) RequiredGas(input []byte) uint64 {
+	return gas.Bls12381MapG1
+}
+
+func (c *bls12381MapG1) Run(input []byte) ([]byte, error) {
+	if len(input) != bls12381FpLength {
+		return nil, errBLS12381InvalidInputLength
+	}
+	fe, err := decodeBLS12381Fp(input)
+	if err != nil {
+		return nil, err
+	}
+	g := bls12381.NewG1()
+	r, err := g.MapToCurve(fe)
+	if err != nil {
+		return nil, err
+	}
+	return encodeBLS12381G1(g, r), nil
+}
+
+// bls12381MapG2 implements EIP-2537 MAP_FP2_TO_G2 at 0x11
+type bls12381MapG2 struct{}
+
+func (c *bls12381MapG2) RequiredGas(input []byte) uint64 {
+	return gas.Bls12381MapG2
+}
+
+func (c *bls12381MapG2) Run(input []byte) ([]byte, error) {
+	if len(input) != 2*bls12381FpLength {
+		return nil, errBLS12381InvalidInputLength
+	}
+	fe, err := decodeBLS12381Fp2(input)
+	if err != nil {
+		return nil, err
+	}
+	g := bls12381.NewG2()
+	r, err := g.MapToCurve(fe)
+	if err != nil {
+		return nil, err
+	}
+	return encodeBLS12381G2(g, r), nil
+}
+
+// decodeBLS12381Fp return the 48 bytes of a field element encoded in 64 bytes,
+// and whether it is less than the modulus is checked by bls12381
+func decodeBLS12381Fp(in []byte) ([]byte, error) {
+	if !allZero(in[:16]) {
+		return nil, errBLS12381InvalidFieldElementTopBytes
+	}
+	return in[16:], nil
+}
+
+// decodeBLS12381Fp2 return an element of Fp2 in the c1 || c0 order of bls12381
+func decodeBLS12381Fp2(in []byte) ([]byte, error) {
+	c0, err := decodeBLS12381Fp(in[:bls12381FpLength])
+	if err != nil {
+		return nil, err
+	}
+	c1, err := decodeBLS12381Fp(in[bls12381FpLength:])
+	if err != nil {
+		return nil, err
+	}
+	return append(append(make([]byte, 0, 96), c1...), c0...), nil
+}
+
+func decodeBLS12381Scalar(q *big.Int, in []byte) *big.Int {
+	// the points are in the subgroup of order q, so the scalar could be reduced
+	return new(big.Int).Mod(new(big.Int).SetBytes(in), q)
+}
+
+func decodeBLS12381G1(g *bls12381.G1, in []byte) (*bls12381.PointG1, error) {
+	x, err := decodeBLS12381Fp(in[:bls12381FpLength])
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBLS12381Fp(in[bls12381FpLength:])
+	if err != nil {
+		return nil, err
+	}
+	return g.FromBytes(append(append(make([]byte, 0, 96), x...), y...))
+}
+
+func decodeBLS12381G2(g *bls12381.G2, in []byte) (*bls12381.PointG2, error) {
+	x, err := decodeBLS12381Fp2(in[:2*bls12381FpLength])
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBLS12381Fp2(in[2*bls12381FpLength:])
+	if err != nil {
+		return nil, err
+	}
+	return g.FromBytes(append(x, y...))
+}
+
+func encodeBLS12381G1(g *bls12381.G1, p *bls12381.PointG1) []byte {
+	out := g.ToBytes(p)
+	var output = make([]byte, bls12381G1PointLength)
+	copy(output[16:64], out[:48])
+	copy(output[80:], out[48:])
+	return output
+}
+
+// encodeBLS12381G2 convert c1 || c0 of bls12381 into c0 || c1
+func encodeBLS12381G2(g *bls12381.G2, p *bls12381.PointG2) []byte {
+	out := g.ToBytes(p)
+	var output = make([]byte, bls12381G2PointLength)
+	copy(output[16:64], out[48:96])
+	copy(output[80:128], out[:48])
+	copy(output[144:192], out[144:])
+	copy(output[208:], out[96:144])
+	return output
+}
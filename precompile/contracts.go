@@ -27,48 +27,26 @@ type Contract interface {
 	Run(input []byte) ([]byte, error) // Run runs the precompiled contract
 }
 
-// IsPrecompile return if an address is precompile contract
-func IsPrecompile(address []byte) bool {
-	if len(address) == 0 {
-		return false
-	}
-	for i := 0; i < len(address)-1; i++ {
-		if address[i] != 0 {
-			return false
-		}
-	}
-	b := address[len(address)-1]
-	if b >= 1 && b <= 9 {
-		return true
-	}
-	return false
+// forkSets is only used by IsPrecompile and New, so they should never be modified
+var forkSets = map[Fork]*Set{
+	Frontier:  ForkSet(Frontier),
+	Byzantium: ForkSet(Byzantium),
+	Istanbul:  ForkSet(Istanbul),
+	Berlin:    ForkSet(Berlin),
+	Prague:    ForkSet(Prague),
 }
 
-// New is the constructor of precompile contract
-func New(address []byte) (Contract, error) {
-	if !IsPrecompile(address) {
+// IsPrecompile return if an address is a precompile contract of ethereum at fork
+func IsPrecompile(address []byte, fork Fork) bool {
+	_, ok := forkSets[fork].Get(address)
+	return ok
+}
+
+// New is the constructor of precompile contract of ethereum at fork
+func New(address []byte, fork Fork) (Contract, error) {
+	contract, ok := forkSets[fork].Get(address)
+	if !ok {
 		return nil, errors.New("Not a precompile contract")
 	}
-	switch address[len(address)-1] {
-	case 1:
-		return &ecrecover{}, nil
-	case 2:
-		return &sha256hash{}, nil
-	case 3:
-		return &ripemd160hash{}, nil
-	case 4:
-		return &dataCopy{}, nil
-	case 5:
-		return &bigModExp{}, nil
-	case 6:
-		return &bn256AddIstanbul{}, nil
-	case 7:
-		return &bn256ScalarMulIstanbul{}, nil
-	case 8:
-		return &bn256PairingIstanbul{}, nil
-	case 9:
-		return &blake2F{}, nil
-	default:
-		return nil, errors.New("Not implementation yet")
-	}
+	return contract, nil
 }
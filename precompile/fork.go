@@ -0,0 +1,120 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package precompile
+
+import "fmt"
+
+// Fork is a hard fork of ethereum which changes the precompile contracts or their gas
+type Fork int
+
+// The forks are ordered by time, and forks which do not change the precompile
+// contracts are parsed as the last fork before them
+const (
+	// Frontier has ecrecover, sha256, ripemd160 and identity at 0x01...0x04
+	Frontier Fork = iota
+	// Byzantium adds modexp of EIP-198 and bn256 add, scalar mul and pairing at 0x05...0x08
+	Byzantium
+	// Istanbul reprices bn256 by EIP-1108 and adds blake2f of EIP-152 at 0x09
+	Istanbul
+	// Berlin reprices modexp by EIP-2565
+	Berlin
+	// Prague adds the BLS12-381 contracts of EIP-2537 at 0x0b...0x11
+	Prague
+)
+
+var forkNames = map[Fork]string{
+	Frontier:  "Frontier",
+	Byzantium: "Byzantium",
+	Istanbul:  "Istanbul",
+	Berlin:    "Berlin",
+	Prague:    "Prague",
+}
+
+var forkAliases = map[string]Fork{
+	"Frontier":          Frontier,
+	"Homestead":         Frontier,
+	"EIP150":            Frontier,
+	"EIP158":            Frontier,
+	"Byzantium":         Byzantium,
+	"Constantinople":    Byzantium,
+	"ConstantinopleFix": Byzantium,
+	"Petersburg":        Byzantium,
+	"Istanbul":          Istanbul,
+	"MuirGlacier":       Istanbul,
+	"Berlin":            Berlin,
+	"London":            Berlin,
+	"ArrowGlacier":      Berlin,
+	"GrayGlacier":       Berlin,
+	"Merge":             Berlin,
+	"Paris":             Berlin,
+	"Shanghai":          Berlin,
+	// the point evaluation contract of EIP-4844 at 0x0a is not supported
+	"Cancun": Berlin,
+	"Prague": Prague,
+}
+
+// ParseFork parse the fork name used by geth and ethereum tests, such as Istanbul and London
+func ParseFork(name string) (Fork, error) {
+	fork, ok := forkAliases[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported fork %s", name)
+	}
+	return fork, nil
+}
+
+func (fork Fork) String() string {
+	if name, ok := forkNames[fork]; ok {
+		return name
+	}
+	return fmt.Sprintf("Fork(%d)", int(fork))
+}
+
+// ForkSet return a set of the precompile contracts of ethereum at fork, which
+// are priced by the rules of fork
+func ForkSet(fork Fork) *Set {
+	var set = NewSet()
+	set.Replace([]byte{1}, &ecrecover{})
+	set.Replace([]byte{2}, &sha256hash{})
+	set.Replace([]byte{3}, &ripemd160hash{})
+	set.Replace([]byte{4}, &dataCopy{})
+	if fork < Byzantium {
+		return set
+	}
+	set.Replace([]byte{5}, &bigModExp{eip2565: fork >= Berlin})
+	if fork < Istanbul {
+		set.Replace([]byte{6}, &bn256AddByzantium{})
+		set.Replace([]byte{7}, &bn256ScalarMulByzantium{})
+		set.Replace([]byte{8}, &bn256PairingByzantium{})
+		return set
+	}
+	set.Replace([]byte{6}, &bn256AddIstanbul{})
+	set.Replace([]byte{7}, &bn256ScalarMulIstanbul{})
+	set.Replace([]byte{8}, &bn256PairingIstanbul{})
+	set.Replace([]byte{9}, &blake2F{})
+	if fork < Prague {
+		return set
+	}
+	set.Replace([]byte{0x0b}, &bls12381G1Add{})
+	set.Replace([]byte{0x0c}, &bls12381G1MSM{})
+	set.Replace([]byte{0x0d}, &bls12381G2Add{})
+	set.Replace([]byte{0x0e}, &bls12381G2MSM{})
+	set.Replace([]byte{0x0f}, &bls12381Pairing{})
+	set.Replace([]byte{0x10}, &bls12381MapG1{})
+	set.Replace([]byte{0x11}, &bls12381MapG2{})
+	return set
+}
@@ -0,0 +1,66 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package precompile
+
+import (
+	"github.com/thu-arxan/evm/gas"
+	"github.com/thu-arxan/evm/util"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+)
+
+// P256VerifyAddress is the address of P256VERIFY defined in RIP-7212, which
+// is not in DefaultSet
+var P256VerifyAddress = []byte{0x01, 0x00}
+
+// NewP256Verify return the P256VERIFY contract of RIP-7212, which verifies a
+// secp256r1 signature, such as signatures of passkeys.
+// The input is (hash, r, s, x, y), each 32 bytes, and it returns 1 as a word
+// if the signature is valid, or empty otherwise.
+func NewP256Verify() Contract {
+	return &p256Verify{}
+}
+
+type p256Verify struct{}
+
+func (c *p256Verify) RequiredGas(input []byte) uint64 {
+	return gas.P256Verify
+}
+
+func (c *p256Verify) Run(input []byte) ([]byte, error) {
+	const p256VerifyInputLength = 160
+	if len(input) != p256VerifyInputLength {
+		return nil, nil
+	}
+	curve := elliptic.P256()
+	x := new(big.Int).SetBytes(input[96:128])
+	y := new(big.Int).SetBytes(input[128:160])
+	// the point at infinity(0, 0) is not on curve
+	if !curve.IsOnCurve(x, y) {
+		return nil, nil
+	}
+	r := new(big.Int).SetBytes(input[32:64])
+	s := new(big.Int).SetBytes(input[64:96])
+	pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	// Verify returns false if r or s is not in [1, n-1]
+	if !ecdsa.Verify(pub, input[:32], r, s) {
+		return nil, nil
+	}
+	return util.LeftPadBytes([]byte{1}, 32), nil
+}
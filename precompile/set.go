@@ -0,0 +1,102 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package precompile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Set is a set of precompile contracts keyed by address, it could be registered
+// on an EVM to add, replace or disable precompile contracts.
+// Note: The leading zeros of address are ignored, so 0x01 is the same with
+// 0x0000000000000000000000000000000000000001 whatever the length of Address is.
+// Set is not thread safety.
+type Set struct {
+	contracts map[string]Contract
+}
+
+// NewSet return an empty set
+func NewSet() *Set {
+	return &Set{
+		contracts: make(map[string]Contract),
+	}
+}
+
+// DefaultSet return a set of the precompile contracts of ethereum at 0x01...0x09,
+// which are priced by the rules of Istanbul
+func DefaultSet() *Set {
+	return ForkSet(Istanbul)
+}
+
+// Add add a contract at address, and return an error if there is already one
+func (s *Set) Add(address []byte, contract Contract) error {
+	if _, ok := s.Get(address); ok {
+		return fmt.Errorf("precompile contract at 0x%x already exists", address)
+	}
+	s.Replace(address, contract)
+	return nil
+}
+
+// Replace set the contract at address whether there is already one or not
+func (s *Set) Replace(address []byte, contract Contract) {
+	s.contracts[setKey(address)] = contract
+}
+
+// Remove disable the contract at address, and the address will be called as a normal account
+func (s *Set) Remove(address []byte) {
+	delete(s.contracts, setKey(address))
+}
+
+// Get return the contract at address
+func (s *Set) Get(address []byte) (Contract, bool) {
+	if s == nil {
+		return nil, false
+	}
+	contract, ok := s.contracts[setKey(address)]
+	return contract, ok
+}
+
+// Addresses return addresses of all contracts without leading zeros in ascending order
+func (s *Set) Addresses() [][]byte {
+	var addresses = make([][]byte, 0, len(s.contracts))
+	for key := range s.contracts {
+		addresses = append(addresses, []byte(key))
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if len(addresses[i]) != len(addresses[j]) {
+			return len(addresses[i]) < len(addresses[j])
+		}
+		return bytes.Compare(addresses[i], addresses[j]) < 0
+	})
+	return addresses
+}
+
+// Copy return a copy of set, and the contracts are shared
+func (s *Set) Copy() *Set {
+	var set = NewSet()
+	for key, contract := range s.contracts {
+		set.contracts[key] = contract
+	}
+	return set
+}
+
+func setKey(address []byte) string {
+	return string(bytes.TrimLeft(address, "\x00"))
+}
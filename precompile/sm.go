@@ -0,0 +1,130 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package precompile
+
+import (
+	"github.com/thu-arxan/evm/crypto/sm2"
+	"github.com/thu-arxan/evm/crypto/sm3"
+	"github.com/thu-arxan/evm/gas"
+	"github.com/thu-arxan/evm/util"
+	"crypto/ecdsa"
+	"math/big"
+)
+
+// The addresses of the Chinese commercial cryptography contracts, which are
+// not in DefaultSet and should be added by AddSM
+var (
+	SM3Address        = []byte{0x0a, 0x01}
+	SM2VerifyAddress  = []byte{0x0a, 0x02}
+	SM2RecoverAddress = []byte{0x0a, 0x03}
+)
+
+// AddSM add the SM3, SM2 verify and SM2 recover contracts into set
+func AddSM(set *Set) error {
+	if err := set.Add(SM3Address, NewSM3()); err != nil {
+		return err
+	}
+	if err := set.Add(SM2VerifyAddress, NewSM2Verify()); err != nil {
+		return err
+	}
+	return set.Add(SM2RecoverAddress, NewSM2Recover())
+}
+
+// NewSM3 return the contract which returns the SM3 hash of input
+func NewSM3() Contract {
+	return &sm3hash{}
+}
+
+// NewSM2Verify return the contract which verifies a SM2 signature given the public key.
+// The input is (digest, r, s, x, y), each 32 bytes, and the digest should be SM3(ZA || msg).
+// It returns 1 as a word if the signature is valid, or empty otherwise.
+func NewSM2Verify() Contract {
+	return &sm2Verify{}
+}
+
+// NewSM2Recover return the contract which recovers the SM2 public key from a signature.
+// The input is (digest, v, r, s) like ecrecover, v is 0, 1, 27 or 28 and the
+// bit of 2 in v means x1 is larger than n.
+// It returns x || y of the public key, or empty if the signature is invalid.
+func NewSM2Recover() Contract {
+	return &sm2Recover{}
+}
+
+type sm3hash struct{}
+
+func (c *sm3hash) RequiredGas(input []byte) uint64 {
+	return uint64(len(input)+31)/32*gas.Sm3PerWord + gas.Sm3Base
+}
+
+func (c *sm3hash) Run(input []byte) ([]byte, error) {
+	h := sm3.Sum(input)
+	return h[:], nil
+}
+
+type sm2Verify struct{}
+
+func (c *sm2Verify) RequiredGas(input []byte) uint64 {
+	return gas.Sm2Verify
+}
+
+func (c *sm2Verify) Run(input []byte) ([]byte, error) {
+	const sm2VerifyInputLength = 160
+	if len(input) != sm2VerifyInputLength {
+		return nil, nil
+	}
+	pub := &ecdsa.PublicKey{
+		Curve: sm2.P256(),
+		X:     new(big.Int).SetBytes(input[96:128]),
+		Y:     new(big.Int).SetBytes(input[128:160]),
+	}
+	r := new(big.Int).SetBytes(input[32:64])
+	s := new(big.Int).SetBytes(input[64:96])
+	if !sm2.Verify(pub, input[:32], r, s) {
+		return nil, nil
+	}
+	return util.LeftPadBytes([]byte{1}, 32), nil
+}
+
+type sm2Recover struct{}
+
+func (c *sm2Recover) RequiredGas(input []byte) uint64 {
+	return gas.Sm2Recover
+}
+
+func (c *sm2Recover) Run(input []byte) ([]byte, error) {
+	const sm2RecoverInputLength = 128
+
+	input = util.RightPadBytes(input, sm2RecoverInputLength)
+	v := input[63]
+	if v >= 27 {
+		v -= 27
+	}
+	if !allZero(input[32:63]) || v > 3 {
+		return nil, nil
+	}
+	r := new(big.Int).SetBytes(input[64:96])
+	s := new(big.Int).SetBytes(input[96:128])
+	pub, err := sm2.Recover(input[:32], r, s, v)
+	if err != nil {
+		return nil, nil
+	}
+	var output = make([]byte, 64)
+	pub.X.FillBytes(output[:32])
+	pub.Y.FillBytes(output[32:])
+	return output, nil
+}
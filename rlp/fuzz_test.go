@@ -0,0 +1,103 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package rlp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fuzzStruct struct {
+	A uint64
+	B *big.Int
+	C []byte
+	D []string
+	E [4]byte
+	F bool
+	G []RawValue `rlp:"tail"`
+}
+
+// FuzzDecode decodes arbitrary data into an interface and a struct, and the values
+// decoded should be encoded to the same data. The seed corpus is made of the
+// binaries of contracts in tests/sols, which are encoded as strings and lists.
+// Note: Run it by go test -run=^$ -fuzz=FuzzDecode ./rlp
+func FuzzDecode(f *testing.F) {
+	files, err := filepath.Glob("../tests/sols/*.bin")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		bin, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(bin) == 0 {
+			continue
+		}
+		f.Add(mustEncode(f, bin))
+		f.Add(mustEncode(f, []interface{}{bin[:len(bin)/2], [][]byte{bin[len(bin)/2:], {}}, uint64(len(bin))}))
+		f.Add(mustEncode(f, &fuzzStruct{
+			A: uint64(len(bin)),
+			B: new(big.Int).SetBytes(bin[:len(bin)/8]),
+			C: bin,
+			D: []string{file},
+			F: true,
+		}))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v interface{}
+		if err := DecodeBytes(data, &v); err == nil {
+			enc, err := EncodeToBytes(v)
+			if err != nil {
+				t.Fatalf("failed to encode %v: %v", v, err)
+			}
+			if !bytes.Equal(data, enc) {
+				t.Fatalf("encode %x after decode as %x", data, enc)
+			}
+		}
+		var s fuzzStruct
+		if err := DecodeBytes(data, &s); err == nil {
+			enc, err := EncodeToBytes(&s)
+			if err != nil {
+				t.Fatalf("failed to encode %+v: %v", s, err)
+			}
+			var again fuzzStruct
+			if err := DecodeBytes(enc, &again); err != nil {
+				t.Fatalf("failed to decode %x: %v", enc, err)
+			}
+			if !reflect.DeepEqual(s, again) {
+				t.Fatalf("decode %+v after encode %+v", again, s)
+			}
+		}
+	})
+}
+
+func mustEncode(f *testing.F, val interface{}) []byte {
+	data, err := EncodeToBytes(val)
+	if err != nil {
+		f.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,79 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package srcmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/thu-arxan/evm/util"
+)
+
+// Contract is a contract in the combined json output of solc
+type Contract struct {
+	BinRuntime    string `json:"bin-runtime"`
+	SrcMapRuntime string `json:"srcmap-runtime"`
+}
+
+// Combined is the output of solc --combined-json bin-runtime,srcmap-runtime
+type Combined struct {
+	// Contracts is keyed by File.sol:Name
+	Contracts  map[string]*Contract `json:"contracts"`
+	SourceList []string             `json:"sourceList"`
+}
+
+// ParseCombined parses the combined json output of solc
+func ParseCombined(data []byte) (*Combined, error) {
+	var combined Combined
+	if err := json.Unmarshal(data, &combined); err != nil {
+		return nil, err
+	}
+	return &combined, nil
+}
+
+// LoadSources read the source list from dir, which is the directory solc runs in
+func (c *Combined) LoadSources(dir string) ([]*Source, error) {
+	var sources = make([]*Source, len(c.SourceList))
+	for i, name := range c.SourceList {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, name)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = NewSource(name, string(content))
+	}
+	return sources, nil
+}
+
+// Mapper return the mapper of a contract which is named as File.sol:Name
+func (c *Combined) Mapper(name string, sources []*Source) (*Mapper, error) {
+	contract, ok := c.Contracts[name]
+	if !ok {
+		return nil, fmt.Errorf("contract %s is not found", name)
+	}
+	code, err := util.HexToBytes(contract.BinRuntime)
+	if err != nil {
+		return nil, err
+	}
+	return NewMapper(code, contract.SrcMapRuntime, sources)
+}
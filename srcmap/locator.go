@@ -0,0 +1,138 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package srcmap
+
+import (
+	"fmt"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/crypto"
+)
+
+// Failure records an opcode which fails the execution of a frame
+type Failure struct {
+	Depth int
+	PC    uint64
+	Op    evm.OpCode
+	Err   error
+	// Location is nil if the code or pc is not mapped
+	Location *Location
+}
+
+// String return the location of failure, or the pc if it is not mapped
+func (f *Failure) String() string {
+	if f.Location != nil {
+		return f.Location.String()
+	}
+	return fmt.Sprintf("pc %d(%s)", f.PC, f.Op)
+}
+
+// Error is an execution error with the locations where it happens
+type Error struct {
+	Err error
+	// Failures is in the order of happening, so the inner frame fails first
+	Failures []*Failure
+}
+
+// Error is the implementation of error
+func (e *Error) Error() string {
+	last := e.Failures[len(e.Failures)-1]
+	if first := e.Failures[0]; first != last && first.Location != nil {
+		return fmt.Sprintf("%v at %s (from %s)", e.Err, last, first)
+	}
+	return fmt.Sprintf("%v at %s", e.Err, last)
+}
+
+// Unwrap return the error of execution
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Locator is a tracer which records where the execution fails, and it could
+// map the pc to source location if the mapper of code is added.
+// Note: Locator is not thread safety.
+type Locator struct {
+	mappers  map[string]*Mapper
+	frames   []*Mapper
+	failures []*Failure
+}
+
+// NewLocator is the constructor of Locator
+func NewLocator() *Locator {
+	return &Locator{
+		mappers: make(map[string]*Mapper),
+	}
+}
+
+// AddMapper add the mapper of code, which is the deployed bytecode
+func (l *Locator) AddMapper(code []byte, mapper *Mapper) {
+	l.mappers[string(crypto.Keccak256(code))] = mapper
+}
+
+// Failures return the failures of the last traced execution
+func (l *Locator) Failures() []*Failure {
+	return l.failures
+}
+
+// Wrap return an *Error which contains the failures if err is not nil,
+// and it returns err directly if no failure is recorded
+func (l *Locator) Wrap(err error) error {
+	if err == nil || len(l.failures) == 0 {
+		return err
+	}
+	return &Error{
+		Err:      err,
+		Failures: l.failures,
+	}
+}
+
+// CaptureEnter is the implementation of evm.Tracer
+func (l *Locator) CaptureEnter(frame *evm.Frame) {
+	if frame.Depth <= 1 {
+		l.failures = nil
+		l.frames = l.frames[:0]
+	}
+	l.frames = append(l.frames, l.mappers[string(crypto.Keccak256(frame.Code))])
+}
+
+// CaptureState is the implementation of evm.Tracer
+func (l *Locator) CaptureState(step *evm.Step) {}
+
+// CaptureStateEnd is the implementation of evm.Tracer
+func (l *Locator) CaptureStateEnd(step *evm.Step) {
+	if step.Err == nil || len(l.frames) == 0 {
+		return
+	}
+	var failure = &Failure{
+		Depth: step.Frame.Depth,
+		PC:    step.PC,
+		Op:    step.Op,
+		Err:   step.Err,
+	}
+	if mapper := l.frames[len(l.frames)-1]; mapper != nil {
+		failure.Location = mapper.Locate(step.PC)
+	}
+	l.failures = append(l.failures, failure)
+}
+
+// CaptureExit is the implementation of evm.Tracer
+func (l *Locator) CaptureExit(frame *evm.Frame, output []byte, gasUsed uint64, err error) {
+	if len(l.frames) > 0 {
+		l.frames = l.frames[:len(l.frames)-1]
+	}
+}
@@ -0,0 +1,253 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package srcmap
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thu-arxan/evm"
+)
+
+// Here defines the jump types of an entry
+const (
+	JumpIn      = 'i'
+	JumpOut     = 'o'
+	JumpRegular = '-'
+)
+
+// Entry is an item of solc source map, which describes the source range of an instruction
+type Entry struct {
+	Start  int
+	Length int
+	// File is the index in source list, and -1 means the instruction is not from any source
+	File int
+	// Jump is one of JumpIn, JumpOut and JumpRegular
+	Jump          byte
+	ModifierDepth int
+}
+
+// Parse parses the compressed source map of solc, such as srcmap-runtime.
+// Every entry is s:l:f:j:m and is separated by ';', and an empty or missing field
+// means the field is the same as the previous entry. The fields must not be
+// negative, except that the file is -1 for the code generated by solc.
+func Parse(srcmap string) ([]Entry, error) {
+	srcmap = strings.TrimSpace(srcmap)
+	if srcmap == "" {
+		return nil, nil
+	}
+	var items = strings.Split(srcmap, ";")
+	var entries = make([]Entry, len(items))
+	var prev = Entry{File: -1, Jump: JumpRegular}
+	for i, item := range items {
+		var entry = prev
+		fields := strings.Split(item, ":")
+		if len(fields) > 5 {
+			return nil, fmt.Errorf("entry %d has too many fields: %s", i, item)
+		}
+		for j, field := range fields {
+			if field == "" {
+				continue
+			}
+			if j == 3 {
+				if len(field) != 1 || (field[0] != JumpIn && field[0] != JumpOut && field[0] != JumpRegular) {
+					return nil, fmt.Errorf("entry %d has invalid jump type: %s", i, field)
+				}
+				entry.Jump = field[0]
+				continue
+			}
+			value, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d has invalid field %s: %v", i, field, err)
+			}
+			// only the file could be negative, which is -1 for the generated code
+			if value < 0 && !(j == 2 && value == -1) {
+				return nil, fmt.Errorf("entry %d has negative field %s", i, field)
+			}
+			switch j {
+			case 0:
+				entry.Start = value
+			case 1:
+				entry.Length = value
+			case 2:
+				entry.File = value
+			case 4:
+				entry.ModifierDepth = value
+			}
+		}
+		entries[i] = entry
+		prev = entry
+	}
+	return entries, nil
+}
+
+// InstructionIndexes return the instruction index of every pc of code,
+// and the index of a pc in PUSH data is -1
+func InstructionIndexes(code []byte) []int {
+	var indexes = make([]int, len(code))
+	var index = 0
+	for pc := 0; pc < len(code); pc++ {
+		indexes[pc] = index
+		op := evm.OpCode(code[pc])
+		if op >= evm.PUSH1 && op <= evm.PUSH32 {
+			for i := 0; i < int(op-evm.PUSH1)+1 && pc+1 < len(code); i++ {
+				pc++
+				indexes[pc] = -1
+			}
+		}
+		index++
+	}
+	return indexes
+}
+
+// Source is a source file
+type Source struct {
+	Name    string
+	Content string
+	// lines is the offset where every line begins
+	lines []int
+}
+
+// NewSource is the constructor of Source
+func NewSource(name, content string) *Source {
+	var lines = []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return &Source{
+		Name:    name,
+		Content: content,
+		lines:   lines,
+	}
+}
+
+// Position return the line and column of an offset, which begin from 1
+func (s *Source) Position(offset int) (line, column int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(s.Content) {
+		offset = len(s.Content)
+	}
+	line = sort.Search(len(s.lines), func(i int) bool {
+		return s.lines[i] > offset
+	})
+	return line, offset - s.lines[line-1] + 1
+}
+
+// Line return the text of a line without line break, which begin from 1
+func (s *Source) Line(line int) string {
+	if line < 1 || line > len(s.lines) {
+		return ""
+	}
+	end := len(s.Content)
+	if line < len(s.lines) {
+		end = s.lines[line] - 1
+	}
+	return strings.TrimSuffix(s.Content[s.lines[line-1]:end], "\r")
+}
+
+// Location is the source range of an instruction
+type Location struct {
+	File   string
+	Start  int
+	Length int
+	// Line and Column begin from 1
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+	Jump      byte
+	// Snippet is the source code of the range
+	Snippet string
+	// LineText is the whole line where the range begins
+	LineText string
+}
+
+// String return File.sol:line:col
+func (l *Location) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+}
+
+// Mapper maps pc of a deployed bytecode to source location
+type Mapper struct {
+	entries []Entry
+	indexes []int
+	sources []*Source
+}
+
+// NewMapper is the constructor of Mapper, sources should be in the order of
+// the source list of solc, and a nil source is allowed if it is not available
+func NewMapper(code []byte, srcmap string, sources []*Source) (*Mapper, error) {
+	entries, err := Parse(srcmap)
+	if err != nil {
+		return nil, err
+	}
+	return &Mapper{
+		entries: entries,
+		indexes: InstructionIndexes(code),
+		sources: sources,
+	}, nil
+}
+
+// Sources return the sources of mapper
+func (m *Mapper) Sources() []*Source {
+	return m.sources
+}
+
+// Entry return the source map entry of pc, and return false if pc is in PUSH
+// data, out of code or not covered by the source map(e.g. metadata)
+func (m *Mapper) Entry(pc uint64) (Entry, bool) {
+	if pc >= uint64(len(m.indexes)) {
+		return Entry{}, false
+	}
+	index := m.indexes[pc]
+	if index < 0 || index >= len(m.entries) {
+		return Entry{}, false
+	}
+	return m.entries[index], true
+}
+
+// Locate return the source location of pc, and return nil if the pc is not
+// mapped to any available source
+func (m *Mapper) Locate(pc uint64) *Location {
+	entry, ok := m.Entry(pc)
+	if !ok || entry.File < 0 || entry.File >= len(m.sources) || m.sources[entry.File] == nil {
+		return nil
+	}
+	source := m.sources[entry.File]
+	if entry.Start < 0 || entry.Length < 0 || entry.Length > len(source.Content)-entry.Start {
+		return nil
+	}
+	end := entry.Start + entry.Length
+	var location = &Location{
+		File:    source.Name,
+		Start:   entry.Start,
+		Length:  entry.Length,
+		Jump:    entry.Jump,
+		Snippet: source.Content[entry.Start:end],
+	}
+	location.Line, location.Column = source.Position(entry.Start)
+	location.EndLine, location.EndColumn = source.Position(end)
+	location.LineText = source.Line(location.Line)
+	return location
+}
@@ -0,0 +1,142 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package srcmap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/errors"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+var source = `contract A {
+    function f() public {
+        revert();
+    }
+}
+`
+
+// Note: The sample comes from https://docs.soliditylang.org/en/latest/internals/source_mappings.html
+func TestParse(t *testing.T) {
+	full, err := Parse("1:2:1;1:9:1;2:1:2;2:1:2;2:1:2")
+	require.NoError(t, err)
+	compressed, err := Parse("1:2:1;:9;2:1:2;;")
+	require.NoError(t, err)
+	require.Equal(t, full, compressed)
+	require.Len(t, compressed, 5)
+	require.Equal(t, Entry{Start: 2, Length: 1, File: 2, Jump: JumpRegular}, compressed[4])
+
+	entries, err := Parse("0:10:-1:i:1;::0:o")
+	require.NoError(t, err)
+	require.Equal(t, Entry{Start: 0, Length: 10, File: -1, Jump: JumpIn, ModifierDepth: 1}, entries[0])
+	require.Equal(t, Entry{Start: 0, Length: 10, File: 0, Jump: JumpOut, ModifierDepth: 1}, entries[1])
+
+	_, err = Parse("0:1:0:x")
+	require.Error(t, err)
+	_, err = Parse("a:1:0")
+	require.Error(t, err)
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, srcmap := range []string{"0:-1:0", "-1:1:0", "0:1:-2", "0:1:0:-:-1", "0:1:0;:-5", "0:1:0:-:1:2", "0:99999999999999999999:0"} {
+		_, err := Parse(srcmap)
+		require.Error(t, err, srcmap)
+	}
+}
+
+func TestLocateMalformed(t *testing.T) {
+	// the entries which are not made by Parse are checked too
+	mapper := &Mapper{
+		indexes: []int{0, 1, 2},
+		sources: []*Source{NewSource("A.sol", source)},
+		entries: []Entry{{Start: 0, Length: -1}, {Start: -1, Length: 1}, {Start: 1, Length: int(^uint(0) >> 1)}},
+	}
+	for pc := uint64(0); pc < 3; pc++ {
+		require.Nil(t, mapper.Locate(pc), pc)
+	}
+}
+
+func TestInstructionIndexes(t *testing.T) {
+	// PUSH2 0x0102 DUP1 PUSH1(truncated)
+	require.Equal(t, []int{0, -1, -1, 1, 2, -1}, InstructionIndexes(util.Hex2Bytes("610102806001")))
+	require.Equal(t, []int{0, -1}, InstructionIndexes(util.Hex2Bytes("6100")))
+}
+
+func TestLocate(t *testing.T) {
+	// PUSH1 0 PUSH1 0 REVERT INVALID(metadata)
+	code := util.Hex2Bytes("60006000fdfe")
+	mapper, err := NewMapper(code, "0:64:0;47:8;", []*Source{NewSource("A.sol", source)})
+	require.NoError(t, err)
+
+	location := mapper.Locate(0)
+	require.Equal(t, "A.sol:1:1", location.String())
+	require.Equal(t, 5, location.EndLine)
+	require.Equal(t, "contract A {", location.LineText)
+
+	location = mapper.Locate(4)
+	require.Equal(t, "A.sol:3:9", location.String())
+	require.Equal(t, "revert()", location.Snippet)
+	require.Equal(t, 3, location.EndLine)
+	require.Equal(t, 17, location.EndColumn)
+	require.Equal(t, "        revert();", location.LineText)
+
+	require.Nil(t, mapper.Locate(1))
+	require.Nil(t, mapper.Locate(5))
+	require.Nil(t, mapper.Locate(100))
+}
+
+func TestLocatorWrapRevert(t *testing.T) {
+	code := util.Hex2Bytes("60006000fd")
+	mapper, err := NewMapper(code, "0:64:0;47:8;", []*Source{NewSource("A.sol", source)})
+	require.NoError(t, err)
+	locator := NewLocator()
+	locator.AddMapper(code, mapper)
+
+	bc := example.NewBlockchain()
+	var gas uint64 = 100000
+	vm := evm.New(bc, db.NewMemory(bc.NewAccount), &evm.Context{
+		Gas: &gas,
+	})
+	vm.SetTracer(locator)
+	_, err = vm.Call(example.RandomAddress(), example.RandomAddress(), code)
+	require.Equal(t, errors.ExecutionReverted, err)
+	err = locator.Wrap(err)
+	require.Equal(t, "execution reverted at A.sol:3:9", err.Error())
+	require.Len(t, locator.Failures(), 1)
+	require.EqualValues(t, 4, locator.Failures()[0].PC)
+	require.Equal(t, errors.ExecutionReverted, err.(*Error).Unwrap())
+	require.Nil(t, locator.Wrap(nil))
+	require.Equal(t, "pc 4(REVERT)", fmt.Sprint(&Failure{PC: 4, Op: evm.REVERT}))
+}
+
+func TestCombined(t *testing.T) {
+	combined, err := ParseCombined([]byte(`{"contracts":{"A.sol:A":{"bin-runtime":"60006000fd","srcmap-runtime":"0:64:0;47:8;"}},"sourceList":["A.sol"],"version":"0.6.0"}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"A.sol"}, combined.SourceList)
+	mapper, err := combined.Mapper("A.sol:A", []*Source{NewSource("A.sol", source)})
+	require.NoError(t, err)
+	require.Equal(t, "A.sol:3:9", mapper.Locate(4).String())
+	_, err = combined.Mapper("A.sol:B", nil)
+	require.Error(t, err)
+}
@@ -181,6 +181,16 @@ func (st *Stack) Peek() core.Word256 {
 	return word
 }
 
+// Back return a copy of the nth element from the top of stack without popping it,
+// and 0 means the top. It returns nil if the stack does not have enough elements.
+// Note: Back will not push error, so it could be used by tracers.
+func (st *Stack) Back(n int) *big.Int {
+	if n < 0 || n >= st.ptr {
+		return nil
+	}
+	return new(big.Int).Set(st.data[st.ptr-1-n])
+}
+
 // Print print stack status
 func (st *Stack) Print(n int) {
 	fmt.Println("### stack ###")
@@ -0,0 +1,213 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/util"
+)
+
+// Account is the account in Alloc
+type Account struct {
+	Balance uint64
+	Nonce   uint64
+	Code    []byte
+	// Storage is keyed by the 32 bytes storage key
+	Storage map[core.Word256][]byte
+}
+
+// Alloc is the accounts keyed by address, which is encoded into json in the
+// format of geth genesis alloc, such as
+//
+//	{"0x...": {"balance": "0x1", "nonce": "0x0", "code": "0x6000", "storage": {"0x00": "0x01"}}}
+type Alloc map[string]*Account
+
+type jsonAccount struct {
+	Balance json.RawMessage   `json:"balance,omitempty"`
+	Nonce   json.RawMessage   `json:"nonce,omitempty"`
+	Code    string            `json:"code,omitempty"`
+	Storage map[string]string `json:"storage,omitempty"`
+}
+
+// MarshalJSON is the implementation of json.Marshaler
+func (a *Account) MarshalJSON() ([]byte, error) {
+	var account = jsonAccount{
+		Balance: json.RawMessage(strconv.Quote(fmt.Sprintf("0x%x", a.Balance))),
+		Nonce:   json.RawMessage(strconv.Quote(fmt.Sprintf("0x%x", a.Nonce))),
+	}
+	if len(a.Code) > 0 {
+		account.Code = "0x" + hex.EncodeToString(a.Code)
+	}
+	if len(a.Storage) > 0 {
+		account.Storage = make(map[string]string)
+		for key, value := range a.Storage {
+			account.Storage["0x"+hex.EncodeToString(key.Bytes())] = "0x" + hex.EncodeToString(util.LeftPadBytes(value, 32))
+		}
+	}
+	return json.Marshal(account)
+}
+
+// UnmarshalJSON is the implementation of json.Unmarshaler, the number could
+// be a json number, a decimal string or a hex string begins with 0x
+func (a *Account) UnmarshalJSON(data []byte) (err error) {
+	var account jsonAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return err
+	}
+	if a.Balance, err = ParseUint64(account.Balance); err != nil {
+		return fmt.Errorf("invalid balance: %v", err)
+	}
+	if a.Nonce, err = ParseUint64(account.Nonce); err != nil {
+		return fmt.Errorf("invalid nonce: %v", err)
+	}
+	if a.Code, err = util.HexToBytes(account.Code); err != nil {
+		return fmt.Errorf("invalid code: %v", err)
+	}
+	a.Storage = make(map[core.Word256][]byte)
+	for k, v := range account.Storage {
+		key, err := parseWord(k)
+		if err != nil {
+			return fmt.Errorf("invalid storage key %s: %v", k, err)
+		}
+		value, err := parseWord(v)
+		if err != nil {
+			return fmt.Errorf("invalid storage value %s: %v", v, err)
+		}
+		a.Storage[key] = value.Bytes()
+	}
+	return nil
+}
+
+// ReadAlloc read alloc from a json file
+func ReadAlloc(path string) (Alloc, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var alloc Alloc
+	if err := json.Unmarshal(data, &alloc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return alloc, nil
+}
+
+// Write writes the accounts and storages of alloc into a write batch and commit it,
+// and the batch is discarded if an error occurs
+func (alloc Alloc) Write(bc evm.Blockchain, wb evm.WriteBatch) error {
+	for _, key := range alloc.sortedKeys() {
+		bytes, err := util.HexToBytes(key)
+		if err != nil {
+			wb.Discard()
+			return fmt.Errorf("invalid address %s: %v", key, err)
+		}
+		var address = bc.BytesToAddress(bytes)
+		var a = alloc[key]
+		account := bc.NewAccount(address)
+		if err := account.AddBalance(a.Balance); err != nil {
+			wb.Discard()
+			return err
+		}
+		account.SetNonce(a.Nonce)
+		account.SetCode(a.Code)
+		if err := wb.UpdateAccount(account); err != nil {
+			wb.Discard()
+			return err
+		}
+		for k, v := range a.Storage {
+			wb.SetStorage(address, k.Bytes(), v)
+		}
+	}
+	return wb.Commit()
+}
+
+// Dump dumps the accounts which are not empty and their storages in the memory db,
+// and the storage whose value is zero is not included
+func Dump(m *db.Memory) Alloc {
+	var alloc = make(Alloc)
+	for _, account := range m.Accounts() {
+		var a = &Account{
+			Balance: account.GetBalance(),
+			Nonce:   account.GetNonce(),
+			Code:    account.GetCode(),
+			Storage: make(map[core.Word256][]byte),
+		}
+		for key, value := range m.Storages(account.GetAddress()) {
+			if new(big.Int).SetBytes(value).Sign() != 0 {
+				a.Storage[core.BytesToWord256([]byte(key))] = value
+			}
+		}
+		if a.Balance == 0 && a.Nonce == 0 && len(a.Code) == 0 && len(a.Storage) == 0 {
+			continue
+		}
+		alloc["0x"+hex.EncodeToString(account.GetAddress().Bytes())] = a
+	}
+	return alloc
+}
+
+func (alloc Alloc) sortedKeys() []string {
+	var keys = make([]string, 0, len(alloc))
+	for key := range alloc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseUint64 parse a json number, a decimal string or a hex string begins
+// with 0x, and empty means 0
+func ParseUint64(data json.RawMessage) (uint64, error) {
+	var s = strings.Trim(string(data), "\"")
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		if len(s) == 2 {
+			return 0, nil
+		}
+		return strconv.ParseUint(s[2:], 16, 64)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// parseWord parse a hex string into a word, and the short hex is left padded
+func parseWord(s string) (core.Word256, error) {
+	var word core.Word256
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	bytes, err := hex.DecodeString(s)
+	if err != nil {
+		return word, err
+	}
+	if len(bytes) > 32 {
+		return word, fmt.Errorf("longer than 32 bytes")
+	}
+	return core.LeftPadWord256(bytes), nil
+}
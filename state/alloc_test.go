@@ -0,0 +1,62 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlloc(t *testing.T) {
+	var alloc Alloc
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"0x00000000000000000000000000000000000000aa": {"balance": "0x10", "nonce": 2, "code": "0x6000", "storage": {"0x01": "0x02", "0x02": "0x00"}},
+		"0x00000000000000000000000000000000000000bb": {"balance": "100"},
+		"0x00000000000000000000000000000000000000cc": {}
+	}`), &alloc))
+	require.EqualValues(t, 16, alloc["0x00000000000000000000000000000000000000aa"].Balance)
+	require.EqualValues(t, 2, alloc["0x00000000000000000000000000000000000000aa"].Nonce)
+	require.EqualValues(t, 100, alloc["0x00000000000000000000000000000000000000bb"].Balance)
+
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	require.NoError(t, alloc.Write(bc, memoryDB.NewWriteBatch()))
+	aa := example.HexToAddress("00000000000000000000000000000000000000aa")
+	require.Equal(t, []byte{0x60, 0x00}, memoryDB.GetAccount(aa).GetCode())
+	require.Equal(t, core.Uint64ToWord256(2).Bytes(), memoryDB.GetStorage(aa, core.Uint64ToWord256(1).Bytes()))
+
+	dump := Dump(memoryDB)
+	require.Len(t, dump, 2)
+	require.Len(t, dump["0x00000000000000000000000000000000000000aa"].Storage, 1)
+	data, err := json.Marshal(dump)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"0x00000000000000000000000000000000000000aa": {"balance": "0x10", "nonce": "0x2", "code": "0x6000", "storage": {
+			"0x0000000000000000000000000000000000000000000000000000000000000001": "0x0000000000000000000000000000000000000000000000000000000000000002"}},
+		"0x00000000000000000000000000000000000000bb": {"balance": "0x64", "nonce": "0x0"}
+	}`, string(data))
+
+	require.Error(t, json.Unmarshal([]byte(`{"0xaa": {"balance": "0xg"}}`), &alloc))
+	require.Error(t, json.Unmarshal([]byte(`{"0xaa": {"storage": {"0x01": "0xzz"}}}`), &alloc))
+}
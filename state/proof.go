@@ -0,0 +1,174 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/crypto"
+	"github.com/thu-arxan/evm/rlp"
+	"github.com/thu-arxan/evm/trie"
+	"github.com/thu-arxan/evm/util"
+)
+
+// AccountProof is the merkle proof of an account and some of its storages,
+// which is the same as the result of eth_getProof.
+// An account which is not exist is proved to be absent, and its fields are
+// the default values(the StorageRoot is trie.EmptyRoot and the CodeHash is EmptyCodeHash).
+type AccountProof struct {
+	Address     []byte
+	Nonce       uint64
+	Balance     uint64
+	StorageRoot []byte
+	CodeHash    []byte
+	// AccountProof is the rlp of nodes from state root to the account
+	AccountProof [][]byte
+	StorageProof []*StorageProof
+}
+
+// StorageProof is the merkle proof of a storage against the StorageRoot of account
+type StorageProof struct {
+	// Key is the 32 bytes storage key
+	Key []byte
+	// Value is the value whose leading zeros are trimmed, and nil means zero
+	Value []byte
+	// Proof is the rlp of nodes from storage root to the storage
+	Proof [][]byte
+}
+
+// account is the value of an account in state trie
+type account struct {
+	Nonce       uint64
+	Balance     uint64
+	StorageRoot []byte
+	CodeHash    []byte
+}
+
+// Prove return the proof of an account and its storages of keys in db. It
+// builds the whole state trie on every call, so ProveAt should be used if the
+// state is committed by Commit.
+func Prove(db Iterable, address evm.Address, keys [][]byte) (*AccountProof, error) {
+	store := trie.NewMemoryStore()
+	root, err := Commit(db, store)
+	if err != nil {
+		return nil, err
+	}
+	return ProveAt(root, store, address, keys)
+}
+
+// ProveAt return the proof of an account and its storages of keys in the state
+// trie committed into store at root. Only the nodes on the paths are read from
+// store, and the proof of an older root could be made as long as its nodes are kept.
+func ProveAt(root []byte, store trie.NodeStore, address evm.Address, keys [][]byte) (*AccountProof, error) {
+	stateTrie, err := trie.NewSecure(root, store)
+	if err != nil {
+		return nil, err
+	}
+	var addr = util.FixBytesLength(address.Bytes(), 20)
+	var proof = &AccountProof{
+		Address:     addr,
+		StorageRoot: trie.EmptyRoot,
+		CodeHash:    EmptyCodeHash,
+	}
+	if proof.AccountProof, err = stateTrie.Prove(addr); err != nil {
+		return nil, err
+	}
+	data, err := stateTrie.Get(addr)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		var acc account
+		if err := rlp.DecodeBytes(data, &acc); err != nil {
+			return nil, err
+		}
+		proof.Nonce, proof.Balance, proof.StorageRoot, proof.CodeHash = acc.Nonce, acc.Balance, acc.StorageRoot, acc.CodeHash
+	}
+
+	storages, err := trie.NewSecure(proof.StorageRoot, store)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		var storage = &StorageProof{
+			Key: util.LeftPadBytes(key, 32),
+		}
+		if storage.Proof, err = storages.Prove(storage.Key); err != nil {
+			return nil, err
+		}
+		data, err := storages.Get(storage.Key)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			if err := rlp.DecodeBytes(data, &storage.Value); err != nil {
+				return nil, err
+			}
+		}
+		proof.StorageProof = append(proof.StorageProof, storage)
+	}
+	return proof, nil
+}
+
+// VerifyProof check the account and storages in proof against the state root,
+// and return an error if any of them is not proved
+func VerifyProof(root []byte, proof *AccountProof) error {
+	data, err := trie.VerifyProof(root, crypto.Keccak256(util.FixBytesLength(proof.Address, 20)), proof.AccountProof)
+	if err != nil {
+		return fmt.Errorf("account %x: %v", proof.Address, err)
+	}
+	var acc = account{
+		StorageRoot: trie.EmptyRoot,
+		CodeHash:    EmptyCodeHash,
+	}
+	if data != nil {
+		if err := rlp.DecodeBytes(data, &acc); err != nil {
+			return fmt.Errorf("account %x: %v", proof.Address, err)
+		}
+	}
+	if acc.Nonce != proof.Nonce || acc.Balance != proof.Balance ||
+		!bytes.Equal(acc.StorageRoot, proof.StorageRoot) || !bytes.Equal(acc.CodeHash, proof.CodeHash) {
+		return fmt.Errorf("account %x: mismatch with proof", proof.Address)
+	}
+	for _, storage := range proof.StorageProof {
+		if err := VerifyStorageProof(proof.StorageRoot, storage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyStorageProof check a storage against the storage root of account
+func VerifyStorageProof(storageRoot []byte, proof *StorageProof) error {
+	data, err := trie.VerifyProof(storageRoot, crypto.Keccak256(util.LeftPadBytes(proof.Key, 32)), proof.Proof)
+	if err != nil {
+		return fmt.Errorf("storage %x: %v", proof.Key, err)
+	}
+	var value []byte
+	if data != nil {
+		if err := rlp.DecodeBytes(data, &value); err != nil {
+			return fmt.Errorf("storage %x: %v", proof.Key, err)
+		}
+	}
+	if !bytes.Equal(value, trimLeftZeros(proof.Value)) {
+		return fmt.Errorf("storage %x: mismatch with proof", proof.Key)
+	}
+	return nil
+}
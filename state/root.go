@@ -0,0 +1,132 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/crypto"
+	"github.com/thu-arxan/evm/rlp"
+	"github.com/thu-arxan/evm/trie"
+	"github.com/thu-arxan/evm/util"
+)
+
+// Iterable is the db which could list its accounts and storages, such as
+// db.Memory and db.File, and the state root is computed on it after Cache.Sync
+type Iterable interface {
+	// Accounts return the accounts which are not suicided
+	Accounts() []evm.Account
+	// Storages return the storages of an account, which are keyed by the string of storage key
+	Storages(address evm.Address) map[string][]byte
+}
+
+// EmptyCodeHash is the keccak256 of empty code
+var EmptyCodeHash = crypto.Keccak256(nil)
+
+// Root return the state root of db, which is the root of secure trie from
+// address to rlp([nonce, balance, storageRoot, codeHash])
+func Root(db Iterable) []byte {
+	// nothing is committed, so there is no error
+	root, _ := commit(db, nil)
+	return root
+}
+
+// Commit write the state trie and storage tries of db into store, and return the state root
+func Commit(db Iterable, store trie.NodeStore) ([]byte, error) {
+	return commit(db, store)
+}
+
+// StorageRoot return the root of storage trie, which is the secure trie from
+// the 32 bytes storage key to the rlp of value whose leading zeros are trimmed,
+// and the zero values are not included
+func StorageRoot(storages map[string][]byte) []byte {
+	t, _ := storageTrie(storages, nil)
+	return t.Hash()
+}
+
+func commit(db Iterable, store trie.NodeStore) ([]byte, error) {
+	stateTrie, err := buildStateTrie(db, store)
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		return stateTrie.Commit()
+	}
+	return stateTrie.Hash(), nil
+}
+
+// buildStateTrie build the state trie of db, and the storage tries are committed into store if it is not nil
+func buildStateTrie(db Iterable, store trie.NodeStore) (*trie.SecureTrie, error) {
+	stateTrie, err := trie.NewSecure(nil, store)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range db.Accounts() {
+		storages, err := storageTrie(db.Storages(account.GetAddress()), store)
+		if err != nil {
+			return nil, err
+		}
+		var storageRoot = storages.Hash()
+		if store != nil {
+			if storageRoot, err = storages.Commit(); err != nil {
+				return nil, err
+			}
+		}
+		var codeHash = EmptyCodeHash
+		if code := account.GetCode(); len(code) != 0 {
+			codeHash = crypto.Keccak256(code)
+		}
+		value, err := rlp.EncodeToBytes([]interface{}{account.GetNonce(), account.GetBalance(), storageRoot, codeHash})
+		if err != nil {
+			return nil, err
+		}
+		if err := stateTrie.Update(util.FixBytesLength(account.GetAddress().Bytes(), 20), value); err != nil {
+			return nil, err
+		}
+	}
+	return stateTrie, nil
+}
+
+func storageTrie(storages map[string][]byte, store trie.NodeStore) (*trie.SecureTrie, error) {
+	t, err := trie.NewSecure(nil, store)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range storages {
+		value = trimLeftZeros(value)
+		if len(value) == 0 {
+			continue
+		}
+		data, err := rlp.EncodeToBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.Update(util.LeftPadBytes([]byte(key), 32), data); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func trimLeftZeros(data []byte) []byte {
+	for i := range data {
+		if data[i] != 0 {
+			return data[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package state
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/crypto"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/rlp"
+	"github.com/thu-arxan/evm/trie"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoot(t *testing.T) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	require.Equal(t, trie.EmptyRoot, Root(memoryDB))
+	require.Equal(t, trie.EmptyRoot, StorageRoot(map[string][]byte{"\x01": make([]byte, 32)}))
+	require.Equal(t, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470", util.Hex(EmptyCodeHash))
+
+	var alloc Alloc
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"0x00000000000000000000000000000000000000aa": {"balance": "0x10", "nonce": 2, "code": "0x6000", "storage": {"0x01": "0x02", "0x02": "0x00"}},
+		"0x00000000000000000000000000000000000000bb": {"balance": "100"}
+	}`), &alloc))
+	require.NoError(t, alloc.Write(bc, memoryDB.NewWriteBatch()))
+	root := Root(memoryDB)
+
+	// the zero storage is not included
+	aa := example.HexToAddress("00000000000000000000000000000000000000aa")
+	wb := memoryDB.NewWriteBatch()
+	wb.SetStorage(aa, core.Uint64ToWord256(3).Bytes(), make([]byte, 32))
+	require.NoError(t, wb.Commit())
+	require.Equal(t, root, Root(memoryDB))
+	// the storage changes the root
+	wb = memoryDB.NewWriteBatch()
+	wb.SetStorage(aa, core.Uint64ToWord256(3).Bytes(), core.Uint64ToWord256(3).Bytes())
+	require.NoError(t, wb.Commit())
+	require.NotEqual(t, root, Root(memoryDB))
+	root = Root(memoryDB)
+
+	// the committed tries could be loaded from store
+	store := trie.NewMemoryStore()
+	committed, err := Commit(memoryDB, store)
+	require.NoError(t, err)
+	require.Equal(t, root, committed)
+	stateTrie, err := trie.NewSecure(root, store)
+	require.NoError(t, err)
+	data, err := stateTrie.Get(aa.Bytes())
+	require.NoError(t, err)
+	var account struct {
+		Nonce       uint64
+		Balance     uint64
+		StorageRoot []byte
+		CodeHash    []byte
+	}
+	require.NoError(t, rlp.DecodeBytes(data, &account))
+	require.EqualValues(t, 2, account.Nonce)
+	require.EqualValues(t, 16, account.Balance)
+	require.Equal(t, crypto.Keccak256([]byte{0x60, 0x00}), account.CodeHash)
+	require.Equal(t, StorageRoot(memoryDB.Storages(aa)), account.StorageRoot)
+	storageTrie, err := trie.NewSecure(account.StorageRoot, store)
+	require.NoError(t, err)
+	value, err := storageTrie.Get(core.Uint64ToWord256(1).Bytes())
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x02}, value)
+}
+
+func TestProof(t *testing.T) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	var alloc Alloc
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"0x00000000000000000000000000000000000000aa": {"balance": "0x10", "nonce": 2, "code": "0x6000", "storage": {"0x01": "0x02", "0x02": "0x0300"}},
+		"0x00000000000000000000000000000000000000bb": {"balance": "100"}
+	}`), &alloc))
+	require.NoError(t, alloc.Write(bc, memoryDB.NewWriteBatch()))
+	root := Root(memoryDB)
+
+	aa := example.HexToAddress("00000000000000000000000000000000000000aa")
+	proof, err := Prove(memoryDB, aa, [][]byte{{0x01}, core.Uint64ToWord256(2).Bytes(), {0x03}})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, proof.Nonce)
+	require.EqualValues(t, 16, proof.Balance)
+	require.Equal(t, crypto.Keccak256([]byte{0x60, 0x00}), proof.CodeHash)
+	require.Equal(t, StorageRoot(memoryDB.Storages(aa)), proof.StorageRoot)
+	require.Len(t, proof.StorageProof, 3)
+	require.Equal(t, core.Uint64ToWord256(1).Bytes(), proof.StorageProof[0].Key)
+	require.Equal(t, []byte{0x02}, proof.StorageProof[0].Value)
+	require.Equal(t, []byte{0x03, 0x00}, proof.StorageProof[1].Value)
+	require.Nil(t, proof.StorageProof[2].Value)
+	require.NoError(t, VerifyProof(root, proof))
+
+	// the values mismatch with proof
+	proof.Balance++
+	require.Error(t, VerifyProof(root, proof))
+	proof.Balance--
+	proof.StorageProof[2].Value = []byte{0x01}
+	require.Error(t, VerifyProof(root, proof))
+	proof.StorageProof[2].Value = nil
+	proof.StorageProof[0].Proof = proof.StorageProof[1].Proof
+	require.Error(t, VerifyProof(root, proof))
+
+	// the account which is not exist is proved to be absent
+	cc := example.HexToAddress("00000000000000000000000000000000000000cc")
+	proof, err = Prove(memoryDB, cc, [][]byte{{0x01}})
+	require.NoError(t, err)
+	require.Equal(t, trie.EmptyRoot, proof.StorageRoot)
+	require.Equal(t, EmptyCodeHash, proof.CodeHash)
+	require.Nil(t, proof.StorageProof[0].Value)
+	require.NoError(t, VerifyProof(root, proof))
+	proof.Nonce = 1
+	require.Error(t, VerifyProof(root, proof))
+}
+
+// countStore counts the nodes read from store
+type countStore struct {
+	*trie.MemoryStore
+	gets int
+}
+
+func (s *countStore) Get(hash []byte) ([]byte, error) {
+	s.gets++
+	return s.MemoryStore.Get(hash)
+}
+
+func TestProveAt(t *testing.T) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	aa := example.HexToAddress("00000000000000000000000000000000000000aa")
+	wb := memoryDB.NewWriteBatch()
+	for i := 1; i <= 200; i++ {
+		account := bc.NewAccount(bc.BytesToAddress(core.Uint64ToWord256(uint64(i)).Bytes()[12:]))
+		require.NoError(t, account.AddBalance(uint64(i)))
+		require.NoError(t, wb.UpdateAccount(account))
+		wb.SetStorage(aa, core.Uint64ToWord256(uint64(i)).Bytes(), []byte{byte(i)})
+	}
+	require.NoError(t, wb.Commit())
+	store := &countStore{MemoryStore: trie.NewMemoryStore()}
+	root, err := Commit(memoryDB, store)
+	require.NoError(t, err)
+
+	// the proof is the same as the one of rebuilding, and only the nodes on paths
+	// are read, which are read by both Prove and Get of tries
+	keys := [][]byte{{0x01}, {0x02}, {0xff}}
+	store.gets = 0
+	proof, err := ProveAt(root, store, aa, keys)
+	require.NoError(t, err)
+	expected, err := Prove(memoryDB, aa, keys)
+	require.NoError(t, err)
+	require.Equal(t, expected, proof)
+	require.NoError(t, VerifyProof(root, proof))
+	var nodes = len(proof.AccountProof)
+	for _, storage := range proof.StorageProof {
+		nodes += len(storage.Proof)
+	}
+	require.True(t, store.gets <= 2*nodes+2, "%d of %d nodes are read", store.gets, store.Len())
+
+	// the older root could still be proved after the state changes
+	account := memoryDB.GetAccount(aa).Copy()
+	require.NoError(t, account.AddBalance(1))
+	require.NoError(t, memoryDB.UpdateAccount(account))
+	newRoot, err := Commit(memoryDB, store)
+	require.NoError(t, err)
+	require.NotEqual(t, root, newRoot)
+	proof, err = ProveAt(root, store, aa, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 0xaa, proof.Balance)
+	require.NoError(t, VerifyProof(root, proof))
+	proof, err = ProveAt(newRoot, store, aa, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 0xab, proof.Balance)
+
+	// the root which is not committed
+	_, err = ProveAt(crypto.Keccak256([]byte("unknown")), store, aa, nil)
+	require.Error(t, err)
+}
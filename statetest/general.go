@@ -0,0 +1,163 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package statetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/thu-arxan/evm/state"
+	"github.com/thu-arxan/evm/t8n"
+	"github.com/thu-arxan/evm/util"
+)
+
+// StateTest is a test of GeneralStateTests
+type StateTest struct {
+	Env         *t8n.Env                `json:"env"`
+	Pre         state.Alloc             `json:"pre"`
+	Transaction *StateTransaction       `json:"transaction"`
+	Post        map[string][]*PostState `json:"post"`
+}
+
+// StateTransaction is the transaction of a state test, and the data, gas and
+// value of a subtest are chosen by the indexes of post state
+type StateTransaction struct {
+	Data      []string          `json:"data"`
+	GasLimit  []json.RawMessage `json:"gasLimit"`
+	GasPrice  json.RawMessage   `json:"gasPrice"`
+	Nonce     json.RawMessage   `json:"nonce"`
+	To        string            `json:"to"`
+	Value     []json.RawMessage `json:"value"`
+	SecretKey string            `json:"secretKey"`
+}
+
+// PostState is the expected result of a subtest
+type PostState struct {
+	// Root is the state root
+	Root string `json:"hash"`
+	// Logs is the keccak256 of rlp encoded logs
+	Logs    string `json:"logs"`
+	Indexes struct {
+		Data  int `json:"data"`
+		Gas   int `json:"gas"`
+		Value int `json:"value"`
+	} `json:"indexes"`
+	// ExpectException is not empty if the transaction is invalid
+	ExpectException string `json:"expectException"`
+}
+
+// supportedForks are the forks whose gas rules are implemented, the evm follows
+// Istanbul and other forks only change the precompile contracts
+var supportedForks = map[string]bool{
+	"Istanbul": true,
+}
+
+// Run runs the subtest of fork at index, and return an error if the result is not expected.
+// The subtest of a fork which is not supported, or without a state root to compare,
+// returns ErrUnsupported.
+func (test *StateTest) Run(fork string, index int) error {
+	result, err := test.Execute(fork, index)
+	if err != nil {
+		return err
+	}
+	post := test.Post[fork][index]
+	if post.ExpectException != "" {
+		if len(result.Rejected) == 0 {
+			return fmt.Errorf("expect exception %s but the transaction is applied", post.ExpectException)
+		}
+		return nil
+	}
+	if len(result.Rejected) != 0 {
+		return fmt.Errorf("transaction is rejected: %s", result.Rejected[0].Error)
+	}
+	if post.Logs != "" {
+		want, err := util.HexToBytes(post.Logs)
+		if err != nil {
+			return fmt.Errorf("invalid logs hash %s", post.Logs)
+		}
+		if !bytes.Equal(want, result.LogsHash) {
+			return fmt.Errorf("logs hash mismatch: want %s, got 0x%x", post.Logs, result.LogsHash)
+		}
+	}
+	want, err := util.HexToBytes(post.Root)
+	if err != nil {
+		return fmt.Errorf("invalid state root %s", post.Root)
+	}
+	if allZero(want) {
+		return fmt.Errorf("%w: no state root to compare", ErrUnsupported)
+	}
+	if !bytes.Equal(want, result.StateRoot) {
+		return fmt.Errorf("state root mismatch: want %s, got 0x%x", post.Root, result.StateRoot)
+	}
+	return nil
+}
+
+// Execute applies the transaction of the subtest of fork at index on the pre
+// state, and return the result without comparing it, such as the gas used
+func (test *StateTest) Execute(fork string, index int) (*t8n.Result, error) {
+	posts, ok := test.Post[fork]
+	if !ok || index >= len(posts) {
+		return nil, fmt.Errorf("no post state of %s/%d", fork, index)
+	}
+	if !supportedForks[fork] {
+		return nil, fmt.Errorf("%w: the gas rules of %s are not implemented", ErrUnsupported, fork)
+	}
+	tx, err := test.Transaction.toTransaction(posts[index])
+	if err != nil {
+		return nil, err
+	}
+	// the previous block hashes are not used by tests
+	result, _, err := t8n.Transition(&t8n.Config{Reward: -1, Fork: fork}, test.Pre, test.Env, []*t8n.Transaction{tx})
+	return result, err
+}
+
+func (stx *StateTransaction) toTransaction(post *PostState) (*t8n.Transaction, error) {
+	var indexes = post.Indexes
+	if indexes.Data >= len(stx.Data) || indexes.Gas >= len(stx.GasLimit) || indexes.Value >= len(stx.Value) {
+		return nil, fmt.Errorf("indexes out of range")
+	}
+	var tx = &t8n.Transaction{}
+	var err error
+	for _, v := range []struct {
+		name  string
+		value json.RawMessage
+		dst   *uint64
+	}{
+		{"gasLimit", stx.GasLimit[indexes.Gas], &tx.Gas},
+		{"gasPrice", stx.GasPrice, &tx.GasPrice},
+		{"nonce", stx.Nonce, &tx.Nonce},
+		{"value", stx.Value[indexes.Value], &tx.Value},
+	} {
+		if *v.dst, err = state.ParseUint64(v.value); err != nil {
+			return nil, fmt.Errorf("%w: %s %s: %v", ErrUnsupported, v.name, v.value, err)
+		}
+	}
+	if tx.Input, err = util.HexToBytes(stx.Data[indexes.Data]); err != nil {
+		return nil, fmt.Errorf("invalid data: %v", err)
+	}
+	if stx.To != "" {
+		if tx.To, err = util.HexToBytes(stx.To); err != nil {
+			return nil, fmt.Errorf("invalid to: %v", err)
+		}
+	}
+	if tx.SecretKey, err = util.HexToBytes(stx.SecretKey); err != nil {
+		return nil, fmt.Errorf("invalid secretKey: %v", err)
+	}
+	return tx, nil
+}
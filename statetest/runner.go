@@ -0,0 +1,297 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Package statetest runs the json fixtures of ethereum tests, including
+// GeneralStateTests and VMTests, and reports the result of every fork.
+package statetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// VMTestsFork is the fork name of VMTests, which are not related to fork
+const VMTestsFork = "VMTests"
+
+// ErrUnsupported is returned if a test could not be run by the evm, such as
+// the value overflows uint64, and the test is skipped
+var ErrUnsupported = errors.New("unsupported")
+
+// Status is the status of a test
+type Status int
+
+// Here defines the status
+const (
+	Pass Status = iota
+	Fail
+	Skip
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "PASS"
+	case Fail:
+		return "FAIL"
+	default:
+		return "SKIP"
+	}
+}
+
+// Result is the result of a subtest, which is a post entry of a fork
+type Result struct {
+	File   string
+	Name   string
+	Fork   string
+	Index  int
+	Status Status
+	// Err is the reason of fail or skip
+	Err error
+}
+
+func (r *Result) String() string {
+	var s = fmt.Sprintf("%s %s/%d %s", r.Name, r.Fork, r.Index, r.Status)
+	if r.Err != nil {
+		s += ": " + r.Err.Error()
+	}
+	return s
+}
+
+// Runner runs fixtures
+type Runner struct {
+	forks map[string]bool
+	skip  []*regexp.Regexp
+}
+
+// NewRunner is the constructor of Runner, forks are the forks of GeneralStateTests
+// to run and empty means all forks, skip are regexps matched against the test name
+// and the matched tests are skipped
+func NewRunner(forks []string, skip []string) (*Runner, error) {
+	var r = &Runner{forks: make(map[string]bool)}
+	for _, fork := range forks {
+		r.forks[fork] = true
+	}
+	for _, pattern := range skip {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.skip = append(r.skip, re)
+	}
+	return r, nil
+}
+
+// ReadSkipList reads the skip list from a file, one regexp per line, and the
+// empty line or the line begins with # is ignored
+func ReadSkipList(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, nil
+}
+
+// RunDir runs all json fixtures in dir recursively
+func (r *Runner) RunDir(dir string) ([]*Result, error) {
+	var results []*Result
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		fileResults, err := r.RunFile(path)
+		if err != nil {
+			return err
+		}
+		results = append(results, fileResults...)
+		return nil
+	})
+	return results, err
+}
+
+// RunFile runs the tests in a json fixture, and the format is decided by content
+func (r *Runner) RunFile(path string) ([]*Result, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tests map[string]json.RawMessage
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var names = make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var results []*Result
+	for _, name := range names {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(tests[name], &fields); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+		var testResults []*Result
+		switch {
+		case fields["transaction"] != nil:
+			var test StateTest
+			if err := json.Unmarshal(tests[name], &test); err != nil {
+				// such as the balance overflows uint64
+				testResults = r.unsupportedStateTest(name, fields["post"], err)
+			} else {
+				testResults = r.runStateTest(name, &test, false)
+			}
+		case fields["exec"] != nil:
+			var test VMTest
+			if err := json.Unmarshal(tests[name], &test); err != nil {
+				testResults = []*Result{{Name: name, Fork: VMTestsFork, Status: Skip, Err: fmt.Errorf("%w: %v", ErrUnsupported, err)}}
+			} else {
+				testResults = []*Result{r.runVMTest(name, &test)}
+			}
+		default:
+			return nil, fmt.Errorf("%s: %s: unknown test format", path, name)
+		}
+		for _, result := range testResults {
+			result.File = path
+		}
+		results = append(results, testResults...)
+	}
+	return results, nil
+}
+
+// runStateTest runs the subtests of selected forks, and they are only listed if dryRun
+func (r *Runner) runStateTest(name string, test *StateTest, dryRun bool) []*Result {
+	var forks = make([]string, 0, len(test.Post))
+	for fork := range test.Post {
+		if len(r.forks) == 0 || r.forks[fork] {
+			forks = append(forks, fork)
+		}
+	}
+	sort.Strings(forks)
+	var results []*Result
+	for _, fork := range forks {
+		for i := range test.Post[fork] {
+			var result = &Result{Name: name, Fork: fork, Index: i}
+			if r.skipped(name) {
+				result.Status = Skip
+			} else if !dryRun {
+				result.Err = test.Run(fork, i)
+				result.Status = status(result.Err)
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// unsupportedStateTest return the skipped results of a state test which could not be decoded
+func (r *Runner) unsupportedStateTest(name string, post json.RawMessage, err error) []*Result {
+	var posts map[string][]json.RawMessage
+	json.Unmarshal(post, &posts)
+	var test = &StateTest{Post: make(map[string][]*PostState)}
+	for fork := range posts {
+		test.Post[fork] = make([]*PostState, len(posts[fork]))
+	}
+	var results = r.runStateTest(name, test, true)
+	for _, result := range results {
+		result.Status = Skip
+		result.Err = fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	return results
+}
+
+func (r *Runner) runVMTest(name string, test *VMTest) *Result {
+	var result = &Result{Name: name, Fork: VMTestsFork}
+	if r.skipped(name) {
+		result.Status = Skip
+		return result
+	}
+	result.Err = test.Run()
+	result.Status = status(result.Err)
+	return result
+}
+
+func (r *Runner) skipped(name string) bool {
+	for _, re := range r.skip {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func status(err error) Status {
+	switch {
+	case err == nil:
+		return Pass
+	case errors.Is(err, ErrUnsupported):
+		return Skip
+	default:
+		return Fail
+	}
+}
+
+// WriteReport writes the failed tests and the count of pass, fail and skip of every fork
+func WriteReport(w io.Writer, results []*Result) error {
+	type count struct{ pass, fail, skip int }
+	var counts = make(map[string]*count)
+	var forks []string
+	for _, result := range results {
+		c, ok := counts[result.Fork]
+		if !ok {
+			c = &count{}
+			counts[result.Fork] = c
+			forks = append(forks, result.Fork)
+		}
+		switch result.Status {
+		case Pass:
+			c.pass++
+		case Fail:
+			c.fail++
+			if _, err := fmt.Fprintln(w, result); err != nil {
+				return err
+			}
+		default:
+			c.skip++
+		}
+	}
+	sort.Strings(forks)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FORK\tPASS\tFAIL\tSKIP\t")
+	for _, fork := range forks {
+		c := counts[fork]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", fork, c.pass, c.fail, c.skip)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,136 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package statetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDir(t *testing.T) {
+	runner, err := NewRunner(nil, nil)
+	require.NoError(t, err)
+	results, err := runner.RunDir("testdata")
+	require.NoError(t, err)
+	var status = make(map[string]Status)
+	for _, result := range results {
+		status[fmt.Sprintf("%s/%s/%d", result.Name, result.Fork, result.Index)] = result.Status
+	}
+	require.Equal(t, map[string]Status{
+		"bigBalance/Istanbul/0": Skip,
+		"sstore/Berlin/0":       Skip,
+		"sstore/Istanbul/0":     Pass,
+		"sstore/Istanbul/1":     Pass,
+		"sstore/Istanbul/2":     Pass,
+		"add0/VMTests/0":        Pass,
+		"jumpBadDest/VMTests/0": Pass,
+	}, status)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteReport(&buf, results))
+	require.NotContains(t, buf.String(), "FAIL:")
+	require.Contains(t, buf.String(), "Berlin    0     0     1")
+	require.Contains(t, buf.String(), "Istanbul  3     0     1")
+}
+
+func TestStateTestRoot(t *testing.T) {
+	var tests map[string]json.RawMessage
+	data, err := os.ReadFile("testdata/GeneralStateTests/sstore.json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &tests))
+	var test *StateTest
+	require.NoError(t, json.Unmarshal(tests["sstore"], &test))
+	require.NoError(t, test.Run("Istanbul", 0))
+	// the root is compared
+	post := test.Post["Istanbul"][0]
+	post.Root = post.Root[:len(post.Root)-1] + "0"
+	err = test.Run("Istanbul", 0)
+	require.Error(t, err)
+	require.Equal(t, Fail, status(err))
+	require.Contains(t, err.Error(), "state root mismatch")
+	// the subtest without a root is not passed
+	for _, root := range []string{"", "0x0000000000000000000000000000000000000000000000000000000000000000"} {
+		post.Root = root
+		err = test.Run("Istanbul", 0)
+		require.True(t, errors.Is(err, ErrUnsupported), root)
+		require.Equal(t, Skip, status(err))
+	}
+	// the gas rules of Berlin are not implemented
+	err = test.Run("Berlin", 0)
+	require.True(t, errors.Is(err, ErrUnsupported))
+}
+
+// TestStateTestGasUsed checks the gas used by the subtests against the gas
+// computed by the Istanbul rules rather than by the library: the call runs
+// PUSH1 1 PUSH1 1 SSTORE STOP, which costs 3 + 3 + 20000 for setting a zero
+// slot by EIP-2200, after the intrinsic gas 21000 and 16 for every non-zero
+// byte of data by EIP-2028
+func TestStateTestGasUsed(t *testing.T) {
+	var tests map[string]json.RawMessage
+	data, err := os.ReadFile("testdata/GeneralStateTests/sstore.json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &tests))
+	var test *StateTest
+	require.NoError(t, json.Unmarshal(tests["sstore"], &test))
+	for index, gasUsed := range []uint64{21000 + 3 + 3 + 20000, 21000 + 16 + 3 + 3 + 20000} {
+		result, err := test.Execute("Istanbul", index)
+		require.NoError(t, err)
+		require.Empty(t, result.Rejected)
+		require.Equal(t, gasUsed, result.GasUsed, index)
+	}
+	// the transaction whose gas limit is lower than the intrinsic gas uses nothing
+	result, err := test.Execute("Istanbul", 2)
+	require.NoError(t, err)
+	require.Len(t, result.Rejected, 1)
+	require.Zero(t, result.GasUsed)
+}
+
+func TestRunnerForksAndSkip(t *testing.T) {
+	path := writeSkipList(t, "# comment\n\nsstore\n")
+	skip, err := ReadSkipList(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"sstore"}, skip)
+
+	runner, err := NewRunner([]string{"Istanbul"}, skip)
+	require.NoError(t, err)
+	results, err := runner.RunFile("testdata/GeneralStateTests/sstore.json")
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	for _, result := range results {
+		require.Equal(t, "Istanbul", result.Fork)
+		require.Equal(t, Skip, result.Status)
+	}
+
+	_, err = NewRunner(nil, []string{"("})
+	require.Error(t, err)
+}
+
+func writeSkipList(t *testing.T, content string) string {
+	f, err := os.CreateTemp(t.TempDir(), "skip")
+	require.NoError(t, err)
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return f.Name()
+}
@@ -0,0 +1,175 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package statetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/state"
+	"github.com/thu-arxan/evm/t8n"
+	"github.com/thu-arxan/evm/util"
+)
+
+// VMTest is a test of VMTests, which runs code without transaction
+type VMTest struct {
+	Env  *t8n.Env    `json:"env"`
+	Exec *VMExec     `json:"exec"`
+	Pre  state.Alloc `json:"pre"`
+	// Post is nil if the execution runs into an error
+	Post state.Alloc `json:"post"`
+	// Gas is the gas left
+	Gas  json.RawMessage `json:"gas"`
+	Logs string          `json:"logs"`
+	Out  string          `json:"out"`
+}
+
+// VMExec is the execution of VMTest
+type VMExec struct {
+	Address  string          `json:"address"`
+	Caller   string          `json:"caller"`
+	Code     string          `json:"code"`
+	Data     string          `json:"data"`
+	Gas      json.RawMessage `json:"gas"`
+	GasPrice json.RawMessage `json:"gasPrice"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// Run runs the test, and return an error if the result is not expected.
+// Note: The value is not transferred because it is done by the test already.
+func (test *VMTest) Run() error {
+	var exec = test.Exec
+	code, err := util.HexToBytes(exec.Code)
+	if err != nil {
+		return fmt.Errorf("invalid code: %v", err)
+	}
+	input, err := util.HexToBytes(exec.Data)
+	if err != nil {
+		return fmt.Errorf("invalid data: %v", err)
+	}
+	var gas, gasPrice, value uint64
+	for _, v := range []struct {
+		name  string
+		value json.RawMessage
+		dst   *uint64
+	}{{"gas", exec.Gas, &gas}, {"gasPrice", exec.GasPrice, &gasPrice}, {"value", exec.Value, &value}} {
+		if *v.dst, err = state.ParseUint64(v.value); err != nil {
+			return fmt.Errorf("%w: %s %s: %v", ErrUnsupported, v.name, v.value, err)
+		}
+	}
+
+	var env = test.Env
+	if env == nil {
+		env = &t8n.Env{}
+	}
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	if err := test.Pre.Write(bc, memoryDB.NewWriteBatch()); err != nil {
+		return err
+	}
+	vm := evm.New(bc, memoryDB, &evm.Context{
+		Input:       input,
+		Value:       value,
+		Gas:         &gas,
+		BlockHeight: env.Number,
+		BlockTime:   int64(env.Timestamp),
+		Difficulty:  env.Difficulty,
+		GasLimit:    env.GasLimit,
+		GasPrice:    gasPrice,
+		CoinBase:    env.Coinbase,
+	})
+	output, err := vm.CallWithoutTransfer(example.HexToAddress(exec.Caller), example.HexToAddress(exec.Address), code)
+	if test.Post == nil {
+		if err == nil {
+			return fmt.Errorf("expect an error but the execution succeeds")
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unexpected error: %v", err)
+	}
+	if wantGas, err := state.ParseUint64(test.Gas); err != nil || wantGas != gas {
+		return fmt.Errorf("gas mismatch: want %s left, got 0x%x", test.Gas, gas)
+	}
+	if want, err := util.HexToBytes(test.Out); err != nil || !bytes.Equal(want, output) {
+		return fmt.Errorf("output mismatch: want %s, got 0x%x", test.Out, output)
+	}
+	if want, err := util.HexToBytes(test.Logs); test.Logs != "" && (err != nil || !bytes.Equal(want, t8n.LogsHash(memoryDB.GetLog()))) {
+		return fmt.Errorf("logs hash mismatch: want %s, got 0x%x", test.Logs, t8n.LogsHash(memoryDB.GetLog()))
+	}
+	return compareAlloc(test.Post, state.Dump(memoryDB))
+}
+
+// compareAlloc compares the accounts which are not empty and the storages which are not zero
+func compareAlloc(want, got state.Alloc) error {
+	var normalized = make(state.Alloc)
+	for key, account := range want {
+		bytes, err := util.HexToBytes(key)
+		if err != nil {
+			return fmt.Errorf("invalid address %s", key)
+		}
+		var a = &state.Account{Balance: account.Balance, Nonce: account.Nonce, Code: account.Code}
+		a.Storage = account.Storage
+		for k, v := range a.Storage {
+			if allZero(v) {
+				delete(a.Storage, k)
+			}
+		}
+		if a.Balance == 0 && a.Nonce == 0 && len(a.Code) == 0 && len(a.Storage) == 0 {
+			continue
+		}
+		normalized[fmt.Sprintf("0x%x", util.FixBytesLength(bytes, 20))] = a
+	}
+	for key, a := range normalized {
+		b, ok := got[key]
+		if !ok {
+			return fmt.Errorf("account %s is missing", key)
+		}
+		if a.Balance != b.Balance || a.Nonce != b.Nonce || !bytes.Equal(a.Code, b.Code) {
+			return fmt.Errorf("account %s mismatch: want balance %d nonce %d code %x, got balance %d nonce %d code %x",
+				key, a.Balance, a.Nonce, a.Code, b.Balance, b.Nonce, b.Code)
+		}
+		if len(a.Storage) != len(b.Storage) {
+			return fmt.Errorf("storage of %s mismatch: want %d slots, got %d", key, len(a.Storage), len(b.Storage))
+		}
+		for k, v := range a.Storage {
+			if !bytes.Equal(util.LeftPadBytes(v, 32), util.LeftPadBytes(b.Storage[k], 32)) {
+				return fmt.Errorf("storage %s of %s mismatch: want %x, got %x", k.HexString(), key, v, b.Storage[k])
+			}
+		}
+	}
+	for key := range got {
+		if _, ok := normalized[key]; !ok {
+			return fmt.Errorf("unexpected account %s", key)
+		}
+	}
+	return nil
+}
+
+func allZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
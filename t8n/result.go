@@ -0,0 +1,185 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package t8n
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/crypto"
+	"github.com/thu-arxan/evm/rlp"
+	"github.com/thu-arxan/evm/trie"
+)
+
+// Result is the result of transition, which is encoded as result.json of geth evm t8n
+type Result struct {
+	StateRoot    []byte
+	TxRoot       []byte
+	ReceiptsRoot []byte
+	// LogsHash is the keccak256 of rlp encoded logs
+	LogsHash   []byte
+	LogsBloom  []byte
+	Receipts   []*Receipt
+	Rejected   []*Rejected
+	Difficulty uint64
+	GasUsed    uint64
+}
+
+// Receipt is the receipt of an applied transaction
+type Receipt struct {
+	// Status is 1 if success and 0 if failed
+	Status            uint64
+	CumulativeGasUsed uint64
+	LogsBloom         []byte
+	Logs              []*evm.Log
+	TxHash            []byte
+	// ContractAddress is zero address if the transaction does not create a contract
+	ContractAddress  []byte
+	GasUsed          uint64
+	TransactionIndex uint64
+}
+
+// Rejected is the transaction which is not applied because it is invalid
+type Rejected struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+var zeroHash = make([]byte, 32)
+
+// MarshalJSON is the implementation of json.Marshaler
+func (r *Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"stateRoot":         hexBytes(r.StateRoot, zeroHash),
+		"txRoot":            hexBytes(r.TxRoot, zeroHash),
+		"receiptsRoot":      hexBytes(r.ReceiptsRoot, zeroHash),
+		"logsHash":          hexBytes(r.LogsHash, zeroHash),
+		"logsBloom":         hexBytes(r.LogsBloom, nil),
+		"receipts":          r.Receipts,
+		"rejected":          r.Rejected,
+		"currentDifficulty": hexUint64(r.Difficulty),
+		"gasUsed":           hexUint64(r.GasUsed),
+	})
+}
+
+// MarshalJSON is the implementation of json.Marshaler
+func (r *Receipt) MarshalJSON() ([]byte, error) {
+	var logs = make([]map[string]interface{}, len(r.Logs))
+	for i, log := range r.Logs {
+		var topics = make([]string, len(log.Topics))
+		for j := range log.Topics {
+			topics[j] = hexBytes(log.Topics[j].Bytes(), nil)
+		}
+		logs[i] = map[string]interface{}{
+			"address":          hexBytes(log.Address.Bytes(), nil),
+			"topics":           topics,
+			"data":             hexBytes(log.Data, nil),
+			"blockNumber":      hexUint64(log.BlockNumber),
+			"transactionHash":  hexBytes(log.TxHash, nil),
+			"transactionIndex": hexUint64(uint64(log.TxIndex)),
+			"blockHash":        hexBytes(log.BlockHash, zeroHash),
+			"logIndex":         hexUint64(uint64(log.Index)),
+			"removed":          false,
+		}
+	}
+	return json.Marshal(map[string]interface{}{
+		"type":              "0x0",
+		"root":              "0x",
+		"status":            hexUint64(r.Status),
+		"cumulativeGasUsed": hexUint64(r.CumulativeGasUsed),
+		"logsBloom":         hexBytes(r.LogsBloom, nil),
+		"logs":              logs,
+		"transactionHash":   hexBytes(r.TxHash, nil),
+		"contractAddress":   hexBytes(r.ContractAddress, nil),
+		"gasUsed":           hexUint64(r.GasUsed),
+		"blockHash":         hexBytes(nil, zeroHash),
+		"transactionIndex":  hexUint64(r.TransactionIndex),
+	})
+}
+
+// Bloom return the 2048 bits bloom filter of logs, every address and topic
+// sets 3 bits which are decided by its keccak256
+func Bloom(logs []*evm.Log) []byte {
+	var b = make([]byte, 256)
+	add := func(data []byte) {
+		hash := crypto.Keccak256(data)
+		for i := 0; i < 6; i += 2 {
+			bit := (uint(hash[i])<<8 | uint(hash[i+1])) & 2047
+			b[256-1-bit/8] |= 1 << (bit % 8)
+		}
+	}
+	for _, log := range logs {
+		add(log.Address.Bytes())
+		for _, topic := range log.Topics {
+			add(topic.Bytes())
+		}
+	}
+	return b
+}
+
+// RLP return the rlp encoding of [status, cumulativeGasUsed, logsBloom, logs]
+// of receipt, and every log is [address, topics, data]
+func (r *Receipt) RLP() []byte {
+	var logs = make([]interface{}, len(r.Logs))
+	for i, log := range r.Logs {
+		var topics = make([][]byte, len(log.Topics))
+		for j := range log.Topics {
+			topics[j] = log.Topics[j].Bytes()
+		}
+		logs[i] = []interface{}{log.Address.Bytes(), topics, log.Data}
+	}
+	data, _ := rlp.EncodeToBytes([]interface{}{r.Status, r.CumulativeGasUsed, r.LogsBloom, logs})
+	return data
+}
+
+// DeriveRoot return the root of trie from rlp(index) to item, which is the
+// transactions root or receipts root of a block
+func DeriveRoot(items [][]byte) []byte {
+	t, _ := trie.New(nil, nil)
+	for i, item := range items {
+		key, _ := rlp.EncodeToBytes(uint64(i))
+		t.Update(key, item)
+	}
+	return t.Hash()
+}
+
+// LogsHash return the keccak256 of rlp encoded [address, topics, data] of logs
+func LogsHash(logs []*evm.Log) []byte {
+	var items = make([]interface{}, len(logs))
+	for i, log := range logs {
+		var topics = make([][]byte, len(log.Topics))
+		for j := range log.Topics {
+			topics[j] = log.Topics[j].Bytes()
+		}
+		items[i] = []interface{}{log.Address.Bytes(), topics, log.Data}
+	}
+	data, _ := rlp.EncodeToBytes(items)
+	return crypto.Keccak256(data)
+}
+
+func hexBytes(data, defaultValue []byte) string {
+	if data == nil {
+		data = defaultValue
+	}
+	return fmt.Sprintf("0x%x", data)
+}
+
+func hexUint64(value uint64) string {
+	return fmt.Sprintf("0x%x", value)
+}
@@ -0,0 +1,294 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Package t8n implements the state transition tool in the format of geth evm t8n,
+// so the fixtures of execution-spec-tests could be run by both geth and this evm.
+package t8n
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/errors"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/precompile"
+	"github.com/thu-arxan/evm/state"
+	"github.com/thu-arxan/evm/util"
+)
+
+// Env is the block environment
+type Env struct {
+	Coinbase   []byte
+	Difficulty uint64
+	GasLimit   uint64
+	Number     uint64
+	Timestamp  uint64
+	// BlockHashes is the hash of previous blocks keyed by number
+	BlockHashes map[uint64][]byte
+}
+
+type jsonEnv struct {
+	Coinbase    string            `json:"currentCoinbase"`
+	Difficulty  json.RawMessage   `json:"currentDifficulty"`
+	GasLimit    json.RawMessage   `json:"currentGasLimit"`
+	Number      json.RawMessage   `json:"currentNumber"`
+	Timestamp   json.RawMessage   `json:"currentTimestamp"`
+	BlockHashes map[string]string `json:"blockHashes"`
+}
+
+// UnmarshalJSON is the implementation of json.Unmarshaler
+func (env *Env) UnmarshalJSON(data []byte) (err error) {
+	var e jsonEnv
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	if env.Coinbase, err = util.HexToBytes(e.Coinbase); err != nil {
+		return fmt.Errorf("invalid currentCoinbase: %v", err)
+	}
+	for _, v := range []struct {
+		name  string
+		value json.RawMessage
+		dst   *uint64
+	}{
+		{"currentDifficulty", e.Difficulty, &env.Difficulty},
+		{"currentGasLimit", e.GasLimit, &env.GasLimit},
+		{"currentNumber", e.Number, &env.Number},
+		{"currentTimestamp", e.Timestamp, &env.Timestamp},
+	} {
+		if *v.dst, err = state.ParseUint64(v.value); err != nil {
+			return fmt.Errorf("invalid %s: %v", v.name, err)
+		}
+	}
+	env.BlockHashes = make(map[uint64][]byte)
+	for k, v := range e.BlockHashes {
+		number, err := state.ParseUint64(json.RawMessage(k))
+		if err != nil {
+			return fmt.Errorf("invalid block number %s: %v", k, err)
+		}
+		if env.BlockHashes[number], err = util.HexToBytes(v); err != nil {
+			return fmt.Errorf("invalid block hash %s: %v", v, err)
+		}
+	}
+	return nil
+}
+
+// Config is the config of transition
+type Config struct {
+	// ChainID is used to sign transactions with secret key, and 0 means no EIP-155
+	ChainID uint64
+	// Reward is the block reward of coinbase, and it is disabled if negative
+	Reward int64
+	// Fork is the fork of rules, and empty means Istanbul. The gas rules of evm
+	// are Istanbul, so any other fork is rejected rather than applied only to
+	// the precompile contracts.
+	Fork string
+}
+
+// Transition applies txs on alloc in the block env, and return the result and post alloc.
+// The invalid transaction is rejected and the left transactions are still applied.
+func Transition(config *Config, alloc state.Alloc, env *Env, txs []*Transaction) (*Result, state.Alloc, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.Fork != "" && config.Fork != "Istanbul" {
+		return nil, nil, fmt.Errorf("unsupported fork %s, only Istanbul is implemented", config.Fork)
+	}
+	var precompiles = precompile.DefaultSet()
+	bc := &blockchain{
+		Blockchain: example.NewBlockchain(),
+		env:        env,
+	}
+	memoryDB := db.NewMemory(bc.NewAccount)
+	if err := alloc.Write(bc, memoryDB.NewWriteBatch()); err != nil {
+		return nil, nil, err
+	}
+	var result = &Result{
+		Receipts:   make([]*Receipt, 0),
+		Rejected:   make([]*Rejected, 0),
+		Difficulty: env.Difficulty,
+	}
+	var logs []*evm.Log
+	var txsRLP, receiptsRLP [][]byte
+	for i, tx := range txs {
+		if tx.SecretKey != nil {
+			if err := tx.Sign(config.ChainID); err != nil {
+				return nil, nil, fmt.Errorf("sign transaction %d: %v", i, err)
+			}
+		}
+		receipt, err := apply(bc, memoryDB, env, precompiles, tx, result.GasUsed)
+		if err != nil {
+			result.Rejected = append(result.Rejected, &Rejected{Index: i, Error: err.Error()})
+			continue
+		}
+		result.GasUsed += receipt.GasUsed
+		receipt.CumulativeGasUsed = result.GasUsed
+		receipt.TransactionIndex = uint64(len(result.Receipts))
+		for _, log := range receipt.Logs {
+			log.TxHash = receipt.TxHash
+			log.TxIndex = uint(receipt.TransactionIndex)
+			log.BlockNumber = env.Number
+		}
+		logs = append(logs, receipt.Logs...)
+		result.Receipts = append(result.Receipts, receipt)
+		txsRLP = append(txsRLP, tx.RLP())
+		receiptsRLP = append(receiptsRLP, receipt.RLP())
+	}
+	if config.Reward >= 0 {
+		if err := addBalance(memoryDB, bc.BytesToAddress(env.Coinbase), uint64(config.Reward)); err != nil {
+			return nil, nil, err
+		}
+	}
+	result.LogsHash = LogsHash(logs)
+	result.LogsBloom = Bloom(logs)
+	result.StateRoot = state.Root(memoryDB)
+	result.TxRoot = DeriveRoot(txsRLP)
+	result.ReceiptsRoot = DeriveRoot(receiptsRLP)
+	return result, state.Dump(memoryDB), nil
+}
+
+// apply applies a transaction, and return an error if the transaction is invalid
+func apply(bc *blockchain, memoryDB *db.Memory, env *Env, precompiles *precompile.Set, tx *Transaction, blockGasUsed uint64) (*Receipt, error) {
+	from, err := tx.Sender()
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	sender := bc.BytesToAddress(from)
+	account := memoryDB.GetAccount(sender).Copy()
+	if nonce := account.GetNonce(); tx.Nonce != nonce {
+		return nil, fmt.Errorf("nonce mismatch: address 0x%x, tx: %d state: %d", from, tx.Nonce, nonce)
+	}
+	intrinsicGas := tx.IntrinsicGas()
+	if tx.Gas < intrinsicGas {
+		return nil, fmt.Errorf("intrinsic gas too low: have %d, want %d", tx.Gas, intrinsicGas)
+	}
+	if blockGasUsed+tx.Gas > env.GasLimit {
+		return nil, fmt.Errorf("gas limit reached")
+	}
+	gasCost, overflow := mulUint64(tx.Gas, tx.GasPrice)
+	if overflow || gasCost+tx.Value < gasCost || account.GetBalance() < gasCost+tx.Value {
+		return nil, fmt.Errorf("insufficient funds for gas * price + value: address 0x%x", from)
+	}
+	// buy gas, and the nonce of create is increased by evm
+	if err := account.SubBalance(gasCost); err != nil {
+		return nil, err
+	}
+	if tx.To != nil {
+		account.SetNonce(tx.Nonce + 1)
+	}
+	if err := memoryDB.UpdateAccount(account); err != nil {
+		return nil, err
+	}
+
+	var gasLeft = tx.Gas - intrinsicGas
+	var ctx = &evm.Context{
+		Input:       tx.Input,
+		Value:       tx.Value,
+		Gas:         &gasLeft,
+		BlockHeight: env.Number,
+		BlockTime:   int64(env.Timestamp),
+		Difficulty:  env.Difficulty,
+		GasLimit:    env.GasLimit,
+		GasPrice:    tx.GasPrice,
+		CoinBase:    env.Coinbase,
+	}
+	var receipt = &Receipt{
+		TxHash:          tx.Hash(),
+		ContractAddress: make([]byte, 20),
+	}
+	var logIndex = len(memoryDB.GetLog())
+	vm := evm.New(bc, memoryDB, ctx)
+	vm.SetPrecompiles(precompiles)
+	vm.SetEIP161(true)
+	if tx.To == nil {
+		var address evm.Address
+		_, address, err = vm.Create(sender)
+		if err != nil {
+			account = memoryDB.GetAccount(sender).Copy()
+			account.SetNonce(tx.Nonce + 1)
+			if err := memoryDB.UpdateAccount(account); err != nil {
+				return nil, err
+			}
+		} else {
+			receipt.ContractAddress = address.Bytes()
+		}
+	} else {
+		to := bc.BytesToAddress(tx.To)
+		_, err = vm.Call(sender, to, memoryDB.GetAccount(to).GetCode())
+	}
+	if err != nil && err.Error() != errors.ExecutionReverted.Error() {
+		gasLeft = 0
+	}
+	var gasUsed = tx.Gas - gasLeft
+	if err == nil {
+		refund := vm.GetRefund()
+		if refund > gasUsed/2 {
+			refund = gasUsed / 2
+		}
+		gasUsed -= refund
+	}
+	if err := addBalance(memoryDB, sender, (tx.Gas-gasUsed)*tx.GasPrice); err != nil {
+		return nil, err
+	}
+	if err := addBalance(memoryDB, bc.BytesToAddress(env.Coinbase), gasUsed*tx.GasPrice); err != nil {
+		return nil, err
+	}
+	receipt.GasUsed = gasUsed
+	if err == nil {
+		receipt.Status = 1
+	}
+	receipt.Logs = memoryDB.GetLog()[logIndex:]
+	receipt.LogsBloom = Bloom(receipt.Logs)
+	return receipt, nil
+}
+
+// addBalance add balance to account, and the account is deleted if it is still empty(EIP-161)
+func addBalance(memoryDB *db.Memory, address evm.Address, amount uint64) error {
+	account := memoryDB.GetAccount(address).Copy()
+	if err := account.AddBalance(amount); err != nil {
+		return err
+	}
+	if account.GetBalance() == 0 && account.GetNonce() == 0 && len(account.GetCode()) == 0 {
+		memoryDB.DeleteAccount(address)
+		return nil
+	}
+	return memoryDB.UpdateAccount(account)
+}
+
+func mulUint64(a, b uint64) (uint64, bool) {
+	if a == 0 || b == 0 {
+		return 0, false
+	}
+	c := a * b
+	return c, c/b != a
+}
+
+// blockchain provides the block hashes of env
+type blockchain struct {
+	*example.Blockchain
+	env *Env
+}
+
+// GetBlockHash is the implementation of evm.Blockchain
+func (bc *blockchain) GetBlockHash(num uint64) []byte {
+	if hash, ok := bc.env.BlockHashes[num]; ok && num < bc.env.Number && num+256 >= bc.env.Number {
+		return core.LeftPadWord256(hash).Bytes()
+	}
+	return make([]byte, 32)
+}
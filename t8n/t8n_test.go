@@ -0,0 +1,182 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package t8n
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/thu-arxan/evm/crypto"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/rlp"
+	"github.com/thu-arxan/evm/state"
+	"github.com/thu-arxan/evm/trie"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionSign(t *testing.T) {
+	// the example of EIP-155
+	var tx Transaction
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"nonce": "0x9", "gasPrice": "0x4a817c800", "gas": "0x5208",
+		"to": "0x3535353535353535353535353535353535353535", "value": "0xde0b6b3a7640000", "input": "0x",
+		"secretKey": "0x4646464646464646464646464646464646464646464646464646464646464646"}`), &tx))
+	require.Equal(t, "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53", fmt.Sprintf("%x", tx.sigHash(1)))
+	require.NoError(t, tx.Sign(1))
+	r, _ := new(big.Int).SetString("18515461264373351373200002665853028612451056578545711640558177340181847433846", 10)
+	s, _ := new(big.Int).SetString("46948507304638947509940763649030358759909902576025900602547168820602576006531", 10)
+	require.EqualValues(t, 37, tx.V.Uint64())
+	require.Equal(t, r, tx.R)
+	require.Equal(t, s, tx.S)
+	require.Equal(t, "33469b22e9f636356c4160a87eb19df52b7412e8eac32a4a55ffe88ea8350788", fmt.Sprintf("%x", tx.Hash()))
+	sender, err := tx.Sender()
+	require.NoError(t, err)
+	require.Equal(t, "9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f", fmt.Sprintf("%x", sender))
+}
+
+const (
+	sender    = "0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"
+	secretKey = "0x45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8"
+	coinbase  = "0xc94f5374fce5edbc8e2a8697c15331677e6ebf0b"
+	contract  = "0x00000000000000000000000000000000000000aa"
+)
+
+func TestTransition(t *testing.T) {
+	var alloc state.Alloc
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"`+sender+`": {"balance": "0x1000000", "nonce": "0x1"},
+		"`+contract+`": {"code": "0x6001600155600060006000a1"}
+	}`), &alloc))
+	var env Env
+	require.NoError(t, json.Unmarshal([]byte(`{"currentCoinbase": "`+coinbase+`", "currentDifficulty": "0x20000",
+		"currentGasLimit": "0x100000", "currentNumber": "1", "currentTimestamp": "1000"}`), &env))
+	var txs []*Transaction
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"gas": "0x10000", "gasPrice": "0x1", "nonce": "0x1", "to": "`+contract+`", "value": "0x10", "input": "0x", "secretKey": "`+secretKey+`"},
+		{"gas": "0x10000", "gasPrice": "0x1", "nonce": "0x1", "to": "`+contract+`", "value": "0x0", "input": "0x", "secretKey": "`+secretKey+`"},
+		{"gas": "0x5000", "gasPrice": "0x1", "nonce": "0x2", "to": "`+contract+`", "value": "0x0", "input": "0x", "secretKey": "`+secretKey+`"},
+		{"gas": "0x10000", "gasPrice": "0x1", "nonce": "0x2", "to": null, "value": "0x0", "input": "0x60016000f3", "secretKey": "`+secretKey+`"},
+		{"gas": "0x100000", "gasPrice": "0x1", "nonce": "0x3", "to": "`+contract+`", "value": "0x0", "input": "0x", "secretKey": "`+secretKey+`"}
+	]`), &txs))
+
+	result, post, err := Transition(&Config{ChainID: 1, Reward: 5}, alloc, &env, txs)
+	require.NoError(t, err)
+	require.Len(t, result.Receipts, 2)
+	require.Equal(t, []*Rejected{
+		{Index: 1, Error: "nonce mismatch: address " + sender + ", tx: 1 state: 2"},
+		{Index: 2, Error: "intrinsic gas too low: have 20480, want 21000"},
+		{Index: 4, Error: "gas limit reached"},
+	}, result.Rejected)
+
+	call := result.Receipts[0]
+	require.EqualValues(t, 1, call.Status)
+	require.EqualValues(t, 21000+20006+9+750, call.GasUsed)
+	require.Len(t, call.Logs, 1)
+	require.Equal(t, call.TxHash, call.Logs[0].TxHash)
+	require.NotEqual(t, make([]byte, 256), call.LogsBloom)
+	require.Equal(t, call.LogsBloom, result.LogsBloom)
+
+	create := result.Receipts[1]
+	require.EqualValues(t, 1, create.Status)
+	require.EqualValues(t, 1, create.TransactionIndex)
+	require.EqualValues(t, call.GasUsed+create.GasUsed, create.CumulativeGasUsed)
+	require.EqualValues(t, create.CumulativeGasUsed, result.GasUsed)
+	// the address created by sender with nonce 2
+	require.Equal(t, "0x"+util.Hex(create.ContractAddress), "0x"+util.Hex(mustCreateAddress(t, sender, 2)))
+
+	require.EqualValues(t, 0x1000000-0x10-result.GasUsed, post[sender].Balance)
+	require.EqualValues(t, 3, post[sender].Nonce)
+	require.EqualValues(t, result.GasUsed+5, post[coinbase].Balance)
+	require.EqualValues(t, 0x10, post[contract].Balance)
+	require.Len(t, post[contract].Storage, 1)
+	require.Equal(t, []byte{0x00}, post["0x"+util.Hex(create.ContractAddress)].Code)
+
+	// the state root commits to the post alloc, and the roots of applied transactions and receipts are computed
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	require.NoError(t, post.Write(bc, memoryDB.NewWriteBatch()))
+	require.Equal(t, state.Root(memoryDB), result.StateRoot)
+	require.Equal(t, DeriveRoot([][]byte{txs[0].RLP(), txs[3].RLP()}), result.TxRoot)
+	require.Equal(t, DeriveRoot([][]byte{call.RLP(), create.RLP()}), result.ReceiptsRoot)
+	require.Equal(t, trie.EmptyRoot, DeriveRoot(nil))
+
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, "0x20000", decoded["currentDifficulty"])
+	require.Equal(t, "0x"+util.Hex(result.StateRoot), decoded["stateRoot"])
+	require.Len(t, decoded["receipts"], 2)
+}
+
+func TestTransitionFailure(t *testing.T) {
+	var alloc = state.Alloc{sender: &state.Account{Balance: 1000000}}
+	var env = Env{Coinbase: util.Hex2Bytes(coinbase[2:]), GasLimit: 1000000}
+	txs := []*Transaction{
+		// the init code reverts
+		{Gas: 60000, GasPrice: 1, Input: util.Hex2Bytes("60006000fd"), SecretKey: util.Hex2Bytes(secretKey[2:])},
+		// the init code runs out of gas
+		{Nonce: 1, Gas: 60000, GasPrice: 1, Input: util.Hex2Bytes("5b600056"), SecretKey: util.Hex2Bytes(secretKey[2:])},
+		{Nonce: 2, Gas: 21000, GasPrice: 100, Value: 1, To: util.Hex2Bytes(contract[2:]), SecretKey: util.Hex2Bytes(secretKey[2:])},
+	}
+	result, post, err := Transition(&Config{Reward: -1}, alloc, &env, txs)
+	require.NoError(t, err)
+	require.Len(t, result.Receipts, 2)
+	require.EqualValues(t, 0, result.Receipts[0].Status)
+	require.EqualValues(t, 53000+56+6, result.Receipts[0].GasUsed)
+	require.EqualValues(t, 0, result.Receipts[1].Status)
+	require.EqualValues(t, 60000, result.Receipts[1].GasUsed)
+	require.Equal(t, []*Rejected{{Index: 2, Error: "insufficient funds for gas * price + value: address " + sender}}, result.Rejected)
+	require.EqualValues(t, 2, post[sender].Nonce)
+	require.EqualValues(t, 1000000-result.GasUsed, post[sender].Balance)
+	require.EqualValues(t, result.GasUsed, post[coinbase].Balance)
+}
+
+func TestTransitionFork(t *testing.T) {
+	var alloc = state.Alloc{sender: &state.Account{Balance: 1000000}}
+	var env = Env{Coinbase: util.Hex2Bytes(coinbase[2:]), GasLimit: 1000000}
+	var gasUsed = make(map[string]uint64)
+	for _, fork := range []string{"", "Istanbul"} {
+		txs := []*Transaction{
+			{Gas: 100000, GasPrice: 1, To: util.Hex2Bytes("0000000000000000000000000000000000000005"), Input: make([]byte, 96), SecretKey: util.Hex2Bytes(secretKey[2:])},
+		}
+		result, _, err := Transition(&Config{Reward: -1, Fork: fork}, alloc, &env, txs)
+		require.NoError(t, err)
+		require.Len(t, result.Receipts, 1)
+		require.EqualValues(t, 1, result.Receipts[0].Status)
+		gasUsed[fork] = result.GasUsed
+	}
+	require.Equal(t, gasUsed[""], gasUsed["Istanbul"])
+
+	// the gas rules of other forks are not implemented, even if their precompile contracts are
+	for _, fork := range []string{"Berlin", "London", "Prague", "MuirGlacier", "Unknown"} {
+		_, _, err := Transition(&Config{Fork: fork}, alloc, &env, nil)
+		require.Error(t, err, fork)
+	}
+}
+
+func mustCreateAddress(t *testing.T, sender string, nonce uint64) []byte {
+	data, err := rlp.EncodeToBytes([]interface{}{util.Hex2Bytes(sender[2:]), nonce})
+	require.NoError(t, err)
+	return crypto.Keccak256(data)[12:]
+}
@@ -0,0 +1,220 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package t8n
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/thu-arxan/evm/crypto"
+	"github.com/thu-arxan/evm/rlp"
+	"github.com/thu-arxan/evm/state"
+	"github.com/thu-arxan/evm/util"
+)
+
+// Transaction is a legacy transaction, which is signed by V, R, S or SecretKey
+type Transaction struct {
+	Nonce    uint64
+	GasPrice uint64
+	Gas      uint64
+	// To is nil if the transaction creates a contract
+	To    []byte
+	Value uint64
+	Input []byte
+	V     *big.Int
+	R     *big.Int
+	S     *big.Int
+	// SecretKey is used to sign the transaction if it is not nil
+	SecretKey []byte
+}
+
+type jsonTransaction struct {
+	Type      string          `json:"type"`
+	Nonce     json.RawMessage `json:"nonce"`
+	GasPrice  json.RawMessage `json:"gasPrice"`
+	Gas       json.RawMessage `json:"gas"`
+	To        *string         `json:"to"`
+	Value     json.RawMessage `json:"value"`
+	Input     string          `json:"input"`
+	Data      string          `json:"data"`
+	V         string          `json:"v"`
+	R         string          `json:"r"`
+	S         string          `json:"s"`
+	SecretKey string          `json:"secretKey"`
+}
+
+// UnmarshalJSON is the implementation of json.Unmarshaler
+func (tx *Transaction) UnmarshalJSON(data []byte) (err error) {
+	var t jsonTransaction
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	if t.Type != "" && t.Type != "0x0" && t.Type != "0x00" {
+		return fmt.Errorf("unsupported transaction type %s", t.Type)
+	}
+	if tx.Nonce, err = state.ParseUint64(t.Nonce); err != nil {
+		return fmt.Errorf("invalid nonce: %v", err)
+	}
+	if tx.GasPrice, err = state.ParseUint64(t.GasPrice); err != nil {
+		return fmt.Errorf("invalid gasPrice: %v", err)
+	}
+	if tx.Gas, err = state.ParseUint64(t.Gas); err != nil {
+		return fmt.Errorf("invalid gas: %v", err)
+	}
+	if tx.Value, err = state.ParseUint64(t.Value); err != nil {
+		return fmt.Errorf("invalid value: %v", err)
+	}
+	if t.To != nil && *t.To != "" {
+		if tx.To, err = util.HexToBytes(*t.To); err != nil || len(tx.To) != 20 {
+			return fmt.Errorf("invalid to %s", *t.To)
+		}
+	}
+	var input = t.Input
+	if input == "" {
+		input = t.Data
+	}
+	if tx.Input, err = util.HexToBytes(input); err != nil {
+		return fmt.Errorf("invalid input: %v", err)
+	}
+	if t.SecretKey != "" {
+		if tx.SecretKey, err = util.HexToBytes(t.SecretKey); err != nil {
+			return fmt.Errorf("invalid secretKey: %v", err)
+		}
+	}
+	for _, v := range []struct {
+		s   string
+		dst **big.Int
+	}{{t.V, &tx.V}, {t.R, &tx.R}, {t.S, &tx.S}} {
+		if v.s == "" {
+			continue
+		}
+		bytes, err := util.HexToBytes(evenHex(v.s))
+		if err != nil {
+			return fmt.Errorf("invalid signature value %s", v.s)
+		}
+		*v.dst = new(big.Int).SetBytes(bytes)
+	}
+	return nil
+}
+
+// Sign signs the transaction by SecretKey, and EIP-155 is used if chainID is not 0
+func (tx *Transaction) Sign(chainID uint64) error {
+	key, err := crypto.ToECDSA(tx.SecretKey)
+	if err != nil {
+		return err
+	}
+	sig, err := crypto.Sign(tx.sigHash(chainID), key)
+	if err != nil {
+		return err
+	}
+	tx.R = new(big.Int).SetBytes(sig[:32])
+	tx.S = new(big.Int).SetBytes(sig[32:64])
+	tx.V = new(big.Int).SetUint64(uint64(sig[64]) + 27)
+	if chainID != 0 {
+		tx.V.SetUint64(uint64(sig[64]) + 35 + 2*chainID)
+	}
+	return nil
+}
+
+// Sender recover the address of sender from signature
+func (tx *Transaction) Sender() ([]byte, error) {
+	if tx.V == nil || tx.R == nil || tx.S == nil {
+		return nil, errors.New("transaction is not signed")
+	}
+	var chainID uint64
+	var recID uint64
+	if !tx.V.IsUint64() {
+		return nil, errors.New("invalid v")
+	}
+	switch v := tx.V.Uint64(); {
+	case v == 27 || v == 28:
+		recID = v - 27
+	case v >= 35:
+		chainID = (v - 35) / 2
+		recID = (v - 35) % 2
+	default:
+		return nil, errors.New("invalid v")
+	}
+	if !crypto.ValidateSignatureValues(byte(recID), tx.R, tx.S, true) {
+		return nil, errors.New("invalid signature values")
+	}
+	var sig = make([]byte, 65)
+	copy(sig[32-len(tx.R.Bytes()):32], tx.R.Bytes())
+	copy(sig[64-len(tx.S.Bytes()):64], tx.S.Bytes())
+	sig[64] = byte(recID)
+	pub, err := crypto.Ecrecover(tx.sigHash(chainID), sig)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(pub[1:])[12:], nil
+}
+
+// Hash return the hash of signed transaction
+func (tx *Transaction) Hash() []byte {
+	return crypto.Keccak256(tx.RLP())
+}
+
+// RLP return the rlp encoding of signed transaction
+func (tx *Transaction) RLP() []byte {
+	data, _ := rlp.EncodeToBytes([]interface{}{tx.Nonce, tx.GasPrice, tx.Gas, tx.to(), tx.Value, tx.Input, tx.V, tx.R, tx.S})
+	return data
+}
+
+// IntrinsicGas return the gas charged before execution, which follows Istanbul
+func (tx *Transaction) IntrinsicGas() uint64 {
+	var gas uint64 = 21000
+	if tx.To == nil {
+		gas += 32000
+	}
+	for _, b := range tx.Input {
+		if b == 0 {
+			gas += 4
+		} else {
+			gas += 16
+		}
+	}
+	return gas
+}
+
+func (tx *Transaction) sigHash(chainID uint64) []byte {
+	var fields = []interface{}{tx.Nonce, tx.GasPrice, tx.Gas, tx.to(), tx.Value, tx.Input}
+	if chainID != 0 {
+		fields = append(fields, chainID, uint(0), uint(0))
+	}
+	data, _ := rlp.EncodeToBytes(fields)
+	return crypto.Keccak256(data)
+}
+
+func (tx *Transaction) to() []byte {
+	if tx.To == nil {
+		return []byte{}
+	}
+	return tx.To
+}
+
+// evenHex pads a hex string to even length, because big number is encoded without leading zero
+func evenHex(s string) string {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		return "0" + s
+	}
+	return s
+}
@@ -0,0 +1,254 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tests
+
+import (
+	"github.com/thu-arxan/evm/precompile"
+	"github.com/thu-arxan/evm/util"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	blsP, _ = new(big.Int).SetString("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffaaab", 16)
+	blsR, _ = new(big.Int).SetString("73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001", 16)
+
+	blsG1 = blsFp("17f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb") +
+		blsFp("08b3f481e3aaa0f1a09e30ed741d8ae4fcf5e095d5d00af600db18cb2c04b3edd03cc744a2888ae40caa232946c5e7e1")
+	blsG1Double = blsFp("0572cbea904d67468808c8eb50a9450c9721db309128012543902d0ac358a62ae28f75bb8f1c7c42c39a8c5529bf0f4e") +
+		blsFp("166a9d8cabc673a322fda673779d8e3822ba3ecb8670e461f73bb9021d5fd76a4c56d9d4cd16bd1bba86881979749d28")
+	blsG2 = blsFp("024aa2b2f08f0a91260805272dc51051c6e47ad4fa403b02b4510b647ae3d1770bac0326a805bbefd48056c8c121bdb8") +
+		blsFp("13e02b6052719f607dacd3a088274f65596bd0d09920b61ab5da61bbdc7f5049334cf11213945d57e5ac7d055d042b7e") +
+		blsFp("0ce5d527727d6e118cc9cdc6da2e351aadfd9baa8cbdd3a76d429a695160d12c923ac9cc3baca289e193548608b82801") +
+		blsFp("0606c4a02ea734cc32acd2b02bc28b99cb3e287e85a763af267492ab572e99ab3f370d275cec1da1aaa9075ff05f79be")
+	blsG1Infinity = strings.Repeat("00", 128)
+	blsG2Infinity = strings.Repeat("00", 256)
+)
+
+// blsFp encode a field element of 48 bytes hex into 64 bytes
+func blsFp(hex string) string {
+	return strings.Repeat("00", 16) + hex
+}
+
+func blsScalar(value *big.Int) string {
+	return util.Hex(util.LeftPadBytes(value.Bytes(), 32))
+}
+
+// blsNegG1 return -P by replacing y with p - y
+func blsNegG1(point string) string {
+	y, _ := new(big.Int).SetString(point[128:], 16)
+	return point[:128] + util.Hex(util.LeftPadBytes(new(big.Int).Sub(blsP, y).Bytes(), 64))
+}
+
+// blsNotInSubgroup return a G1 point on curve y^2 = x^3 + 4 which is not in the subgroup of order r
+func blsNotInSubgroup() string {
+	for x := big.NewInt(1); ; x.Add(x, big.NewInt(1)) {
+		y2 := new(big.Int).Exp(x, big.NewInt(3), blsP)
+		y2.Add(y2, big.NewInt(4))
+		if y := new(big.Int).ModSqrt(y2.Mod(y2, blsP), blsP); y != nil {
+			return util.Hex(util.LeftPadBytes(x.Bytes(), 64)) + util.Hex(util.LeftPadBytes(y.Bytes(), 64))
+		}
+	}
+}
+
+func runBLS(t *testing.T, address byte, input string) (string, error) {
+	contract, err := precompile.New([]byte{address}, precompile.Prague)
+	require.NoError(t, err)
+	output, err := contract.Run(util.Hex2Bytes(input))
+	return util.Hex(output), err
+}
+
+func TestBLS12381G1(t *testing.T) {
+	var valids = []struct {
+		address byte
+		input   string
+		output  string
+	}{
+		{0x0b, blsG1 + blsG1, blsG1Double},
+		{0x0b, blsG1 + blsG1Infinity, blsG1},
+		{0x0b, blsG1 + blsNegG1(blsG1), blsG1Infinity},
+		{0x0b, blsG1Infinity + blsG1Infinity, blsG1Infinity},
+		{0x0c, blsG1 + blsScalar(big.NewInt(2)), blsG1Double},
+		{0x0c, blsG1 + blsScalar(big.NewInt(0)), blsG1Infinity},
+		{0x0c, blsG1Infinity + blsScalar(big.NewInt(2)), blsG1Infinity},
+		// the scalar is not required to be less than r
+		{0x0c, blsG1 + blsScalar(new(big.Int).Add(blsR, big.NewInt(2))), blsG1Double},
+		{0x0c, blsG1 + blsScalar(big.NewInt(1)) + blsG1 + blsScalar(big.NewInt(1)), blsG1Double},
+		{0x0c, blsG1 + blsScalar(big.NewInt(3)) + blsNegG1(blsG1) + blsScalar(big.NewInt(1)) + blsG1Infinity + blsScalar(big.NewInt(5)), blsG1Double},
+		// the point of addition is not required to be in the subgroup
+		{0x0b, blsNotInSubgroup() + blsG1Infinity, blsNotInSubgroup()},
+	}
+	for i, test := range valids {
+		output, err := runBLS(t, test.address, test.input)
+		require.NoError(t, err, i)
+		require.Equal(t, test.output, output, i)
+	}
+
+	var notOnCurve = blsG1[:128] + blsG1Double[128:]
+	var invalids = []struct {
+		address byte
+		input   string
+	}{
+		{0x0b, blsG1},
+		{0x0b, blsG1 + blsG1 + "00"},
+		{0x0b, blsG1 + notOnCurve},
+		{0x0b, "01" + blsG1[2:] + blsG1},
+		{0x0b, util.Hex(util.LeftPadBytes(blsP.Bytes(), 64)) + blsG1[128:] + blsG1},
+		{0x0c, ""},
+		{0x0c, blsG1 + blsScalar(big.NewInt(1)) + "00"},
+		{0x0c, notOnCurve + blsScalar(big.NewInt(1))},
+		{0x0c, blsNotInSubgroup() + blsScalar(big.NewInt(1))},
+	}
+	for i, test := range invalids {
+		_, err := runBLS(t, test.address, test.input)
+		require.Error(t, err, i)
+	}
+}
+
+func TestBLS12381G2(t *testing.T) {
+	double, err := runBLS(t, 0x0d, blsG2+blsG2)
+	require.NoError(t, err)
+	require.NotEqual(t, blsG2, double)
+	var valids = []struct {
+		address byte
+		input   string
+		output  string
+	}{
+		{0x0d, blsG2 + blsG2Infinity, blsG2},
+		{0x0d, blsG2Infinity + blsG2Infinity, blsG2Infinity},
+		{0x0e, blsG2 + blsScalar(big.NewInt(2)), double},
+		{0x0e, blsG2 + blsScalar(new(big.Int).Add(blsR, big.NewInt(2))), double},
+		{0x0e, blsG2 + blsScalar(big.NewInt(1)) + blsG2 + blsScalar(big.NewInt(1)), double},
+		{0x0e, blsG2 + blsScalar(blsR), blsG2Infinity},
+	}
+	for i, test := range valids {
+		output, err := runBLS(t, test.address, test.input)
+		require.NoError(t, err, i)
+		require.Equal(t, test.output, output, i)
+	}
+	for i, input := range []string{"", blsG2, blsG2 + blsG2 + "00", "01" + blsG2[2:] + blsG2, blsG2[:256] + blsG2[:256] + blsG2} {
+		_, err := runBLS(t, 0x0d, input)
+		require.Error(t, err, i)
+	}
+	for i, input := range []string{"", blsG2, blsG2 + blsScalar(big.NewInt(1)) + "00"} {
+		_, err := runBLS(t, 0x0e, input)
+		require.Error(t, err, i)
+	}
+}
+
+func TestBLS12381Pairing(t *testing.T) {
+	g2Double, err := runBLS(t, 0x0d, blsG2+blsG2)
+	require.NoError(t, err)
+	var tests = []struct {
+		input  string
+		output byte
+	}{
+		{blsG1 + blsG2, 0},
+		{blsG1 + blsG2 + blsNegG1(blsG1) + blsG2, 1},
+		// e(2 * G1, G2) * e(-G1, 2 * G2) = 1
+		{blsG1Double + blsG2 + blsNegG1(blsG1) + g2Double, 1},
+		{blsG1Double + blsG2 + blsNegG1(blsG1) + blsG2, 0},
+		{blsG1Infinity + blsG2, 1},
+		{blsG1 + blsG2Infinity + blsG1Infinity + blsG2Infinity, 1},
+	}
+	for i, test := range tests {
+		output, err := runBLS(t, 0x0f, test.input)
+		require.NoError(t, err, i)
+		require.Equal(t, util.Hex(util.LeftPadBytes([]byte{test.output}, 32)), output, i)
+	}
+	for i, input := range []string{"", blsG1 + blsG2 + "00", blsNotInSubgroup() + blsG2, blsG2 + blsG1} {
+		_, err := runBLS(t, 0x0f, input)
+		require.Error(t, err, i)
+	}
+
+	// the pairing check could be called by every call variant since Prague
+	pairing := util.Hex2Bytes(blsG1Infinity + blsG2)
+	for _, op := range callOps {
+		output, err := callPrecompile(t, op, "0x0f", pairing, func(set *precompile.Set) {
+			contract, _ := precompile.New([]byte{0x0f}, precompile.Prague)
+			require.NoError(t, set.Add([]byte{0x0f}, contract))
+		})
+		require.NoError(t, err, op)
+		require.Equal(t, util.LeftPadBytes([]byte{1}, 32), output, op)
+	}
+}
+
+// The vectors of BLS12381G1_XMD:SHA-256_SSWU_NU_ and BLS12381G2_XMD:SHA-256_SSWU_NU_
+// in RFC 9380 with empty message, the input is the u of hash_to_field
+func TestBLS12381MapToCurve(t *testing.T) {
+	output, err := runBLS(t, 0x10, blsFp("156c8a6a2c184569d69a76be144b5cdc5141d2d2ca4fe341f011e25e3969c55ad9e9b9ce2eb833c81a908e5fa4ac5f03"))
+	require.NoError(t, err)
+	require.Equal(t, blsFp("184bb665c37ff561a89ec2122dd343f20e0f4cbcaec84e3c3052ea81d1834e192c426074b02ed3dca4e7676ce4ce48ba")+
+		blsFp("04407b8d35af4dacc809927071fc0405218f1401a6d15af775810e4e460064bcc9468beeba82fdc751be70476c888bf3"), output)
+
+	output, err = runBLS(t, 0x11, blsFp("07355d25caf6e7f2f0cb2812ca0e513bd026ed09dda65b177500fa31714e09ea0ded3a078b526bed3307f804d4b93b04")+
+		blsFp("02829ce3c021339ccb5caf3e187f6370e1e2a311dec9b75363117063ab2015603ff52c3d3b98f19c2f65575e99e8b78c"))
+	require.NoError(t, err)
+	require.Equal(t, blsFp("00e7f4568a82b4b7dc1f14c6aaa055edf51502319c723c4dc2688c7fe5944c213f510328082396515734b6612c4e7bb7")+
+		blsFp("126b855e9e69b1f691f816e48ac6977664d24d99f8724868a184186469ddfd4617367e94527d4b74fc86413483afb35b")+
+		blsFp("0caead0fd7b6176c01436833c79d305c78be307da5f6af6c133c47311def6ff1e0babf57a0fb5539fce7ee12407b0a42")+
+		blsFp("1498aadcf7ae2b345243e281ae076df6de84455d766ab6fcdaad71fab60abb2e8b980a440043cd305db09d283c895e3d"), output)
+
+	for i, input := range []string{"", blsFp("00") + "00", "01" + blsFp("00")[2:], util.Hex(util.LeftPadBytes(blsP.Bytes(), 64))} {
+		_, err := runBLS(t, 0x10, input)
+		require.Error(t, err, i)
+	}
+	for i, input := range []string{"", strings.Repeat("00", 64), "01" + strings.Repeat("00", 127), strings.Repeat("00", 64) + util.Hex(util.LeftPadBytes(blsP.Bytes(), 64))} {
+		_, err := runBLS(t, 0x11, input)
+		require.Error(t, err, i)
+	}
+}
+
+func TestBLS12381Gas(t *testing.T) {
+	var tests = []struct {
+		address byte
+		length  int
+		gas     uint64
+	}{
+		{0x0b, 256, 375},
+		{0x0c, 0, 0},
+		{0x0c, 160, 12000},
+		{0x0c, 320, 2 * 12000 * 949 / 1000},
+		{0x0c, 128 * 160, 128 * 12000 * 519 / 1000},
+		{0x0c, 200 * 160, 200 * 12000 * 519 / 1000},
+		{0x0d, 512, 600},
+		{0x0e, 288, 22500},
+		{0x0e, 2 * 288, 2 * 22500},
+		{0x0e, 3 * 288, 3 * 22500 * 923 / 1000},
+		{0x0e, 200 * 288, 200 * 22500 * 524 / 1000},
+		{0x0f, 0, 37700},
+		{0x0f, 2 * 384, 37700 + 2*32600},
+		{0x10, 64, 5500},
+		{0x11, 128, 23800},
+	}
+	for _, test := range tests {
+		contract, err := precompile.New([]byte{test.address}, precompile.Prague)
+		require.NoError(t, err)
+		require.Equal(t, test.gas, contract.RequiredGas(make([]byte, test.length)), "0x%x with %d bytes", test.address, test.length)
+	}
+	for address := byte(0x0b); address <= 0x11; address++ {
+		require.True(t, precompile.IsPrecompile([]byte{address}, precompile.Prague))
+		require.False(t, precompile.IsPrecompile([]byte{address}, precompile.Berlin))
+	}
+	fork, err := precompile.ParseFork("Prague")
+	require.NoError(t, err)
+	require.Len(t, precompile.ForkSet(fork).Addresses(), 16)
+}
@@ -0,0 +1,118 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tests
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/asm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestConcurrentQuery runs the read-only calls on snapshots while the blocks
+// are executed, and it should be run with -race
+func TestConcurrentQuery(t *testing.T) {
+	const calls = 100
+	bc := example.NewBlockchain()
+	concurrentDB := db.NewConcurrent(bc.NewAccount)
+	caller, counter := example.HexToAddress("aa"), example.HexToAddress("bb")
+	// increase the slot 0 of counter
+	increase := asm.MustAssemble(`
+		PUSH1 0
+		SLOAD
+		PUSH1 1
+		ADD
+		PUSH1 0
+		SSTORE
+	`)
+	// return the slot 0 of counter
+	query := asm.MustAssemble(`
+		PUSH1 0
+		SLOAD
+		PUSH1 0
+		MSTORE
+		PUSH1 32
+		PUSH1 0
+		RETURN
+	`)
+
+	// the query touches an account which is not exist, and nothing is written
+	var gas uint64 = 100000
+	output, err := evm.New(bc, concurrentDB.Snapshot(), &evm.Context{Gas: &gas}).Call(caller, example.HexToAddress("cc"), query)
+	require.NoError(t, err)
+	require.Equal(t, core.Zero256.Bytes(), output)
+	// the counter has code, otherwise it is an empty account and the query reads nothing
+	wb := concurrentDB.NewWriteBatch()
+	account := bc.NewAccount(counter)
+	account.SetCode(query)
+	require.NoError(t, wb.UpdateAccount(account))
+	require.NoError(t, wb.Commit())
+
+	var wg sync.WaitGroup
+	var done = make(chan struct{})
+	var errs = make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snapshot := concurrentDB.Snapshot()
+				var gas uint64 = 100000
+				output, err := evm.New(example.NewBlockchain(), snapshot, &evm.Context{Gas: &gas}).Call(caller, counter, query)
+				if err != nil {
+					errs <- err
+					return
+				}
+				// the counter is created by the first commit
+				if got := core.Uint64FromWord256(core.BytesToWord256(output)); got+1 != snapshot.Seq() {
+					errs <- fmt.Errorf("query %d on snapshot %d", got, snapshot.Seq())
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < calls; i++ {
+		var gas uint64 = 100000
+		_, err := evm.New(bc, concurrentDB, &evm.Context{Gas: &gas}).Call(caller, counter, increase)
+		require.NoError(t, err)
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, core.Uint64ToWord256(calls).Bytes(), concurrentDB.GetStorage(counter, core.Zero256.Bytes()))
+
+	// the call which writes could not run on a snapshot
+	gas = 100000
+	_, err = evm.New(bc, concurrentDB.Snapshot(), &evm.Context{Gas: &gas}).Call(caller, counter, increase)
+	require.True(t, errors.Is(err, db.ErrReadOnly))
+}
@@ -0,0 +1,171 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tests
+
+import (
+	"github.com/thu-arxan/evm"
+	abi "github.com/thu-arxan/evm/abi"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/state"
+	"github.com/thu-arxan/evm/util"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// fuzzGas bounds the steps and the memory of a run
+	fuzzGas uint64 = 100000
+	// fuzzMaxSize bounds the code and input of a run, which is the maximum code
+	// size of EIP-170, so a run never spends its time on hashing or copying a
+	// huge input
+	fuzzMaxSize = 24576
+	fuzzCaller  = example.HexToAddress("6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0")
+	fuzzCallee  = example.HexToAddress("cd234a471b72ba2f1ccf0a70fcaba648a5eecd8d")
+)
+
+// FuzzCall runs arbitrary code with arbitrary input, the seed corpus is made of
+// the init code and the runtime code of contracts in sols, and the runtime code
+// is called with the selector of every method.
+// Note: Run it by go test -run=^$ -fuzz=FuzzCall ./tests
+func FuzzCall(f *testing.F) {
+	bins, err := filepath.Glob("sols/*.bin")
+	require.NoError(f, err)
+	for _, bin := range bins {
+		code, err := util.ReadBinFile(bin)
+		if err != nil || len(code) == 0 {
+			continue
+		}
+		f.Add(code, []byte{})
+		runtime, err := deployRuntime(code)
+		if err != nil {
+			continue
+		}
+		f.Add(runtime, []byte{})
+		contract, err := abi.New(strings.TrimSuffix(bin, ".bin") + ".abi")
+		if err != nil {
+			continue
+		}
+		for _, method := range contract.Methods {
+			f.Add(runtime, method.ID())
+		}
+	}
+	f.Fuzz(func(t *testing.T, code, input []byte) {
+		if len(code) > fuzzMaxSize || len(input) > fuzzMaxSize {
+			t.Skip()
+		}
+		bc := example.NewBlockchain()
+		memoryDB := db.NewMemory(bc.NewAccount)
+		var pre = state.Alloc{
+			fmt.Sprintf("%x", fuzzCaller.Bytes()): &state.Account{Balance: 1000000},
+			fmt.Sprintf("%x", fuzzCallee.Bytes()): &state.Account{Balance: 1000000, Code: code},
+		}
+		require.NoError(t, pre.Write(bc, memoryDB.NewWriteBatch()))
+		before := state.Dump(memoryDB)
+
+		var gas = fuzzGas
+		vm := evm.New(bc, memoryDB, &evm.Context{
+			Input: input,
+			Gas:   &gas,
+		})
+		checker := &gasChecker{}
+		vm.SetTracer(checker)
+		_, err := vm.Call(fuzzCaller, fuzzCallee, code)
+		require.True(t, gas <= fuzzGas, "gas increases from %d to %d", fuzzGas, gas)
+		require.NoError(t, checker.err)
+
+		after := state.Dump(memoryDB)
+		if err != nil {
+			// the cache should never be synced to db if the call fails
+			require.Equal(t, before, after)
+			require.Empty(t, memoryDB.GetLog())
+			return
+		}
+		// balance could be burned by SELFDESTRUCT, but never be created
+		require.True(t, totalBalance(after) <= totalBalance(before), "balance increases from %d to %d", totalBalance(before), totalBalance(after))
+	})
+}
+
+// gasChecker is a tracer which checks the gas of every step never increases
+type gasChecker struct {
+	// gas is the gas left of every running frame
+	gas []uint64
+	err error
+}
+
+func (c *gasChecker) CaptureEnter(frame *evm.Frame) {
+	if len(c.gas) > 0 && frame.Gas > c.gas[len(c.gas)-1] {
+		c.fail("frame at depth %d starts with gas %d more than %d of its caller", frame.Depth, frame.Gas, c.gas[len(c.gas)-1])
+	}
+	c.gas = append(c.gas, frame.Gas)
+}
+
+func (c *gasChecker) CaptureState(step *evm.Step) {
+	if len(c.gas) == 0 {
+		return
+	}
+	if step.Gas > c.gas[len(c.gas)-1] {
+		c.fail("gas increases from %d to %d before %v at pc %d", c.gas[len(c.gas)-1], step.Gas, step.Op, step.PC)
+	}
+	c.gas[len(c.gas)-1] = step.Gas
+}
+
+func (c *gasChecker) CaptureStateEnd(step *evm.Step) {
+	if step.Cost > step.Gas {
+		c.fail("%v at pc %d costs %d more than gas left %d", step.Op, step.PC, step.Cost, step.Gas)
+	}
+}
+
+func (c *gasChecker) CaptureExit(frame *evm.Frame, output []byte, gasUsed uint64, err error) {
+	if gasUsed > frame.Gas {
+		c.fail("frame at depth %d uses gas %d more than %d", frame.Depth, gasUsed, frame.Gas)
+	}
+	if len(c.gas) > 0 {
+		c.gas = c.gas[:len(c.gas)-1]
+	}
+}
+
+func (c *gasChecker) fail(format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = fmt.Errorf(format, args...)
+	}
+}
+
+func deployRuntime(bin []byte) ([]byte, error) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	var gas uint64 = 1000000
+	vm := evm.New(bc, memoryDB, &evm.Context{
+		Input: bin,
+		Gas:   &gas,
+	})
+	code, _, err := vm.Create(fuzzCaller)
+	return code, err
+}
+
+func totalBalance(alloc state.Alloc) uint64 {
+	var total uint64
+	for _, account := range alloc {
+		total += account.Balance
+	}
+	return total
+}
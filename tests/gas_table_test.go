@@ -0,0 +1,108 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tests
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/errors"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/gas"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stepCost records the cost of the opcode at pc of the outermost frame
+type stepCost struct {
+	frame *evm.Frame
+	pc    uint64
+	cost  uint64
+	err   error
+}
+
+func (s *stepCost) CaptureEnter(frame *evm.Frame) {
+	if s.frame == nil {
+		s.frame = frame
+	}
+}
+
+func (s *stepCost) CaptureState(step *evm.Step) {}
+
+func (s *stepCost) CaptureStateEnd(step *evm.Step) {
+	if step.Frame == s.frame && step.PC == s.pc {
+		// the memory expansion is not constant
+		s.cost, s.err = step.Cost-step.MemoryCost, step.Err
+	}
+}
+
+func (s *stepCost) CaptureExit(frame *evm.Frame, output []byte, gasUsed uint64, err error) {}
+
+// TestConstantGas checks that ConstantGas of every opcode is the gas the
+// interpreter charges, the operands are zero so the dynamic gas is known
+func TestConstantGas(t *testing.T) {
+	// the operands are 17 zeros, which are enough for DUP16 and SWAP16
+	const operands = 17
+	var pc = uint64(operands * 2)
+	for i := 0; i < 256; i++ {
+		op := evm.OpCode(i)
+		var code []byte
+		for j := 0; j < operands; j++ {
+			code = append(code, byte(evm.PUSH1), 0)
+		}
+		if op == evm.JUMP {
+			// jump to the JUMPDEST after it
+			code[len(code)-1] = byte(pc + 1)
+		}
+		code = append(code, byte(op))
+		if op >= evm.PUSH1 && op <= evm.PUSH32 {
+			code = append(code, make([]byte, op-evm.PUSH1+1)...)
+		}
+		code = append(code, byte(evm.JUMPDEST), byte(evm.STOP))
+
+		bc := example.NewBlockchain()
+		memoryDB := db.NewMemory(bc.NewAccount)
+		// the beneficiary of SELFDESTRUCT exists, so no account is created
+		require.NoError(t, memoryDB.InitBalance(bc.BytesToAddress(make([]byte, 20)), 1))
+		var gasLeft uint64 = 100000
+		vm := evm.New(bc, memoryDB, &evm.Context{Gas: &gasLeft})
+		tracer := &stepCost{pc: pc}
+		vm.SetTracer(tracer)
+		_, err := vm.Call(interpreterCaller, interpreterCallee, code)
+
+		var dynamic uint64
+		switch {
+		case op >= evm.LOG0 && op <= evm.LOG4:
+			dynamic = uint64(op-evm.LOG0) * gas.LogTopic
+		case op == evm.SSTORE:
+			dynamic = gas.SstoreNoopEIP2200
+		}
+		switch {
+		case op == evm.INVALID || err == errors.UnknownOpcode:
+			require.Error(t, err, op.String())
+			require.Zero(t, evm.ConstantGas(op), "%v", op)
+		case op == evm.REVERT:
+			require.Equal(t, errors.ExecutionReverted, err)
+			require.Equal(t, evm.ConstantGas(op), tracer.cost, op.String())
+		default:
+			require.NoError(t, err, op.String())
+			require.NoError(t, tracer.err, op.String())
+			require.Equal(t, evm.ConstantGas(op)+dynamic, tracer.cost, op.String())
+		}
+	}
+}
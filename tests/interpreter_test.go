@@ -0,0 +1,352 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tests
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/asm"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/errors"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/gas"
+	"github.com/thu-arxan/evm/util"
+	"bytes"
+	"fmt"
+	"math/big"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	interpreterCaller = example.HexToAddress("aa")
+	interpreterCallee = example.HexToAddress("bb")
+)
+
+// runWithCallee run code after the callee is deployed with calleeCode,
+// and return the output and gas used
+func runWithCallee(t *testing.T, code, calleeCode []byte) ([]byte, uint64) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	callee := bc.NewAccount(interpreterCallee)
+	callee.SetCode(calleeCode)
+	require.NoError(t, memoryDB.UpdateAccount(callee))
+	var gas uint64 = 100000
+	vm := evm.New(bc, memoryDB, &evm.Context{Gas: &gas})
+	output, err := vm.Call(interpreterCaller, example.HexToAddress("cc"), code)
+	require.NoError(t, err)
+	return output, 100000 - gas
+}
+
+// callCode return the code which fills memory[0:32] with 0xee, calls the callee
+// by op with the return window [retOffset, retOffset+retSize), then stores
+// MSIZE into memory[msizeOffset:msizeOffset+32] and returns memory[0:msizeOffset+32]
+func callCode(op string, retOffset, retSize, msizeOffset int) []byte {
+	var value string
+	if op == "CALL" || op == "CALLCODE" {
+		value = "PUSH1 0"
+	}
+	return asm.MustAssemble(fmt.Sprintf(`
+		PUSH32 0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee
+		PUSH1 0
+		MSTORE
+		PUSH %d ; retSize
+		PUSH %d ; retOffset
+		PUSH1 0 ; inSize
+		PUSH1 0 ; inOffset
+		%s
+		PUSH 0x%x
+		GAS
+		%s
+		POP
+		MSIZE
+		PUSH %d
+		MSTORE
+		PUSH %d
+		PUSH1 0
+		RETURN
+	`, retSize, retOffset, value, interpreterCallee.Bytes(), op, msizeOffset, msizeOffset+32))
+}
+
+func word(value uint64) []byte {
+	return util.LeftPadBytes(new(big.Int).SetUint64(value).Bytes(), 32)
+}
+
+// TestReturnDataTruncated checks that the return data is copied into the return
+// window as the yellow paper defines: μ'_m[retOffset ... retOffset+n-1] = o[0 ... n-1]
+// where n = min(retSize, |o|), so nothing is written past the window and the rest
+// of a longer window keeps its contents.
+func TestReturnDataTruncated(t *testing.T) {
+	// the callee returns 64 bytes, which are 0x11 * 32 || 0x22 * 32
+	long := asm.MustAssemble(`
+		PUSH32 0x1111111111111111111111111111111111111111111111111111111111111111
+		PUSH1 0
+		MSTORE
+		PUSH32 0x2222222222222222222222222222222222222222222222222222222222222222
+		PUSH1 32
+		MSTORE
+		PUSH1 64
+		PUSH1 0
+		RETURN
+	`)
+	// the callee returns 1 byte 0x11
+	short := asm.MustAssemble(`
+		PUSH1 0x11
+		PUSH1 0
+		MSTORE8
+		PUSH1 1
+		PUSH1 0
+		RETURN
+	`)
+	var ee = bytes.Repeat([]byte{0xee}, 32)
+	for _, op := range callOps {
+		// only retSize bytes of the longer return data are written, so memory
+		// is not grown past the window
+		output, _ := runWithCallee(t, callCode(op, 32, 32, 64), long)
+		require.Equal(t, util.BytesCombine(ee, bytes.Repeat([]byte{0x11}, 32), word(64)), output, op)
+
+		// the window which is longer than the return data keeps the rest unchanged
+		output, _ = runWithCallee(t, callCode(op, 0, 32, 32), short)
+		require.Equal(t, util.BytesCombine([]byte{0x11}, ee[1:], word(32)), output, op)
+
+		// the empty window gets nothing
+		output, _ = runWithCallee(t, callCode(op, 0, 0, 32), long)
+		require.Equal(t, util.BytesCombine(ee, word(32)), output, op)
+	}
+}
+
+// TestReturnWindowMemoryGas checks that the return window of a call expands
+// memory before the call and is charged as memory expansion, which follows the
+// yellow paper: μ'_i = M(M(μ_i, μ_s[3], μ_s[4]), μ_s[5], μ_s[6]) for CALL and
+// CALLCODE, and the windows of DELEGATECALL and STATICCALL shift by one, so
+// the memory fee covers both the input and the return windows.
+func TestReturnWindowMemoryGas(t *testing.T) {
+	var ee = bytes.Repeat([]byte{0xee}, 32)
+	for _, op := range callOps {
+		// the window is expanded and charged before the call, even if nothing is returned
+		output, used := runWithCallee(t, callCode(op, 0x1000, 32, 32), nil)
+		require.Equal(t, util.BytesCombine(ee, word(0x1020)), output, op)
+		_, usedWithoutWindow := runWithCallee(t, callCode(op, 0, 0, 32), nil)
+		// the memory fee of 129 words minus the fee of 2 words, which the code
+		// without window expands to by storing MSIZE
+		require.EqualValues(t, 3*129+129*129/512-3*2, used-usedWithoutWindow, op)
+
+		// the exact gas of a call to an account without code, whose return
+		// window [0, 64) costs the memory fee of 2 words
+		var value string
+		var pushes uint64 = 5
+		if op == "CALL" || op == "CALLCODE" {
+			value, pushes = "PUSH1 0", 6
+		}
+		code := asm.MustAssemble(fmt.Sprintf(`
+			PUSH1 64
+			PUSH1 0
+			PUSH1 0
+			PUSH1 0
+			%s
+			PUSH 0x%x
+			GAS
+			%s
+		`, value, interpreterCallee.Bytes(), op))
+		_, used = runWithCallee(t, code, nil)
+		require.EqualValues(t, pushes*gas.VeryLow+gas.Base+gas.Call+2*gas.Memory, used, op)
+	}
+}
+
+// TestNestedCallSync checks that the changes of an inner call are synced by the
+// outermost call only, so they are dropped if the outer call fails
+func TestNestedCallSync(t *testing.T) {
+	// the callee writes slot 0 and succeeds
+	store := asm.MustAssemble(`
+		PUSH1 1
+		PUSH1 0
+		SSTORE
+	`)
+	for _, end := range []string{"STOP", "PUSH1 0\nPUSH1 0\nREVERT"} {
+		bc := example.NewBlockchain()
+		memoryDB := db.NewMemory(bc.NewAccount)
+		callee := bc.NewAccount(interpreterCallee)
+		callee.SetCode(store)
+		require.NoError(t, memoryDB.UpdateAccount(callee))
+		code := asm.MustAssemble(fmt.Sprintf(`
+			PUSH1 0
+			PUSH1 0
+			PUSH1 0
+			PUSH1 0
+			PUSH1 0
+			PUSH 0x%x
+			GAS
+			CALL
+			POP
+			%s
+		`, interpreterCallee.Bytes(), end))
+		var gas uint64 = 100000
+		_, err := evm.New(bc, memoryDB, &evm.Context{Gas: &gas}).Call(interpreterCaller, example.HexToAddress("cc"), code)
+		if end == "STOP" {
+			require.NoError(t, err)
+			require.Equal(t, word(1), memoryDB.GetStorage(interpreterCallee, word(0)))
+		} else {
+			require.Error(t, err)
+			require.Nil(t, memoryDB.GetStorage(interpreterCallee, word(0)))
+		}
+	}
+}
+
+// TestNestedCallSyncDepth checks that the writes of a succeeded frame at any
+// depth are dropped if a frame above it fails, since the yellow paper reverts
+// the state to the one before the failed frame, including the changes of the
+// frames it made
+func TestNestedCallSyncDepth(t *testing.T) {
+	inner := example.HexToAddress("dd")
+	// the inner callee writes slot 0 and succeeds, and the callee calls it and succeeds
+	store := asm.MustAssemble(`
+		PUSH1 1
+		PUSH1 0
+		SSTORE
+	`)
+	call := asm.MustAssemble(fmt.Sprintf(`
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH 0x%x
+		GAS
+		CALL
+		POP
+	`, inner.Bytes()))
+	for _, end := range []string{"STOP", "PUSH1 0\nPUSH1 0\nREVERT", "INVALID"} {
+		bc := example.NewBlockchain()
+		memoryDB := db.NewMemory(bc.NewAccount)
+		for address, code := range map[string][]byte{"bb": call, "dd": store} {
+			account := bc.NewAccount(example.HexToAddress(address))
+			account.SetCode(code)
+			require.NoError(t, memoryDB.UpdateAccount(account))
+		}
+		code := asm.MustAssemble(fmt.Sprintf(`
+			PUSH1 0
+			PUSH1 0
+			PUSH1 0
+			PUSH1 0
+			PUSH1 0
+			PUSH 0x%x
+			GAS
+			CALL
+			POP
+			PUSH1 1
+			PUSH1 1
+			SSTORE
+			%s
+		`, interpreterCallee.Bytes(), end))
+		var gas uint64 = 100000
+		_, err := evm.New(bc, memoryDB, &evm.Context{Gas: &gas}).Call(interpreterCaller, example.HexToAddress("cc"), code)
+		if end == "STOP" {
+			require.NoError(t, err)
+			require.Equal(t, word(1), memoryDB.GetStorage(inner, word(0)))
+			require.Equal(t, word(1), memoryDB.GetStorage(example.HexToAddress("cc"), word(1)))
+		} else {
+			require.Error(t, err, end)
+			require.Nil(t, memoryDB.GetStorage(inner, word(0)), end)
+			require.Nil(t, memoryDB.GetStorage(example.HexToAddress("cc"), word(1)), end)
+		}
+	}
+}
+
+// TestCopyLength checks that a copy which could not be paid fails before the
+// data is padded to length, so a huge length does not allocate memory
+func TestCopyLength(t *testing.T) {
+	for _, op := range []string{"CALLDATACOPY", "CODECOPY", "PUSH 0xbb\nEXTCODECOPY"} {
+		for _, length := range []string{"0xffffffffff", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"} {
+			code := asm.MustAssemble(fmt.Sprintf(`
+				PUSH %s
+				PUSH1 0
+				PUSH1 0
+				%s
+			`, length, op))
+			bc := example.NewBlockchain()
+			var gas uint64 = 100000
+			_, err := evm.New(bc, db.NewMemory(bc.NewAccount), &evm.Context{Gas: &gas}).Call(interpreterCaller, interpreterCallee, code)
+			require.Equal(t, errors.InsufficientGas, err, op)
+		}
+	}
+	// the copy which could be paid succeeds
+	code := asm.MustAssemble(`
+		PUSH2 0x400
+		PUSH1 0
+		PUSH1 0
+		CALLDATACOPY
+	`)
+	bc := example.NewBlockchain()
+	var gas uint64 = 100000
+	_, err := evm.New(bc, db.NewMemory(bc.NewAccount), &evm.Context{Gas: &gas}).Call(interpreterCaller, interpreterCallee, code)
+	require.NoError(t, err)
+}
+
+// TestCopyLengthAllocation checks that an unpayable copy halts before it runs,
+// as the yellow paper checks μ_g < C(σ, μ, A, I) before the operation, where C of
+// a copy includes G_copy * ceil(length / 32). So the data is never padded to a
+// length which could not be paid, and the allocation is bounded by the gas.
+func TestCopyLengthAllocation(t *testing.T) {
+	// 256 MiB costs 25165824 copy gas, which is far more than gas given
+	for _, op := range []string{"CALLDATACOPY", "CODECOPY", "PUSH 0xbb\nEXTCODECOPY"} {
+		code := asm.MustAssemble(fmt.Sprintf(`
+			PUSH4 0x10000000
+			PUSH1 0
+			PUSH1 0
+			%s
+		`, op))
+		bc := example.NewBlockchain()
+		var gas uint64 = 100000
+		vm := evm.New(bc, db.NewMemory(bc.NewAccount), &evm.Context{Gas: &gas})
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := vm.Call(interpreterCaller, interpreterCallee, code)
+		runtime.ReadMemStats(&after)
+		require.Equal(t, errors.InsufficientGas, err, op)
+		require.True(t, after.TotalAlloc-before.TotalAlloc < 1<<20, "%s allocates %d bytes", op, after.TotalAlloc-before.TotalAlloc)
+	}
+}
+
+// TestZeroLengthMemory checks that reading or writing nothing never expands
+// memory, even if the offset does not fit in 64 bits. The yellow paper defines
+// the memory expansion M(s, f, l) = s if l = 0, so the access neither costs
+// memory gas nor fails, whatever the offset is.
+func TestZeroLengthMemory(t *testing.T) {
+	const huge = "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	var cases = []struct {
+		code   string
+		output []byte
+		gas    uint64
+	}{
+		// write nothing at huge offset, and memory is not expanded
+		{fmt.Sprintf("PUSH1 0\nPUSH1 0\nPUSH %s\nCALLDATACOPY\nMSIZE\nPUSH1 0\nMSTORE\nPUSH1 32\nPUSH1 0\nRETURN", huge), word(0), 29},
+		// read nothing at huge offset
+		{fmt.Sprintf("PUSH1 0\nPUSH %s\nRETURN", huge), []byte{}, 6},
+		{fmt.Sprintf("PUSH1 0\nPUSH %s\nSHA3\nPUSH1 0\nMSTORE\nMSIZE\nPUSH1 0\nRETURN", huge), util.Hex2Bytes("c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"), 50},
+	}
+	for _, c := range cases {
+		bc := example.NewBlockchain()
+		var gas uint64 = 100000
+		output, err := evm.New(bc, db.NewMemory(bc.NewAccount), &evm.Context{Gas: &gas}).Call(interpreterCaller, interpreterCallee, asm.MustAssemble(c.code))
+		require.NoError(t, err, c.code)
+		require.Equal(t, c.output, output, c.code)
+		// only the opcodes are charged, and the zero-length access costs no memory gas
+		require.EqualValues(t, c.gas, 100000-gas, c.code)
+	}
+}
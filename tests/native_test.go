@@ -0,0 +1,133 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tests
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/asm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errNativeFailed = fmt.Errorf("native failed")
+
+// failNative writes storage, transfers and logs, then fails if fail is true
+type failNative struct {
+	fail bool
+	to   evm.Address
+}
+
+func (n *failNative) RequiredGas(input []byte) uint64 {
+	return 100
+}
+
+func (n *failNative) Run(ctx *evm.NativeContext) ([]byte, error) {
+	if err := ctx.SetStorage(core.Zero256, core.One256.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := ctx.Transfer(n.to, 10); err != nil {
+		return nil, err
+	}
+	if err := ctx.AddLog(nil, []byte("native")); err != nil {
+		return nil, err
+	}
+	if n.fail {
+		return nil, errNativeFailed
+	}
+	return nil, nil
+}
+
+func TestNativeFailureReverted(t *testing.T) {
+	nativeAddress, to := example.HexToAddress("1000"), example.HexToAddress("dd")
+	// call the native contract, then write the slot 0 of caller whatever the result is
+	code := asm.MustAssemble(fmt.Sprintf(`
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH 0x%x
+		GAS
+		CALL
+		PUSH1 0
+		SSTORE
+	`, nativeAddress.Bytes()))
+	for _, fail := range []bool{false, true} {
+		bc := example.NewBlockchain()
+		memoryDB := db.NewMemory(bc.NewAccount)
+		require.NoError(t, memoryDB.InitBalance(nativeAddress, 100))
+		var gas uint64 = 100000
+		vm := evm.New(bc, memoryDB, &evm.Context{Gas: &gas})
+		require.NoError(t, vm.AddNativeContract(nativeAddress, &failNative{fail: fail, to: to}))
+		_, err := vm.Call(interpreterCaller, interpreterCallee, code)
+		require.NoError(t, err)
+		if fail {
+			// the outer call succeeds, and the changes of native contract are dropped
+			require.Equal(t, core.Zero256.Bytes(), memoryDB.GetStorage(interpreterCallee, core.Zero256.Bytes()))
+			require.Nil(t, memoryDB.GetStorage(nativeAddress, core.Zero256.Bytes()))
+			require.EqualValues(t, 100, memoryDB.GetAccount(nativeAddress).GetBalance())
+			require.EqualValues(t, 0, memoryDB.GetAccount(to).GetBalance())
+			require.Empty(t, memoryDB.GetLog())
+		} else {
+			require.Equal(t, core.One256.Bytes(), memoryDB.GetStorage(interpreterCallee, core.Zero256.Bytes()))
+			require.Equal(t, core.One256.Bytes(), memoryDB.GetStorage(nativeAddress, core.Zero256.Bytes()))
+			require.EqualValues(t, 90, memoryDB.GetAccount(nativeAddress).GetBalance())
+			require.EqualValues(t, 10, memoryDB.GetAccount(to).GetBalance())
+			require.Len(t, memoryDB.GetLog(), 1)
+		}
+	}
+}
+
+func TestNativeFailureKeepEarlierChanges(t *testing.T) {
+	nativeAddress, to := example.HexToAddress("1000"), example.HexToAddress("dd")
+	// write the slot 1 and log before the native contract fails, which should be kept
+	code := asm.MustAssemble(fmt.Sprintf(`
+		PUSH1 1
+		PUSH1 1
+		SSTORE
+		PUSH1 0
+		PUSH1 0
+		LOG0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH 0x%x
+		GAS
+		CALL
+		POP
+	`, nativeAddress.Bytes()))
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	require.NoError(t, memoryDB.InitBalance(nativeAddress, 100))
+	var gas uint64 = 100000
+	vm := evm.New(bc, memoryDB, &evm.Context{Gas: &gas})
+	require.NoError(t, vm.AddNativeContract(nativeAddress, &failNative{fail: true, to: to}))
+	_, err := vm.Call(interpreterCaller, interpreterCallee, code)
+	require.NoError(t, err)
+	require.Equal(t, core.One256.Bytes(), memoryDB.GetStorage(interpreterCallee, core.One256.Bytes()))
+	require.Nil(t, memoryDB.GetStorage(nativeAddress, core.Zero256.Bytes()))
+	require.EqualValues(t, 100, memoryDB.GetAccount(nativeAddress).GetBalance())
+	require.Len(t, memoryDB.GetLog(), 1)
+}
@@ -0,0 +1,358 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tests
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/asm"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/precompile"
+	"github.com/thu-arxan/evm/util"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// echo is a precompile contract which returns the input
+type echo struct{}
+
+func (e *echo) RequiredGas(input []byte) uint64 {
+	return 100
+}
+
+func (e *echo) Run(input []byte) ([]byte, error) {
+	return input, nil
+}
+
+var callOps = []string{"CALL", "CALLCODE", "DELEGATECALL", "STATICCALL"}
+
+func TestPrecompileSetAdd(t *testing.T) {
+	input := util.Hex2Bytes("0000000000000000000000000000000000000000000000000000000000000042")
+	for _, op := range callOps {
+		output, err := callPrecompile(t, op, "0x0100", input, func(set *precompile.Set) {
+			require.NoError(t, set.Add([]byte{1, 0}, &echo{}))
+		})
+		require.NoError(t, err, op)
+		require.Equal(t, input, output, op)
+	}
+	// identity is looked up by the code address rather than the callee in DELEGATECALL and CALLCODE
+	for _, op := range callOps {
+		output, err := callPrecompile(t, op, "0x04", input, nil)
+		require.NoError(t, err, op)
+		require.Equal(t, input, output, op)
+	}
+
+	set := precompile.DefaultSet()
+	require.Error(t, set.Add(example.HexToAddress("04").Bytes(), &echo{}))
+	require.Len(t, set.Addresses(), 9)
+}
+
+func TestPrecompileSetReplaceAndRemove(t *testing.T) {
+	input := []byte("abc")
+	for _, op := range callOps {
+		output, err := callPrecompile(t, op, "0x02", input, func(set *precompile.Set) {
+			set.Replace([]byte{2}, &echo{})
+		})
+		require.NoError(t, err, op)
+		require.Equal(t, util.RightPadBytes(input, 32), output, op)
+	}
+	for _, op := range callOps {
+		output, err := callPrecompile(t, op, "0x04", input, func(set *precompile.Set) {
+			set.Remove([]byte{4})
+		})
+		require.NoError(t, err, op)
+		// 0x04 is an account without code now, so the return data is empty
+		require.Equal(t, make([]byte, 32), output, op)
+	}
+	// the precompile contracts could be replaced by a new set
+	for _, address := range []string{"0100", "04"} {
+		bc := example.NewBlockchain()
+		var gas uint64 = 100000
+		vm := evm.New(bc, db.NewMemory(bc.NewAccount), &evm.Context{
+			Input: input,
+			Gas:   &gas,
+		})
+		vm.SetPrecompiles(precompile.NewSet())
+		vm.Precompiles().Add([]byte{1, 0}, &echo{})
+		output, err := vm.Call(example.RandomAddress(), example.HexToAddress(address), nil)
+		require.NoError(t, err)
+		if address == "0100" {
+			require.Equal(t, input, output)
+			require.EqualValues(t, 99900, gas)
+		} else {
+			require.Empty(t, output)
+		}
+	}
+}
+
+func TestSMPrecompiles(t *testing.T) {
+	addSM := func(set *precompile.Set) {
+		require.NoError(t, precompile.AddSM(set))
+	}
+	// the example of GM/T 0003.5-2012, digest is SM3(ZA || "message digest")
+	digest := util.Hex2Bytes("f0b43e94ba45accaace692ed534382eb17e6ab5a19ce7b31f4486fdfc0d28640")
+	r := util.Hex2Bytes("f5a03b0648d2c4630eeac513e1bb81a15944da3827d5b74143ac7eaceee720b3")
+	s := util.Hex2Bytes("b1b6aa29df212fd8763182bc0d421ca1bb9038fd1f7f42d4840b69c485bbc1aa")
+	x := util.Hex2Bytes("09f9df311e5421a150dd7d161e4bc5c672179fad1833fc076bb08ff356f35020")
+	y := util.Hex2Bytes("ccea490ce26775a52dc6ea718cc1aa600aed05fbf35e084a6632f6072da9ad13")
+	verifyInput := util.BytesCombine(digest, r, s, x, y)
+	for _, op := range callOps {
+		output, err := callPrecompile(t, op, "0x0a01", []byte("abc"), addSM)
+		require.NoError(t, err, op)
+		require.Equal(t, util.Hex2Bytes("66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0"), output, op)
+
+		output, err = callPrecompile(t, op, "0x0a02", verifyInput, addSM)
+		require.NoError(t, err, op)
+		require.Equal(t, util.LeftPadBytes([]byte{1}, 32), output, op)
+
+		// the public key is recovered with either parity, and only x is returned by callPrecompile
+		var recovered bool
+		for _, v := range []byte{27, 28} {
+			output, err = callPrecompile(t, op, "0x0a03", util.BytesCombine(digest, util.LeftPadBytes([]byte{v}, 32), r, s), addSM)
+			require.NoError(t, err, op)
+			recovered = recovered || bytes.Equal(output, x)
+		}
+		require.True(t, recovered, op)
+	}
+	// an invalid signature returns empty, so the return data is zero
+	invalid := util.BytesCombine(digest, s, r, x, y)
+	output, err := callPrecompile(t, "CALL", "0x0a02", invalid, addSM)
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, 32), output)
+	// SM contracts are not in default set
+	output, err = callPrecompile(t, "CALL", "0x0a01", []byte("abc"), nil)
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, 32), output)
+}
+
+func TestP256Verify(t *testing.T) {
+	addP256Verify := func(set *precompile.Set) {
+		require.NoError(t, set.Add(precompile.P256VerifyAddress, precompile.NewP256Verify()))
+	}
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte("webauthn"))
+	r, s, err := ecdsa.Sign(rand.Reader, priv, hash[:])
+	require.NoError(t, err)
+	word := func(value *big.Int) []byte {
+		return util.LeftPadBytes(value.Bytes(), 32)
+	}
+	input := util.BytesCombine(hash[:], word(r), word(s), word(priv.X), word(priv.Y))
+	for _, op := range callOps {
+		output, err := callPrecompile(t, op, "0x0100", input, addP256Verify)
+		require.NoError(t, err, op)
+		require.Equal(t, util.LeftPadBytes([]byte{1}, 32), output, op)
+	}
+
+	contract := precompile.NewP256Verify()
+	require.EqualValues(t, 3450, contract.RequiredGas(input))
+	var invalids = [][]byte{
+		nil,
+		input[:159],
+		append(util.BytesCombine(input), 0),
+		util.BytesCombine([]byte{hash[0] ^ 1}, hash[1:], word(r), word(s), word(priv.X), word(priv.Y)),
+		util.BytesCombine(hash[:], word(s), word(r), word(priv.X), word(priv.Y)),
+		util.BytesCombine(hash[:], make([]byte, 32), word(s), word(priv.X), word(priv.Y)),
+		util.BytesCombine(hash[:], word(r), word(elliptic.P256().Params().N), word(priv.X), word(priv.Y)),
+		util.BytesCombine(hash[:], word(r), word(s), make([]byte, 64)),
+		util.BytesCombine(hash[:], word(r), word(s), word(priv.Y), word(priv.X)),
+	}
+	for i, invalid := range invalids {
+		output, err := contract.Run(invalid)
+		require.NoError(t, err, i)
+		require.Empty(t, output, i)
+	}
+	// P256VERIFY is not in default set
+	output, err := callPrecompile(t, "CALL", "0x0100", input, nil)
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, 32), output)
+}
+
+func TestForkSet(t *testing.T) {
+	var forks = []struct {
+		name      string
+		fork      precompile.Fork
+		addresses int
+	}{
+		{"Homestead", precompile.Frontier, 4},
+		{"Petersburg", precompile.Byzantium, 8},
+		{"Istanbul", precompile.Istanbul, 9},
+		{"London", precompile.Berlin, 9},
+	}
+	for _, f := range forks {
+		fork, err := precompile.ParseFork(f.name)
+		require.NoError(t, err)
+		require.Equal(t, f.fork, fork)
+		require.Len(t, precompile.ForkSet(fork).Addresses(), f.addresses, f.name)
+		require.Equal(t, f.addresses == 9, precompile.IsPrecompile([]byte{9}, fork))
+	}
+	_, err := precompile.ParseFork("Unknown")
+	require.Error(t, err)
+	require.Equal(t, "Berlin", precompile.Berlin.String())
+	require.Equal(t, precompile.ForkSet(precompile.Istanbul).Addresses(), precompile.DefaultSet().Addresses())
+
+	// pairing of two points
+	pairing := make([]byte, 384)
+	var gasTests = []struct {
+		address []byte
+		input   []byte
+		gas     map[precompile.Fork]uint64
+	}{
+		{[]byte{6}, nil, map[precompile.Fork]uint64{precompile.Byzantium: 500, precompile.Istanbul: 150, precompile.Berlin: 150}},
+		{[]byte{7}, nil, map[precompile.Fork]uint64{precompile.Byzantium: 40000, precompile.Istanbul: 6000, precompile.Berlin: 6000}},
+		{[]byte{8}, pairing, map[precompile.Fork]uint64{precompile.Byzantium: 260000, precompile.Istanbul: 113000, precompile.Berlin: 113000}},
+	}
+	for _, test := range gasTests {
+		for fork, gas := range test.gas {
+			contract, err := precompile.New(test.address, fork)
+			require.NoError(t, err)
+			require.Equal(t, gas, contract.RequiredGas(test.input), "%x at %s", test.address, fork)
+		}
+		_, err := precompile.New(test.address, precompile.Frontier)
+		require.Error(t, err)
+	}
+}
+
+func TestModExpGas(t *testing.T) {
+	var tests = []struct {
+		input  string
+		output string
+		eip198 uint64
+		// eip2565 is the gas since Berlin
+		eip2565 uint64
+	}{
+		// the examples of EIP-198, 3^(p-2) mod p and 0^(p-2) mod p
+		{
+			input: "0000000000000000000000000000000000000000000000000000000000000001" +
+				"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000020" +
+				"03" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2e" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			output:  "0000000000000000000000000000000000000000000000000000000000000001",
+			eip198:  13056,
+			eip2565: 1360,
+		},
+		{
+			input: "0000000000000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000020" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2e" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			output:  "0000000000000000000000000000000000000000000000000000000000000000",
+			eip198:  13056,
+			eip2565: 1360,
+		},
+		// 2^3 mod 5, which costs the minimum gas
+		{
+			input: "0000000000000000000000000000000000000000000000000000000000000001" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"020305",
+			output:  "03",
+			eip198:  0,
+			eip2565: 200,
+		},
+		// 2^(2^256) mod 7, the exponent is 64 bytes whose head is 1, and base and modulus are 128 bytes
+		{
+			input: "0000000000000000000000000000000000000000000000000000000000000080" +
+				"0000000000000000000000000000000000000000000000000000000000000040" +
+				"0000000000000000000000000000000000000000000000000000000000000080" +
+				strings.Repeat("00", 127) + "02" +
+				strings.Repeat("00", 31) + "01" + strings.Repeat("00", 32) +
+				strings.Repeat("00", 127) + "07",
+			output: strings.Repeat("00", 127) + "02",
+			// (128^2 / 4 + 96 * 128 - 3072) * (8 * 32) / 20
+			eip198: 170393,
+			// 16^2 * (8 * 32) / 3
+			eip2565: 21845,
+		},
+	}
+	for i, test := range tests {
+		input := util.Hex2Bytes(test.input)
+		for fork, gas := range map[precompile.Fork]uint64{precompile.Byzantium: test.eip198, precompile.Istanbul: test.eip198, precompile.Berlin: test.eip2565} {
+			contract, err := precompile.New([]byte{5}, fork)
+			require.NoError(t, err)
+			require.Equal(t, gas, contract.RequiredGas(input), "%d at %s", i, fork)
+			output, err := contract.Run(input)
+			require.NoError(t, err)
+			require.Equal(t, test.output, util.Hex(output), i)
+		}
+	}
+}
+
+// callPrecompile calls the address by op with input from a contract, and return the first word of return data
+func callPrecompile(t *testing.T, op, address string, input []byte, modify func(set *precompile.Set)) ([]byte, error) {
+	var value string
+	if op == "CALL" || op == "CALLCODE" {
+		value = "PUSH1 0"
+	}
+	code := asm.MustAssemble(fmt.Sprintf(`
+		CALLDATASIZE
+		PUSH1 0
+		PUSH1 0
+		CALLDATACOPY
+		PUSH1 0x20  ; retSize
+		PUSH2 0x100 ; retOffset, which is apart from the input, so the window is zero before the call
+		CALLDATASIZE
+		PUSH1 0    ; inOffset
+		%s
+		PUSH %s
+		GAS
+		%s
+		POP
+		PUSH1 0x20
+		PUSH2 0x100
+		RETURN
+	`, value, address, op))
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	var gas uint64 = 100000
+	vm := evm.New(bc, memoryDB, &evm.Context{
+		Input: input,
+		Gas:   &gas,
+	})
+	if modify != nil {
+		modify(vm.Precompiles())
+	}
+	return vm.Call(example.RandomAddress(), example.HexToAddress("00000000000000000000000000000000000000aa"), code)
+}
+
+func TestForkSetModExpGas(t *testing.T) {
+	// 3^(p-2) mod p of EIP-198, which costs 13056 before Berlin and 1360 since Berlin by EIP-2565
+	input := util.Hex2Bytes("0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"03" +
+		"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2e" +
+		"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+	for fork, gas := range map[precompile.Fork]uint64{precompile.Istanbul: 13056, precompile.Berlin: 1360} {
+		contract, ok := precompile.ForkSet(fork).Get([]byte{5})
+		require.True(t, ok)
+		require.EqualValues(t, gas, contract.RequiredGas(input), fork.String())
+	}
+}
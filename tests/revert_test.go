@@ -0,0 +1,139 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tests
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/asm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestFailedCallReverted checks that the changes of a failed inner call are
+// dropped even if the outer call succeeds
+func TestFailedCallReverted(t *testing.T) {
+	// the callee writes slot 0 and logs, then fails, and INVALID consumes all
+	// the gas given, so the gas of call is limited
+	for _, end := range []string{"PUSH1 0\nPUSH1 0\nREVERT", "INVALID"} {
+		failure := asm.MustAssemble(fmt.Sprintf(`
+			PUSH1 1
+			PUSH1 0
+			SSTORE
+			PUSH1 0
+			PUSH1 0
+			LOG0
+			%s
+		`, end))
+		for _, op := range callOps {
+			var value string
+			if op == "CALL" || op == "CALLCODE" {
+				value = "PUSH1 0"
+			}
+			code := asm.MustAssemble(fmt.Sprintf(`
+				PUSH1 0
+				PUSH1 0
+				PUSH1 0
+				PUSH1 0
+				%s
+				PUSH 0x%x
+				PUSH2 0x8000
+				%s
+				PUSH1 1
+				SSTORE
+			`, value, interpreterCallee.Bytes(), op))
+			bc := example.NewBlockchain()
+			memoryDB := db.NewMemory(bc.NewAccount)
+			callee := bc.NewAccount(interpreterCallee)
+			callee.SetCode(failure)
+			require.NoError(t, memoryDB.UpdateAccount(callee))
+			var gas uint64 = 100000
+			_, err := evm.New(bc, memoryDB, &evm.Context{Gas: &gas}).Call(interpreterCaller, example.HexToAddress("cc"), code)
+			require.NoError(t, err, op)
+			// the result of call is 0
+			require.Equal(t, word(0), memoryDB.GetStorage(example.HexToAddress("cc"), word(1)), op)
+			// a storage read before the failure may be synced as zero
+			require.Equal(t, core.Zero256, core.BytesToWord256(memoryDB.GetStorage(interpreterCallee, word(0))), op)
+			require.Equal(t, core.Zero256, core.BytesToWord256(memoryDB.GetStorage(example.HexToAddress("cc"), word(0))), op)
+			require.Empty(t, memoryDB.GetLog(), op)
+		}
+	}
+}
+
+// TestFailedCreateReverted checks that the account of a failed CREATE is not
+// created, while the nonce of creator is still increased
+func TestFailedCreateReverted(t *testing.T) {
+	// the init code writes slot 0 and reverts: PUSH1 1 PUSH1 0 SSTORE PUSH1 0 PUSH1 0 REVERT
+	code := asm.MustAssemble(`
+		PUSH10 0x600160005560006000fd
+		PUSH1 0
+		MSTORE
+		PUSH1 10
+		PUSH1 22
+		PUSH1 0
+		CREATE
+		PUSH1 1
+		SSTORE
+	`)
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	creator := example.HexToAddress("cc")
+	var gas uint64 = 100000
+	_, err := evm.New(bc, memoryDB, &evm.Context{Gas: &gas}).Call(interpreterCaller, creator, code)
+	require.NoError(t, err)
+	require.Equal(t, word(0), memoryDB.GetStorage(creator, word(1)))
+	require.EqualValues(t, 1, memoryDB.GetAccount(creator).GetNonce())
+	// only the creator exists, and the storage written by init code is dropped
+	accounts := memoryDB.Accounts()
+	require.Len(t, accounts, 1)
+	require.Equal(t, creator.Bytes(), accounts[0].GetAddress().Bytes())
+}
+
+// TestFailedCallValueReverted checks that the value sent by a failed CALL is
+// given back to the caller
+func TestFailedCallValueReverted(t *testing.T) {
+	code := asm.MustAssemble(fmt.Sprintf(`
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 10
+		PUSH 0x%x
+		PUSH2 0x8000
+		CALL
+		PUSH1 1
+		SSTORE
+	`, interpreterCallee.Bytes()))
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	caller := example.HexToAddress("cc")
+	require.NoError(t, memoryDB.InitBalance(caller, 100))
+	callee := bc.NewAccount(interpreterCallee)
+	callee.SetCode(asm.MustAssemble("PUSH1 0\nPUSH1 0\nREVERT"))
+	require.NoError(t, memoryDB.UpdateAccount(callee))
+	var gas uint64 = 100000
+	_, err := evm.New(bc, memoryDB, &evm.Context{Gas: &gas}).Call(interpreterCaller, caller, code)
+	require.NoError(t, err)
+	require.Equal(t, word(0), memoryDB.GetStorage(caller, word(1)))
+	require.EqualValues(t, 100, memoryDB.GetAccount(caller).GetBalance())
+	require.EqualValues(t, 0, memoryDB.GetAccount(interpreterCallee).GetBalance())
+}
@@ -0,0 +1,277 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tests
+
+import (
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/asm"
+	"github.com/thu-arxan/evm/core"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/errors"
+	"github.com/thu-arxan/evm/example"
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errCommit = fmt.Errorf("commit failed")
+	errRead   = fmt.Errorf("read failed")
+)
+
+// failDB is a memory db whose write batch always fails to commit
+type failDB struct {
+	*db.Memory
+}
+
+func (f *failDB) NewWriteBatch() evm.WriteBatch {
+	return &failBatch{f.Memory.NewWriteBatch()}
+}
+
+type failBatch struct {
+	evm.WriteBatch
+}
+
+func (b *failBatch) Commit() error {
+	b.Discard()
+	return errCommit
+}
+
+func TestSyncFailed(t *testing.T) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	caller, callee := example.HexToAddress("aa"), example.HexToAddress("bb")
+	require.NoError(t, memoryDB.InitBalance(caller, 100))
+	code := asm.MustAssemble(`
+		PUSH1 1
+		PUSH1 0
+		SSTORE
+		PUSH1 0
+		PUSH1 0
+		LOG0
+	`)
+	var gas uint64 = 100000
+	vm := evm.New(bc, &failDB{memoryDB}, &evm.Context{Gas: &gas, Value: 10})
+	_, err := vm.Call(caller, callee, code)
+	require.Equal(t, errCommit, err)
+	// nothing is applied
+	require.EqualValues(t, 100, memoryDB.GetAccount(caller).GetBalance())
+	require.Nil(t, memoryDB.GetStorage(callee, core.Zero256.Bytes()))
+	require.Empty(t, memoryDB.GetLog())
+
+	gas = 100000
+	vm = evm.New(bc, &failDB{memoryDB}, &evm.Context{Gas: &gas, Input: code})
+	_, _, err = vm.Create(caller)
+	require.Equal(t, errCommit, err)
+	require.EqualValues(t, 0, memoryDB.GetAccount(caller).GetNonce())
+}
+
+// brokenDB is a memory db whose reads of storage of the broken account fail
+type brokenDB struct {
+	*db.Memory
+	broken evm.Address
+}
+
+func (b *brokenDB) TryExist(address evm.Address) (bool, error) {
+	return b.Exist(address), nil
+}
+
+func (b *brokenDB) TryGetAccount(address evm.Address) (evm.Account, error) {
+	return b.GetAccount(address), nil
+}
+
+func (b *brokenDB) TryGetStorage(address evm.Address, key []byte) ([]byte, error) {
+	if b.broken != nil && bytes.Equal(address.Bytes(), b.broken.Bytes()) {
+		return nil, errRead
+	}
+	return b.GetStorage(address, key), nil
+}
+
+func TestDBFailure(t *testing.T) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	caller, callee, inner := example.HexToAddress("aa"), example.HexToAddress("bb"), example.HexToAddress("cc")
+	require.NoError(t, memoryDB.InitBalance(caller, 100))
+	// inner loads slot 0, and the failure should abort the whole execution rather than fail the inner call
+	account := memoryDB.GetAccount(inner)
+	account.SetCode(asm.MustAssemble(`
+		PUSH1 0
+		SLOAD
+		POP
+	`))
+	require.NoError(t, memoryDB.UpdateAccount(account))
+	code := asm.MustAssemble(`
+		PUSH1 1
+		PUSH1 0
+		SSTORE
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0xcc
+		GAS
+		CALL
+		POP
+	`)
+	var backend = &brokenDB{Memory: memoryDB, broken: inner}
+	var gas uint64 = 100000
+	vm := evm.New(bc, backend, &evm.Context{Gas: &gas, Value: 10})
+	_, err := vm.Call(caller, callee, code)
+	dbErr, ok := err.(*errors.DBError)
+	require.True(t, ok, err)
+	require.Equal(t, errRead, dbErr.Err)
+	// nothing is applied
+	require.EqualValues(t, 100, memoryDB.GetAccount(caller).GetBalance())
+	require.Nil(t, memoryDB.GetStorage(callee, core.Zero256.Bytes()))
+
+	// the same transaction succeeds once the db is recovered
+	backend.broken = nil
+	gas = 100000
+	vm = evm.New(bc, backend, &evm.Context{Gas: &gas, Value: 10})
+	_, err = vm.Call(caller, callee, code)
+	require.NoError(t, err)
+	require.EqualValues(t, 90, memoryDB.GetAccount(caller).GetBalance())
+	require.Equal(t, core.Uint64ToWord256(1).Bytes(), memoryDB.GetStorage(callee, core.Zero256.Bytes()))
+}
+
+// accountFailDB is a memory db whose reads of account fail
+type accountFailDB struct {
+	brokenDB
+}
+
+func (b *accountFailDB) TryGetAccount(address evm.Address) (evm.Account, error) {
+	return nil, errRead
+}
+
+func TestFallibleCacheNilAccountFunc(t *testing.T) {
+	bc := example.NewBlockchain()
+	address := example.HexToAddress("aa")
+	// the cache gives an empty account rather than panics if no accountFunc is given
+	cache := evm.NewFallibleCache(&accountFailDB{brokenDB{Memory: db.NewMemory(bc.NewAccount)}}, nil)
+	account := cache.GetAccount(address)
+	require.Equal(t, address.Bytes(), account.GetAddress().Bytes())
+	require.EqualValues(t, 0, account.GetBalance())
+	require.False(t, cache.HasSuicide(address))
+	dbErr, ok := cache.Error().(*errors.DBError)
+	require.True(t, ok, cache.Error())
+	require.Equal(t, errRead, dbErr.Err)
+	require.Equal(t, cache.Error(), cache.Sync())
+}
+
+func TestSyncDeleteAccount(t *testing.T) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	caller, contract := example.HexToAddress("aa"), example.HexToAddress("cc")
+	beneficiary, empty, untouched := example.HexToAddress("bb"), example.HexToAddress("dd"), example.HexToAddress("ee")
+	// contract calls the empty account with zero value and then selfdestructs
+	account := memoryDB.GetAccount(contract)
+	account.AddBalance(50)
+	account.SetNonce(1)
+	account.SetCode(asm.MustAssemble(`
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0xdd
+		GAS
+		CALL
+		POP
+		PUSH1 0xbb
+		SELFDESTRUCT
+	`))
+	require.NoError(t, memoryDB.UpdateAccount(account))
+	memoryDB.SetStorage(contract, core.Zero256.Bytes(), core.Uint64ToWord256(1).Bytes())
+	require.NoError(t, memoryDB.UpdateAccount(bc.NewAccount(empty)))
+	require.NoError(t, memoryDB.UpdateAccount(bc.NewAccount(untouched)))
+
+	var gas uint64 = 100000
+	vm := evm.New(bc, memoryDB, &evm.Context{Gas: &gas})
+	vm.SetEIP161(true)
+	_, err := vm.Call(caller, contract, account.GetCode())
+	require.NoError(t, err)
+	// the suicided account is deleted with its storage
+	require.False(t, memoryDB.Exist(contract))
+	require.Nil(t, memoryDB.GetStorage(contract, core.Zero256.Bytes()))
+	require.EqualValues(t, 50, memoryDB.GetAccount(beneficiary).GetBalance())
+	// the touched empty account is deleted, and the untouched one is kept
+	require.False(t, memoryDB.Exist(empty))
+	require.True(t, memoryDB.Exist(untouched))
+}
+
+// TestSyncKeepEmptyAccountWithStorage checks the difference from EIP-161 that
+// a touched empty account is kept if its storage is written, because the code
+// is given by Call rather than stored in the account
+func TestSyncKeepEmptyAccountWithStorage(t *testing.T) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	caller, contract := example.HexToAddress("aa"), example.HexToAddress("cc")
+	for _, value := range []uint64{1, 0} {
+		var gas uint64 = 100000
+		vm := evm.New(bc, memoryDB, &evm.Context{Gas: &gas})
+		vm.SetEIP161(true)
+		_, err := vm.Call(caller, contract, asm.MustAssemble(fmt.Sprintf(`
+			PUSH1 %d
+			PUSH1 0
+			SSTORE
+		`, value)))
+		require.NoError(t, err)
+		require.True(t, memoryDB.Exist(contract), value)
+		require.True(t, memoryDB.GetAccount(contract).GetBalance() == 0 && memoryDB.GetAccount(contract).GetNonce() == 0)
+	}
+	require.Equal(t, core.Zero256.Bytes(), memoryDB.GetStorage(contract, core.Zero256.Bytes()))
+
+	// the account is deleted once it is touched without writing storage
+	var gas uint64 = 100000
+	vm := evm.New(bc, memoryDB, &evm.Context{Gas: &gas})
+	vm.SetEIP161(true)
+	_, err := vm.Call(caller, contract, nil)
+	require.NoError(t, err)
+	require.False(t, memoryDB.Exist(contract))
+	require.Nil(t, memoryDB.GetStorage(contract, core.Zero256.Bytes()))
+}
+
+// TestSyncKeepEmptyAccountByDefault checks that the touched empty accounts are
+// kept unless EIP-161 is enabled, so the code given by Call could run on an
+// existing empty account without deleting it
+func TestSyncKeepEmptyAccountByDefault(t *testing.T) {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	caller, contract, empty := example.HexToAddress("aa"), example.HexToAddress("cc"), example.HexToAddress("dd")
+	require.NoError(t, memoryDB.UpdateAccount(bc.NewAccount(contract)))
+	require.NoError(t, memoryDB.UpdateAccount(bc.NewAccount(empty)))
+	// the code runs on the empty contract and calls another empty account
+	code := asm.MustAssemble(`
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0
+		PUSH1 0xdd
+		GAS
+		CALL
+	`)
+	var gas uint64 = 100000
+	_, err := evm.New(bc, memoryDB, &evm.Context{Gas: &gas}).Call(caller, contract, code)
+	require.NoError(t, err)
+	require.True(t, memoryDB.Exist(contract))
+	require.True(t, memoryDB.Exist(empty))
+}
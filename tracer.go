@@ -0,0 +1,106 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evm
+
+// Tracer is notified by the interpreter while it runs code, so the execution
+// can be logged, profiled or checked without changing the interpreter.
+// Note: Tracer is called in the interpreter loop, so it should be cheap.
+type Tracer interface {
+	// CaptureEnter is called before the code of a frame starts to run
+	CaptureEnter(frame *Frame)
+	// CaptureState is called before an opcode is executed
+	CaptureState(step *Step)
+	// CaptureStateEnd is called after an opcode is executed, and the gas it
+	// used is filled into step
+	CaptureStateEnd(step *Step)
+	// CaptureExit is called once the code of a frame returns
+	CaptureExit(frame *Frame, output []byte, gasUsed uint64, err error)
+}
+
+// Frame describes a call frame which runs code
+type Frame struct {
+	Caller Address
+	// Callee is the account whose storage is used, which differs from the
+	// owner of code in DELEGATECALL and CALLCODE
+	Callee Address
+	Code   []byte
+	Input  []byte
+	Value  uint64
+	// Gas is the gas available when the frame starts
+	Gas uint64
+	// Depth starts from 1
+	Depth int
+	// Create is true if the frame runs init code of a contract
+	Create bool
+}
+
+// Step describes the execution of one opcode
+type Step struct {
+	Frame *Frame
+	PC    uint64
+	Op    OpCode
+	// Gas is the gas left before the opcode is executed
+	Gas uint64
+	// Cost is the gas used by the opcode, including the gas used by the frames
+	// it calls, it is only valid in CaptureStateEnd
+	Cost uint64
+	// MemoryCost is the part of Cost paid for memory expansion
+	MemoryCost uint64
+	Refund     uint64
+	// Stack and Memory could be read but should not be modified by tracers,
+	// they are in the state before the opcode is executed in CaptureState,
+	// and after the opcode is executed in CaptureStateEnd
+	Stack  *Stack
+	Memory Memory
+	// Err is the error the opcode runs into, it is only valid in CaptureStateEnd
+	Err error
+
+	memoryLen uint64
+}
+
+// SetTracer set the tracer of evm, and nil means no tracer
+func (evm *EVM) SetTracer(tracer Tracer) {
+	evm.tracer = tracer
+}
+
+func (evm *EVM) captureState(frame *Frame, pc uint64, op OpCode, gas uint64, stack *Stack, memory Memory) *Step {
+	step := &Step{
+		Frame:     frame,
+		PC:        pc,
+		Op:        op,
+		Gas:       gas,
+		Refund:    evm.refund,
+		Stack:     stack,
+		Memory:    memory,
+		memoryLen: memory.Len(),
+	}
+	evm.tracer.CaptureState(step)
+	return step
+}
+
+func (evm *EVM) captureStateEnd(step *Step, gasLeft uint64, err error) {
+	if step.Gas > gasLeft {
+		step.Cost = step.Gas - gasLeft
+	}
+	if newLen := step.Memory.Len(); newLen > step.memoryLen {
+		step.MemoryCost = memoryFee(newLen) - memoryFee(step.memoryLen)
+	}
+	step.Refund = evm.refund
+	step.Err = err
+	evm.tracer.CaptureStateEnd(step)
+}
@@ -0,0 +1,173 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/thu-arxan/evm"
+)
+
+// ReadStructLogs read a reference trace, which could be the output of geth json
+// logger(one log per line), the result of debug_traceTransaction with or without
+// the json rpc envelope, or a json array of logs.
+// Note: The lines without op, such as the summary of geth evm, are skipped.
+func ReadStructLogs(r io.Reader) ([]*StructLog, error) {
+	var logs []*StructLog
+	decoder := json.NewDecoder(r)
+	for {
+		var data json.RawMessage
+		if err := decoder.Decode(&data); err == io.EOF {
+			return logs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		var err error
+		if logs, err = appendStructLogs(logs, data); err != nil {
+			return nil, fmt.Errorf("step %d: %v", len(logs), err)
+		}
+	}
+}
+
+func appendStructLogs(logs []*StructLog, data json.RawMessage) ([]*StructLog, error) {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		var list []*StructLog
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		return append(logs, list...), nil
+	}
+	var probe struct {
+		Result     json.RawMessage `json:"result"`
+		StructLogs []*StructLog    `json:"structLogs"`
+		Op         json.RawMessage `json:"op"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	switch {
+	case probe.Result != nil:
+		return appendStructLogs(logs, probe.Result)
+	case probe.StructLogs != nil:
+		return append(logs, probe.StructLogs...), nil
+	case probe.Op != nil:
+		var log = new(StructLog)
+		if err := json.Unmarshal(data, log); err != nil {
+			return nil, err
+		}
+		return append(logs, log), nil
+	}
+	return logs, nil
+}
+
+// Divergence is the first step where a trace differs from the reference trace
+type Divergence struct {
+	// Index is the index of the step in both traces
+	Index int
+	// Field is the first field which differs, which is one of pc, op, gas, gasCost,
+	// depth, stack, memory and length if one trace ends earlier
+	Field string
+	// Got is the step of trace and Want is the step of reference, and one of them
+	// is nil if the trace ends earlier than the other one
+	Got  *StructLog
+	Want *StructLog
+}
+
+func (d *Divergence) String() string {
+	return fmt.Sprintf("step %d differs in %s\n  got:  %s\n  want: %s", d.Index, d.Field, formatStep(d.Got), formatStep(d.Want))
+}
+
+// Diff compares a trace with the reference trace step by step, and return the
+// first divergence, or nil if they are the same.
+// Note: The gasCost of CALL and CREATE family is not compared because geth counts
+// the gas passed to callee rather than the gas used by it. The stack and memory
+// are compared only if both traces record them.
+func Diff(got, want []*StructLog) *Divergence {
+	for i := 0; i < len(got) || i < len(want); i++ {
+		if i >= len(got) || i >= len(want) {
+			var d = &Divergence{Index: i, Field: "length"}
+			if i < len(got) {
+				d.Got = got[i]
+			} else {
+				d.Want = want[i]
+			}
+			return d
+		}
+		if field := diffStep(got[i], want[i]); field != "" {
+			return &Divergence{Index: i, Field: field, Got: got[i], Want: want[i]}
+		}
+	}
+	return nil
+}
+
+// diffStep return the first field which differs, or empty string if they are the same
+func diffStep(got, want *StructLog) string {
+	switch {
+	case got.PC != want.PC:
+		return "pc"
+	case got.Op != want.Op:
+		return "op"
+	case got.Gas != want.Gas:
+		return "gas"
+	case got.GasCost != want.GasCost && !isCallOrCreate(got.Op):
+		return "gasCost"
+	case got.Depth != want.Depth:
+		return "depth"
+	}
+	if got.Stack != nil && want.Stack != nil {
+		if len(got.Stack) != len(want.Stack) {
+			return "stack"
+		}
+		for i := range got.Stack {
+			if got.Stack[i].Cmp(want.Stack[i]) != 0 {
+				return "stack"
+			}
+		}
+	}
+	if got.Memory != nil && want.Memory != nil && !bytes.Equal(got.Memory, want.Memory) {
+		return "memory"
+	}
+	return ""
+}
+
+func isCallOrCreate(op evm.OpCode) bool {
+	switch op {
+	case evm.CALL, evm.CALLCODE, evm.DELEGATECALL, evm.STATICCALL, evm.CREATE, evm.CREATE2:
+		return true
+	}
+	return false
+}
+
+func formatStep(log *StructLog) string {
+	if log == nil {
+		return "<end of trace>"
+	}
+	var stack = make([]string, len(log.Stack))
+	for i, value := range log.Stack {
+		stack[i] = fmt.Sprintf("0x%x", value)
+	}
+	var s = fmt.Sprintf("pc=%d op=%v gas=%d gasCost=%d depth=%d stack=[%s]", log.PC, log.Op, log.Gas, log.GasCost, log.Depth, strings.Join(stack, " "))
+	if log.Err != nil {
+		s += " error=" + log.Err.Error()
+	}
+	return s
+}
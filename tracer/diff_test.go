@@ -0,0 +1,84 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tracer
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStructLogs(t *testing.T) {
+	for _, file := range []string{"testdata/debug_trace.json", "testdata/json_logger.jsonl"} {
+		logs := readStructLogs(t, file)
+		require.Len(t, logs, 6, file)
+		require.Equal(t, evm.MSTORE, logs[2].Op, file)
+		require.EqualValues(t, 999994, logs[2].Gas, file)
+		require.EqualValues(t, 6, logs[2].GasCost, file)
+		require.Len(t, logs[2].Stack, 2, file)
+		require.EqualValues(t, 1, logs[2].Stack[0].Int64(), file)
+		require.EqualValues(t, 32, logs[3].MemSize, file)
+		require.Len(t, logs[3].Memory, 32, file)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	// PUSH1 1 PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	code := util.Hex2Bytes("600160005260206000f3")
+	logger := NewStructLogger(&StructLoggerConfig{EnableMemory: true})
+	run(t, logger, code, nil)
+	got := logger.Logs()
+	for _, file := range []string{"testdata/debug_trace.json", "testdata/json_logger.jsonl"} {
+		require.Nil(t, Diff(got, readStructLogs(t, file)), file)
+	}
+
+	want := readStructLogs(t, "testdata/debug_trace.json")
+	want[3].Gas++
+	d := Diff(got, want)
+	require.NotNil(t, d)
+	require.Equal(t, 3, d.Index)
+	require.Equal(t, "gas", d.Field)
+	require.True(t, strings.HasPrefix(d.String(), "step 3 differs in gas\n  got:  pc=5 op=PUSH1 gas=999988"), d.String())
+
+	want = readStructLogs(t, "testdata/debug_trace.json")
+	want[5].Stack[1].SetInt64(1)
+	d = Diff(got, want)
+	require.NotNil(t, d)
+	require.Equal(t, "stack", d.Field)
+
+	d = Diff(got, want[:4])
+	require.NotNil(t, d)
+	require.Equal(t, 4, d.Index)
+	require.Equal(t, "length", d.Field)
+	require.Nil(t, d.Want)
+	require.Contains(t, d.String(), "want: <end of trace>")
+}
+
+func readStructLogs(t *testing.T, file string) []*StructLog {
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+	logs, err := ReadStructLogs(f)
+	require.NoError(t, err)
+	return logs
+}
@@ -0,0 +1,311 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tracer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/crypto"
+)
+
+// Stat is the statistic of gas usage
+// Note: Gas = Base + Memory + Dynamic, and the gas used by callee frames is not included.
+type Stat struct {
+	// Count is the executed count of an opcode, or the entered count of a frame
+	Count uint64
+	Gas   uint64
+	// Base is the constant gas charged before executing an opcode
+	Base uint64
+	// Memory is the gas charged for memory expansion
+	Memory uint64
+	// Dynamic is the gas depends on operands and state, such as SSTORE and SHA3 words
+	Dynamic uint64
+}
+
+func (s *Stat) add(base, memory, dynamic uint64) {
+	s.Count++
+	s.Gas += base + memory + dynamic
+	s.Base += base
+	s.Memory += memory
+	s.Dynamic += dynamic
+}
+
+// PCStat is the statistic of an opcode at a pc of code
+type PCStat struct {
+	Stat
+	// CodeHash is the keccak256 of code
+	CodeHash []byte
+	PC       uint64
+	Op       evm.OpCode
+}
+
+type pcKey struct {
+	codeHash string
+	pc       uint64
+}
+
+type profileFrame struct {
+	name     string
+	codeHash string
+	stack    string
+	// childGas is the gas used by the callee frames of the running opcode
+	childGas uint64
+}
+
+// Profiler is a tracer which aggregates executed count and gas usage per opcode,
+// per pc and per call frame, the frame is named by contract address and function selector.
+// Note: Profiler is not thread safety.
+type Profiler struct {
+	ops    map[evm.OpCode]*Stat
+	pcs    map[pcKey]*PCStat
+	frames map[string]*Stat
+	folded map[string]uint64
+	stack  []*profileFrame
+}
+
+// NewProfiler is the constructor of Profiler
+func NewProfiler() *Profiler {
+	return &Profiler{
+		ops:    make(map[evm.OpCode]*Stat),
+		pcs:    make(map[pcKey]*PCStat),
+		frames: make(map[string]*Stat),
+		folded: make(map[string]uint64),
+	}
+}
+
+// CaptureEnter is the implementation of evm.Tracer
+func (p *Profiler) CaptureEnter(frame *evm.Frame) {
+	f := &profileFrame{
+		name:     FrameName(frame),
+		codeHash: string(crypto.Keccak256(frame.Code)),
+	}
+	if len(p.stack) == 0 {
+		f.stack = f.name
+	} else {
+		f.stack = p.stack[len(p.stack)-1].stack + ";" + f.name
+	}
+	p.stack = append(p.stack, f)
+	p.frameStat(f.name).Count++
+}
+
+// CaptureState is the implementation of evm.Tracer
+func (p *Profiler) CaptureState(step *evm.Step) {}
+
+// CaptureStateEnd is the implementation of evm.Tracer
+func (p *Profiler) CaptureStateEnd(step *evm.Step) {
+	if len(p.stack) == 0 {
+		return
+	}
+	f := p.stack[len(p.stack)-1]
+	self := subOrZero(step.Cost, f.childGas)
+	f.childGas = 0
+	memory := minUint64(step.MemoryCost, self)
+	base := minUint64(evm.ConstantGas(step.Op), self-memory)
+	dynamic := self - memory - base
+
+	p.opStat(step.Op).add(base, memory, dynamic)
+	p.pcStat(f.codeHash, step.PC, step.Op).add(base, memory, dynamic)
+	frameStat := p.frameStat(f.name)
+	frameStat.Gas += self
+	frameStat.Base += base
+	frameStat.Memory += memory
+	frameStat.Dynamic += dynamic
+	p.folded[f.stack+";"+step.Op.String()] += self
+}
+
+// CaptureExit is the implementation of evm.Tracer
+func (p *Profiler) CaptureExit(frame *evm.Frame, output []byte, gasUsed uint64, err error) {
+	if len(p.stack) == 0 {
+		return
+	}
+	p.stack = p.stack[:len(p.stack)-1]
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].childGas += gasUsed
+	}
+}
+
+// OpStats return the statistic of every executed opcode
+func (p *Profiler) OpStats() map[evm.OpCode]*Stat {
+	return p.ops
+}
+
+// FrameStats return the statistic of every frame, which is keyed by FrameName
+func (p *Profiler) FrameStats() map[string]*Stat {
+	return p.frames
+}
+
+// PCStats return the statistic of every executed pc, which is sorted by gas in descending order
+func (p *Profiler) PCStats() []*PCStat {
+	var stats = make([]*PCStat, 0, len(p.pcs))
+	for _, stat := range p.pcs {
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Gas != stats[j].Gas {
+			return stats[i].Gas > stats[j].Gas
+		}
+		if string(stats[i].CodeHash) != string(stats[j].CodeHash) {
+			return string(stats[i].CodeHash) < string(stats[j].CodeHash)
+		}
+		return stats[i].PC < stats[j].PC
+	})
+	return stats
+}
+
+// TotalGas return the gas used by all traced opcodes
+func (p *Profiler) TotalGas() uint64 {
+	var total uint64
+	for _, stat := range p.ops {
+		total += stat.Gas
+	}
+	return total
+}
+
+// WriteReport write a text report, which contains the statistic of opcodes,
+// frames and the top pcs(limited by topPCs, and 0 means all pcs)
+func (p *Profiler) WriteReport(w io.Writer, topPCs int) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "total gas: %d\n\n", p.TotalGas())
+
+	fmt.Fprintln(tw, "OPCODE\tCOUNT\tGAS\tBASE\tMEMORY\tDYNAMIC\t")
+	var ops = make([]evm.OpCode, 0, len(p.ops))
+	for op := range p.ops {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if p.ops[ops[i]].Gas != p.ops[ops[j]].Gas {
+			return p.ops[ops[i]].Gas > p.ops[ops[j]].Gas
+		}
+		return ops[i] < ops[j]
+	})
+	for _, op := range ops {
+		writeStat(tw, op.String(), p.ops[op])
+	}
+
+	fmt.Fprintln(tw, "\nFRAME\tCOUNT\tGAS\tBASE\tMEMORY\tDYNAMIC\t")
+	var names = make([]string, 0, len(p.frames))
+	for name := range p.frames {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if p.frames[names[i]].Gas != p.frames[names[j]].Gas {
+			return p.frames[names[i]].Gas > p.frames[names[j]].Gas
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		writeStat(tw, name, p.frames[name])
+	}
+
+	fmt.Fprintln(tw, "\nCODE:PC\tCOUNT\tGAS\tBASE\tMEMORY\tDYNAMIC\t")
+	pcs := p.PCStats()
+	if topPCs > 0 && len(pcs) > topPCs {
+		pcs = pcs[:topPCs]
+	}
+	for _, stat := range pcs {
+		writeStat(tw, fmt.Sprintf("%x:%d %s", stat.CodeHash[:4], stat.PC, stat.Op), &stat.Stat)
+	}
+	return tw.Flush()
+}
+
+// WriteFolded write the gas usage in the folded stack format of Brendan Gregg,
+// which could be used to generate flamegraph by flamegraph.pl.
+// Every line is "frame;frame;...;OPCODE gas" and is sorted by stack.
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	var stacks = make([]string, 0, len(p.folded))
+	for stack, gas := range p.folded {
+		if gas != 0 {
+			stacks = append(stacks, stack)
+		}
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, p.folded[stack]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FrameName return the name of a frame, which is address:selector,
+// address:constructor if the frame creates a contract or address:fallback if no selector.
+func FrameName(frame *evm.Frame) string {
+	var address = fmt.Sprintf("%x", frame.Callee.Bytes())
+	switch {
+	case frame.Create:
+		return address + ":constructor"
+	case len(frame.Input) < 4:
+		return address + ":fallback"
+	default:
+		return fmt.Sprintf("%s:%x", address, frame.Input[:4])
+	}
+}
+
+func (p *Profiler) opStat(op evm.OpCode) *Stat {
+	stat, ok := p.ops[op]
+	if !ok {
+		stat = &Stat{}
+		p.ops[op] = stat
+	}
+	return stat
+}
+
+func (p *Profiler) pcStat(codeHash string, pc uint64, op evm.OpCode) *Stat {
+	key := pcKey{codeHash: codeHash, pc: pc}
+	stat, ok := p.pcs[key]
+	if !ok {
+		stat = &PCStat{
+			CodeHash: []byte(codeHash),
+			PC:       pc,
+			Op:       op,
+		}
+		p.pcs[key] = stat
+	}
+	return &stat.Stat
+}
+
+func (p *Profiler) frameStat(name string) *Stat {
+	stat, ok := p.frames[name]
+	if !ok {
+		stat = &Stat{}
+		p.frames[name] = stat
+	}
+	return stat
+}
+
+func writeStat(w io.Writer, name string, stat *Stat) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t\n", name, stat.Count, stat.Gas, stat.Base, stat.Memory, stat.Dynamic)
+}
+
+func subOrZero(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return 0
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
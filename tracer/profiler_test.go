@@ -0,0 +1,94 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tracer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/db"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilerMemoryGas(t *testing.T) {
+	// PUSH1 1 PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	code := util.Hex2Bytes("600160005260206000f3")
+	profiler := NewProfiler()
+	gasUsed := run(t, profiler, code, nil)
+	require.EqualValues(t, 18, gasUsed)
+	require.EqualValues(t, gasUsed, profiler.TotalGas())
+
+	mstore := profiler.OpStats()[evm.MSTORE]
+	require.EqualValues(t, 1, mstore.Count)
+	require.EqualValues(t, 3, mstore.Base)
+	require.EqualValues(t, 3, mstore.Memory)
+	require.EqualValues(t, 0, mstore.Dynamic)
+	push := profiler.OpStats()[evm.PUSH1]
+	require.EqualValues(t, 4, push.Count)
+	require.EqualValues(t, 12, push.Gas)
+}
+
+func TestProfilerCallFrames(t *testing.T) {
+	// PUSH1 1 PUSH1 0 SSTORE STOP
+	calleeCode := util.Hex2Bytes("6001600055" + "00")
+	callee := example.HexToAddress("00000000000000000000000000000000000000bb")
+	// PUSH1 0 PUSH1 0 PUSH1 0 PUSH1 0 PUSH1 0 PUSH20 callee PUSH2 0xffff CALL STOP
+	code := util.Hex2Bytes("6000600060006000600073" + "00000000000000000000000000000000000000bb" + "61ffff" + "f1" + "00")
+	profiler := NewProfiler()
+	gasUsed := run(t, profiler, code, map[*example.Address][]byte{callee: calleeCode})
+	require.EqualValues(t, gasUsed, profiler.TotalGas())
+
+	sstore := profiler.OpStats()[evm.SSTORE]
+	require.EqualValues(t, 20000, sstore.Dynamic)
+	call := profiler.OpStats()[evm.CALL]
+	require.EqualValues(t, 700, call.Base)
+	frame := profiler.FrameStats()["00000000000000000000000000000000000000bb:fallback"]
+	require.EqualValues(t, 1, frame.Count)
+	require.EqualValues(t, 20006, frame.Gas)
+
+	var folded bytes.Buffer
+	require.NoError(t, profiler.WriteFolded(&folded))
+	require.Contains(t, folded.String(), "00000000000000000000000000000000000000aa:fallback;00000000000000000000000000000000000000bb:fallback;SSTORE 20000\n")
+	var report bytes.Buffer
+	require.NoError(t, profiler.WriteReport(&report, 10))
+	require.True(t, strings.HasPrefix(report.String(), "total gas: "))
+}
+
+func run(t *testing.T, tracer evm.Tracer, code []byte, contracts map[*example.Address][]byte) uint64 {
+	bc := example.NewBlockchain()
+	memoryDB := db.NewMemory(bc.NewAccount)
+	for address, code := range contracts {
+		account := memoryDB.GetAccount(address)
+		account.SetCode(code)
+		require.NoError(t, memoryDB.UpdateAccount(account))
+	}
+	var gasQuota uint64 = 1000000
+	var gas = gasQuota
+	vm := evm.New(bc, memoryDB, &evm.Context{
+		Gas: &gas,
+	})
+	vm.SetTracer(tracer)
+	_, err := vm.Call(example.RandomAddress(), example.HexToAddress("00000000000000000000000000000000000000aa"), code)
+	require.NoError(t, err)
+	return gasQuota - gas
+}
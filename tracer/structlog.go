@@ -0,0 +1,312 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tracer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/thu-arxan/evm"
+)
+
+// StructLog is the log of an executed opcode, which is encoded into json in
+// the format of geth json logger(EIP-3155)
+type StructLog struct {
+	PC      uint64
+	Op      evm.OpCode
+	Gas     uint64
+	GasCost uint64
+	// Memory is nil unless it is enabled
+	Memory  []byte
+	MemSize uint64
+	// Stack is from bottom to top
+	Stack  []*big.Int
+	Depth  int
+	Refund uint64
+	Err    error
+}
+
+type jsonStructLog struct {
+	PC      uint64   `json:"pc"`
+	Op      byte     `json:"op"`
+	Gas     string   `json:"gas"`
+	GasCost string   `json:"gasCost"`
+	Memory  string   `json:"memory,omitempty"`
+	MemSize uint64   `json:"memSize"`
+	Stack   []string `json:"stack"`
+	Depth   int      `json:"depth"`
+	Refund  uint64   `json:"refund"`
+	OpName  string   `json:"opName"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// MarshalJSON is the implementation of json.Marshaler
+func (l *StructLog) MarshalJSON() ([]byte, error) {
+	var log = jsonStructLog{
+		PC:      l.PC,
+		Op:      byte(l.Op),
+		Gas:     fmt.Sprintf("0x%x", l.Gas),
+		GasCost: fmt.Sprintf("0x%x", l.GasCost),
+		MemSize: l.MemSize,
+		Stack:   make([]string, len(l.Stack)),
+		Depth:   l.Depth,
+		Refund:  l.Refund,
+		OpName:  l.Op.String(),
+	}
+	if l.Memory != nil {
+		log.Memory = fmt.Sprintf("0x%x", l.Memory)
+	}
+	for i, value := range l.Stack {
+		log.Stack[i] = fmt.Sprintf("0x%x", value)
+	}
+	if l.Err != nil {
+		log.Error = l.Err.Error()
+	}
+	return json.Marshal(log)
+}
+
+// UnmarshalJSON is the implementation of json.Unmarshaler, it accepts the format of
+// geth json logger(EIP-3155) and the structLogs of geth debug_traceTransaction, in
+// which op is the name of opcode, gas is a number and memory is a list of words.
+func (l *StructLog) UnmarshalJSON(data []byte) (err error) {
+	var log struct {
+		PC      uint64          `json:"pc"`
+		Op      json.RawMessage `json:"op"`
+		Gas     json.RawMessage `json:"gas"`
+		GasCost json.RawMessage `json:"gasCost"`
+		Memory  json.RawMessage `json:"memory"`
+		MemSize *uint64         `json:"memSize"`
+		Stack   []string        `json:"stack"`
+		Depth   int             `json:"depth"`
+		Refund  json.RawMessage `json:"refund"`
+		Error   string          `json:"error"`
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		return err
+	}
+	*l = StructLog{
+		PC:    log.PC,
+		Depth: log.Depth,
+	}
+	if l.Op, err = parseOp(log.Op); err != nil {
+		return err
+	}
+	if l.Gas, err = parseUint(log.Gas); err != nil {
+		return fmt.Errorf("invalid gas: %v", err)
+	}
+	if l.GasCost, err = parseUint(log.GasCost); err != nil {
+		return fmt.Errorf("invalid gasCost: %v", err)
+	}
+	if l.Refund, err = parseUint(log.Refund); err != nil {
+		return fmt.Errorf("invalid refund: %v", err)
+	}
+	if l.Memory, err = parseMemory(log.Memory); err != nil {
+		return fmt.Errorf("invalid memory: %v", err)
+	}
+	if log.MemSize != nil {
+		l.MemSize = *log.MemSize
+	} else {
+		l.MemSize = uint64(len(l.Memory))
+	}
+	if log.Stack != nil {
+		l.Stack = make([]*big.Int, len(log.Stack))
+		for i, item := range log.Stack {
+			if l.Stack[i], err = parseBig(item); err != nil {
+				return fmt.Errorf("invalid stack: %v", err)
+			}
+		}
+	}
+	if log.Error != "" {
+		l.Err = errors.New(log.Error)
+	}
+	return nil
+}
+
+// opAliases are the names used by geth which differ from ours
+var opAliases = map[string]evm.OpCode{
+	"KECCAK256":  evm.SHA3,
+	"PREVRANDAO": evm.DIFFICULTY,
+	"SUICIDE":    evm.SELFDESTRUCT,
+}
+
+// parseOp parse op which is either a number or the name of opcode
+func parseOp(data json.RawMessage) (evm.OpCode, error) {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var op byte
+		if err := json.Unmarshal(data, &op); err != nil {
+			return 0, fmt.Errorf("invalid op %s", data)
+		}
+		return evm.OpCode(op), nil
+	}
+	if op, ok := evm.StringToOpCode(name); ok {
+		return op, nil
+	}
+	if op, ok := opAliases[name]; ok {
+		return op, nil
+	}
+	return 0, fmt.Errorf("unknown op %s", name)
+}
+
+// parseUint parse a number, a decimal string or a hex string with 0x, and empty data is 0
+func parseUint(data json.RawMessage) (uint64, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n uint64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return 0, fmt.Errorf("%s is not a number", data)
+		}
+		return n, nil
+	}
+	if strings.HasPrefix(s, "0x") {
+		return strconv.ParseUint(s[2:], 16, 64)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// parseBig parse a hex string, and 0x is optional
+func parseBig(s string) (*big.Int, error) {
+	s = strings.TrimPrefix(s, "0x")
+	if s == "" {
+		return new(big.Int), nil
+	}
+	value, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		return nil, fmt.Errorf("%s is not hex", s)
+	}
+	return value, nil
+}
+
+// parseMemory parse memory which is either a hex string or a list of hex words
+func parseMemory(data json.RawMessage) ([]byte, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var words []string
+		if err := json.Unmarshal(data, &words); err != nil {
+			return nil, err
+		}
+		for i := range words {
+			words[i] = strings.TrimPrefix(words[i], "0x")
+		}
+		s = strings.Join(words, "")
+	}
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+// StructLoggerConfig is the config of StructLogger
+type StructLoggerConfig struct {
+	EnableMemory bool
+	DisableStack bool
+	// Limit is the max count of logs, and 0 means no limit
+	Limit int
+}
+
+// StructLogger is a tracer which records the state before every opcode is executed,
+// and the gas cost of opcode which includes the gas used by the frames it calls.
+type StructLogger struct {
+	config StructLoggerConfig
+	logs   []*StructLog
+	// pending are the logs of running opcodes of every frame
+	pending []*StructLog
+}
+
+// NewStructLogger is the constructor of StructLogger, and config could be nil
+func NewStructLogger(config *StructLoggerConfig) *StructLogger {
+	var logger = &StructLogger{}
+	if config != nil {
+		logger.config = *config
+	}
+	return logger
+}
+
+// CaptureEnter is the implementation of evm.Tracer
+func (l *StructLogger) CaptureEnter(frame *evm.Frame) {}
+
+// CaptureState is the implementation of evm.Tracer
+func (l *StructLogger) CaptureState(step *evm.Step) {
+	if l.config.Limit > 0 && len(l.logs) >= l.config.Limit {
+		l.pending = append(l.pending, nil)
+		return
+	}
+	var log = &StructLog{
+		PC:      step.PC,
+		Op:      step.Op,
+		Gas:     step.Gas,
+		MemSize: step.Memory.Len(),
+		Depth:   step.Frame.Depth,
+		Refund:  step.Refund,
+	}
+	if !l.config.DisableStack {
+		log.Stack = make([]*big.Int, step.Stack.Len())
+		for i := range log.Stack {
+			log.Stack[len(log.Stack)-1-i] = step.Stack.Back(i)
+		}
+	}
+	if l.config.EnableMemory {
+		log.Memory, _ = step.Memory.Read(big.NewInt(0), new(big.Int).SetUint64(step.Memory.Len()))
+		if log.Memory == nil {
+			log.Memory = []byte{}
+		}
+	}
+	l.logs = append(l.logs, log)
+	l.pending = append(l.pending, log)
+}
+
+// CaptureStateEnd is the implementation of evm.Tracer
+func (l *StructLogger) CaptureStateEnd(step *evm.Step) {
+	if len(l.pending) == 0 {
+		return
+	}
+	log := l.pending[len(l.pending)-1]
+	l.pending = l.pending[:len(l.pending)-1]
+	if log != nil {
+		log.GasCost = step.Cost
+		log.Err = step.Err
+	}
+}
+
+// CaptureExit is the implementation of evm.Tracer
+func (l *StructLogger) CaptureExit(frame *evm.Frame, output []byte, gasUsed uint64, err error) {}
+
+// Logs return the logs in the executed order
+func (l *StructLogger) Logs() []*StructLog {
+	return l.logs
+}
+
+// WriteJSON writes logs into w, one json object per line
+func (l *StructLogger) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, log := range l.logs {
+		if err := encoder.Encode(log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package tracer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/thu-arxan/evm"
+	"github.com/thu-arxan/evm/example"
+	"github.com/thu-arxan/evm/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructLogger(t *testing.T) {
+	// PUSH1 1 PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	code := util.Hex2Bytes("600160005260206000f3")
+	logger := NewStructLogger(&StructLoggerConfig{EnableMemory: true})
+	run(t, logger, code, nil)
+	logs := logger.Logs()
+	require.Len(t, logs, 6)
+	require.Equal(t, evm.MSTORE, logs[2].Op)
+	require.EqualValues(t, 6, logs[2].GasCost)
+	require.Equal(t, "0x1", "0x"+logs[2].Stack[0].Text(16))
+	require.Equal(t, "0x0", "0x"+logs[2].Stack[1].Text(16))
+	require.EqualValues(t, 32, logs[3].MemSize)
+	require.Len(t, logs[3].Memory, 32)
+	require.Equal(t, logs[2].Gas-logs[2].GasCost, logs[3].Gas)
+
+	var buf bytes.Buffer
+	require.NoError(t, logger.WriteJSON(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 6)
+	require.Equal(t, `{"pc":4,"op":82,"gas":"0xf423a","gasCost":"0x6","memSize":0,"stack":["0x1","0x0"],"depth":1,"refund":0,"opName":"MSTORE"}`, strings.Replace(lines[2], `"memory":"0x",`, "", 1))
+}
+
+func TestStructLoggerCall(t *testing.T) {
+	calleeCode := util.Hex2Bytes("6001600055" + "00")
+	callee := example.HexToAddress("00000000000000000000000000000000000000bb")
+	code := util.Hex2Bytes("6000600060006000600073" + "00000000000000000000000000000000000000bb" + "61ffff" + "f1" + "00")
+	logger := NewStructLogger(&StructLoggerConfig{DisableStack: true, Limit: 8})
+	run(t, logger, code, map[*example.Address][]byte{callee: calleeCode})
+	logs := logger.Logs()
+	require.Len(t, logs, 8)
+	require.Equal(t, evm.CALL, logs[7].Op)
+	require.Equal(t, 1, logs[7].Depth)
+	require.Nil(t, logs[7].Stack)
+	// the cost of CALL includes the gas used by callee
+	require.True(t, logs[7].GasCost > 20000)
+}
@@ -0,0 +1,98 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+// The key of trie is walked by nibbles(half bytes), the hex key is the nibbles
+// of key which ends with a terminator 16. The key of short node is stored in
+// the compact(hex prefix) encoding, whose first nibble is the flags of odd
+// length and terminator.
+
+const terminator = 16
+
+func keybytesToHex(key []byte) []byte {
+	var nibbles = make([]byte, len(key)*2+1)
+	for i, b := range key {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	nibbles[len(nibbles)-1] = terminator
+	return nibbles
+}
+
+// hexToKeybytes turns hex nibbles into key bytes, and the terminator is ignored
+func hexToKeybytes(hex []byte) []byte {
+	if hasTerm(hex) {
+		hex = hex[:len(hex)-1]
+	}
+	var key = make([]byte, len(hex)/2)
+	for i := range key {
+		key[i] = hex[i*2]<<4 | hex[i*2+1]
+	}
+	return key
+}
+
+func hexToCompact(hex []byte) []byte {
+	var flag byte
+	if hasTerm(hex) {
+		flag = 2
+		hex = hex[:len(hex)-1]
+	}
+	var compact = make([]byte, len(hex)/2+1)
+	if len(hex)%2 == 1 {
+		flag |= 1
+		compact[0] = hex[0]
+		hex = hex[1:]
+	}
+	compact[0] |= flag << 4
+	for i := 0; i < len(hex); i += 2 {
+		compact[i/2+1] = hex[i]<<4 | hex[i+1]
+	}
+	return compact
+}
+
+func compactToHex(compact []byte) []byte {
+	if len(compact) == 0 {
+		return compact
+	}
+	hex := keybytesToHex(compact)
+	// the terminator is removed if the flag is not set
+	if hex[0] < 2 {
+		hex = hex[:len(hex)-1]
+	}
+	// skip the flag nibble, and the padding nibble if the length is even
+	return hex[2-hex[0]&1:]
+}
+
+func hasTerm(hex []byte) bool {
+	return len(hex) > 0 && hex[len(hex)-1] == terminator
+}
+
+func prefixLen(a, b []byte) int {
+	var i = 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func concat(a []byte, b ...byte) []byte {
+	var c = make([]byte, len(a)+len(b))
+	copy(c, a)
+	copy(c[len(a):], b)
+	return c
+}
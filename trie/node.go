@@ -0,0 +1,196 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"fmt"
+
+	"github.com/thu-arxan/evm/crypto"
+	"github.com/thu-arxan/evm/rlp"
+)
+
+// node is one of *fullNode, *shortNode, hashNode, valueNode or nil.
+// The nodes are never modified once they are hashed, the trie creates new
+// nodes on the path instead, so the cached hash is always valid.
+type node interface{}
+
+type (
+	// fullNode is the branch node, and Children[16] is the value of the key ends here
+	fullNode struct {
+		Children [17]node
+		flags    nodeFlag
+	}
+	// shortNode is the extension node, or the leaf node if Key ends with terminator
+	shortNode struct {
+		Key   []byte
+		Val   node
+		flags nodeFlag
+	}
+	// hashNode is the hash of a node which is not loaded from NodeStore
+	hashNode []byte
+	// valueNode is the value of a key
+	valueNode []byte
+)
+
+type nodeFlag struct {
+	// hash is the cached hash, which is only set if the encoding of node is
+	// not shorter than 32 bytes
+	hash hashNode
+	// dirty is set if the node is not committed to NodeStore
+	dirty bool
+}
+
+func newFlag() nodeFlag {
+	return nodeFlag{dirty: true}
+}
+
+func (n *fullNode) copy() *fullNode {
+	var c = *n
+	c.flags = newFlag()
+	return &c
+}
+
+// encodeNode return the rlp of a full node or short node, in which the
+// children are referenced by hash, or embedded if the rlp of child is shorter
+// than 32 bytes
+func encodeNode(n node) []byte {
+	var items []interface{}
+	switch n := n.(type) {
+	case *shortNode:
+		items = []interface{}{hexToCompact(n.Key), reference(n.Val)}
+	case *fullNode:
+		items = make([]interface{}, 17)
+		for i := range n.Children {
+			items[i] = reference(n.Children[i])
+		}
+	default:
+		panic(fmt.Sprintf("unexpected node %T", n))
+	}
+	data, err := rlp.EncodeToBytes(items)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// reference return the item of node in the rlp of its parent
+func reference(n node) interface{} {
+	switch n := n.(type) {
+	case nil:
+		return []byte{}
+	case valueNode:
+		return []byte(n)
+	case hashNode:
+		return []byte(n)
+	}
+	if hash := cachedHash(n); hash != nil {
+		return []byte(hash)
+	}
+	data := encodeNode(n)
+	if len(data) < 32 {
+		return rlp.RawValue(data)
+	}
+	hash := hashNode(crypto.Keccak256(data))
+	setHash(n, hash)
+	return []byte(hash)
+}
+
+func cachedHash(n node) hashNode {
+	switch n := n.(type) {
+	case *shortNode:
+		return n.flags.hash
+	case *fullNode:
+		return n.flags.hash
+	}
+	return nil
+}
+
+func setHash(n node, hash hashNode) {
+	switch n := n.(type) {
+	case *shortNode:
+		n.flags.hash = hash
+	case *fullNode:
+		n.flags.hash = hash
+	}
+}
+
+// decodeNode decode the rlp of a node, hash is the hash of node or nil if the node is embedded
+func decodeNode(hash hashNode, data []byte) (node, error) {
+	elems, _, err := rlp.SplitList(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode node: %v", err)
+	}
+	count, err := rlp.CountValues(elems)
+	if err != nil {
+		return nil, fmt.Errorf("decode node: %v", err)
+	}
+	switch count {
+	case 2:
+		key, rest, err := rlp.SplitString(elems)
+		if err != nil {
+			return nil, fmt.Errorf("decode short node: %v", err)
+		}
+		var n = &shortNode{Key: compactToHex(key), flags: nodeFlag{hash: hash}}
+		if hasTerm(n.Key) {
+			value, _, err := rlp.SplitString(rest)
+			if err != nil {
+				return nil, fmt.Errorf("decode value of short node: %v", err)
+			}
+			n.Val = valueNode(value)
+		} else if n.Val, _, err = decodeRef(rest); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case 17:
+		var n = &fullNode{flags: nodeFlag{hash: hash}}
+		for i := 0; i < 16; i++ {
+			if n.Children[i], elems, err = decodeRef(elems); err != nil {
+				return nil, err
+			}
+		}
+		value, _, err := rlp.SplitString(elems)
+		if err != nil {
+			return nil, fmt.Errorf("decode value of full node: %v", err)
+		}
+		if len(value) > 0 {
+			n.Children[16] = valueNode(value)
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("decode node: invalid number of list elements %d", count)
+	}
+}
+
+// decodeRef decode a child which is embedded or referenced by hash
+func decodeRef(data []byte) (node, []byte, error) {
+	kind, value, rest, err := rlp.Split(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode child: %v", err)
+	}
+	switch {
+	case kind == rlp.List:
+		n, err := decodeNode(nil, data[:len(data)-len(rest)])
+		return n, rest, err
+	case kind == rlp.String && len(value) == 0:
+		return nil, rest, nil
+	case kind == rlp.String && len(value) == 32:
+		return hashNode(value), rest, nil
+	default:
+		return nil, nil, fmt.Errorf("decode child: invalid reference of %d bytes", len(value))
+	}
+}
@@ -0,0 +1,133 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/thu-arxan/evm/crypto"
+)
+
+// Prove return the proof of key, which is the rlp of nodes on the path from
+// root to key, and the nodes embedded in their parents are not included.
+// The proof of a key which is not exist proves that the key is absent.
+func (t *Trie) Prove(key []byte) ([][]byte, error) {
+	var nodes []node
+	var n = t.root
+	var hex = keybytesToHex(key)
+	for len(hex) > 0 && n != nil {
+		switch nn := n.(type) {
+		case *shortNode:
+			nodes = append(nodes, nn)
+			if len(hex) < len(nn.Key) || !bytes.Equal(nn.Key, hex[:len(nn.Key)]) {
+				n = nil
+			} else {
+				n, hex = nn.Val, hex[len(nn.Key):]
+			}
+		case *fullNode:
+			nodes = append(nodes, nn)
+			n, hex = nn.Children[hex[0]], hex[1:]
+		case hashNode:
+			resolved, err := t.resolve(nn)
+			if err != nil {
+				return nil, err
+			}
+			n = resolved
+		case valueNode:
+			n = nil
+		default:
+			panic(fmt.Sprintf("unexpected node %T", n))
+		}
+	}
+	var proof = make([][]byte, 0, len(nodes))
+	for i, n := range nodes {
+		data := encodeNode(n)
+		if i == 0 || len(data) >= 32 {
+			proof = append(proof, data)
+		}
+	}
+	return proof, nil
+}
+
+// Prove return the proof of key, and the key is hashed as the trie does
+func (t *SecureTrie) Prove(key []byte) ([][]byte, error) {
+	return t.trie.Prove(crypto.Keccak256(key))
+}
+
+// VerifyProof check the proof of key against root, and return the value of
+// key, or nil if the proof proves the key is absent. An error is returned if
+// the proof is not valid.
+// Note: The key of a secure trie should be hashed by caller.
+func VerifyProof(root, key []byte, proof [][]byte) ([]byte, error) {
+	var nodes = make(map[string][]byte, len(proof))
+	for _, data := range proof {
+		nodes[string(crypto.Keccak256(data))] = data
+	}
+	var hash = hashNode(root)
+	var hex = keybytesToHex(key)
+	for i := 0; ; i++ {
+		data, ok := nodes[string(hash)]
+		if !ok {
+			if i == 0 && bytes.Equal(root, EmptyRoot) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("proof node %d(hash %x) is missing", i, []byte(hash))
+		}
+		n, err := decodeNode(hash, data)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %d: %v", i, err)
+		}
+		var next hashNode
+		next, hex, n = walk(n, hex)
+		if next == nil {
+			if value, ok := n.(valueNode); ok {
+				return value, nil
+			}
+			return nil, nil
+		}
+		hash = next
+	}
+}
+
+// walk walks in the node and its embedded children, and return the hash of next
+// node to be resolved, or the value node or nil if the walk ends
+func walk(n node, hex []byte) (hashNode, []byte, node) {
+	for {
+		switch nn := n.(type) {
+		case nil:
+			return nil, nil, nil
+		case valueNode:
+			if len(hex) != 0 {
+				return nil, nil, nil
+			}
+			return nil, nil, nn
+		case *shortNode:
+			if len(hex) < len(nn.Key) || !bytes.Equal(nn.Key, hex[:len(nn.Key)]) {
+				return nil, nil, nil
+			}
+			n, hex = nn.Val, hex[len(nn.Key):]
+		case *fullNode:
+			n, hex = nn.Children[hex[0]], hex[1:]
+		case hashNode:
+			return nn, hex, nil
+		default:
+			panic(fmt.Sprintf("unexpected node %T", n))
+		}
+	}
+}
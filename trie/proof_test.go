@@ -0,0 +1,113 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"github.com/thu-arxan/evm/crypto"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProof(t *testing.T) {
+	// empty trie proves every key is absent
+	trie, err := New(nil, nil)
+	require.NoError(t, err)
+	proof, err := trie.Prove([]byte("dog"))
+	require.NoError(t, err)
+	value, err := VerifyProof(EmptyRoot, []byte("dog"), proof)
+	require.NoError(t, err)
+	require.Nil(t, value)
+
+	var r = rand.New(rand.NewSource(1))
+	var kvs = make(map[string][]byte)
+	for i := 0; i < 500; i++ {
+		key := []byte(fmt.Sprintf("key%d", r.Intn(1000)))
+		// short values are embedded in their parents
+		value := make([]byte, 1+r.Intn(40))
+		r.Read(value)
+		kvs[string(key)] = value
+		require.NoError(t, trie.Update(key, value))
+	}
+	root := trie.Hash()
+	for k, v := range kvs {
+		proof, err := trie.Prove([]byte(k))
+		require.NoError(t, err)
+		value, err := VerifyProof(root, []byte(k), proof)
+		require.NoError(t, err)
+		require.Equal(t, v, value)
+	}
+	for _, k := range []string{"key", "key1000", "dog", "key99x"} {
+		proof, err := trie.Prove([]byte(k))
+		require.NoError(t, err)
+		value, err := VerifyProof(root, []byte(k), proof)
+		require.NoError(t, err)
+		require.Nil(t, value)
+	}
+
+	// the proof could be generated from a trie loaded from store
+	store := NewMemoryStore()
+	trie, err = New(nil, store)
+	require.NoError(t, err)
+	for k, v := range kvs {
+		require.NoError(t, trie.Update([]byte(k), v))
+	}
+	_, err = trie.Commit()
+	require.NoError(t, err)
+	loaded, err := New(root, store)
+	require.NoError(t, err)
+	for k, v := range kvs {
+		proof, err := loaded.Prove([]byte(k))
+		require.NoError(t, err)
+		value, err := VerifyProof(root, []byte(k), proof)
+		require.NoError(t, err)
+		require.Equal(t, v, value)
+
+		// a tampered proof is not valid
+		last := append([]byte{}, proof[len(proof)-1]...)
+		last[len(last)-1] ^= 0xff
+		proof[len(proof)-1] = last
+		_, err = VerifyProof(root, []byte(k), proof)
+		require.Error(t, err)
+		// a proof against another root is not valid
+		_, err = VerifyProof(crypto.Keccak256([]byte(k)), []byte(k), proof[:1])
+		require.Error(t, err)
+		// a proof missing nodes is not valid
+		if len(proof) > 1 {
+			_, err = VerifyProof(root, []byte(k), proof[:len(proof)-1])
+			require.Error(t, err)
+		}
+	}
+}
+
+func TestSecureProof(t *testing.T) {
+	trie, err := NewSecure(nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, trie.Update([]byte("dog"), []byte("puppy")))
+	require.NoError(t, trie.Update([]byte("horse"), []byte("stallion")))
+	proof, err := trie.Prove([]byte("dog"))
+	require.NoError(t, err)
+	value, err := VerifyProof(trie.Hash(), crypto.Keccak256([]byte("dog")), proof)
+	require.NoError(t, err)
+	require.Equal(t, []byte("puppy"), value)
+	value, err = VerifyProof(trie.Hash(), []byte("dog"), proof)
+	require.NoError(t, err)
+	require.Nil(t, value)
+}
@@ -0,0 +1,63 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"github.com/thu-arxan/evm/crypto"
+)
+
+// SecureTrie is a trie whose keys are hashed by keccak256 before they are used,
+// so the depth of trie is bounded even if the keys are chosen by attackers.
+// The state trie and storage tries of ethereum are secure tries.
+type SecureTrie struct {
+	trie *Trie
+}
+
+// NewSecure return the secure trie of root, and nil or EmptyRoot means an empty trie
+func NewSecure(root []byte, store NodeStore) (*SecureTrie, error) {
+	t, err := New(root, store)
+	if err != nil {
+		return nil, err
+	}
+	return &SecureTrie{trie: t}, nil
+}
+
+// Get return the value of key, and nil if the key is not exist
+func (t *SecureTrie) Get(key []byte) ([]byte, error) {
+	return t.trie.Get(crypto.Keccak256(key))
+}
+
+// Update set the value of key, and the key is deleted if value is empty
+func (t *SecureTrie) Update(key, value []byte) error {
+	return t.trie.Update(crypto.Keccak256(key), value)
+}
+
+// Delete delete the key, and nothing happens if the key is not exist
+func (t *SecureTrie) Delete(key []byte) error {
+	return t.trie.Delete(crypto.Keccak256(key))
+}
+
+// Hash return the root hash of trie
+func (t *SecureTrie) Hash() []byte {
+	return t.trie.Hash()
+}
+
+// Commit write the nodes modified since last commit into store, and return the root hash
+func (t *SecureTrie) Commit() ([]byte, error) {
+	return t.trie.Commit()
+}
@@ -0,0 +1,384 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Package trie implements the Merkle Patricia Trie of ethereum, which is
+// used to compute the state root and storage roots.
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/thu-arxan/evm/crypto"
+)
+
+// EmptyRoot is the root hash of an empty trie, which is keccak256(rlp(""))
+var EmptyRoot = []byte{
+	0x56, 0xe8, 0x1f, 0x17, 0x1b, 0xcc, 0x55, 0xa6, 0xff, 0x83, 0x45, 0xe6, 0x92, 0xc0, 0xf8, 0x6e,
+	0x5b, 0x48, 0xe0, 0x1b, 0x99, 0x6c, 0xad, 0xc0, 0x01, 0x62, 0x2f, 0xb5, 0xe3, 0x63, 0xb4, 0x21,
+}
+
+// ErrMissingNode is returned if a node is not found in NodeStore
+var ErrMissingNode = errors.New("missing trie node")
+
+// NodeStore is the storage of trie nodes, which are keyed by the keccak256 of node
+type NodeStore interface {
+	// Get return nil if the node is not exist
+	Get(hash []byte) ([]byte, error)
+	Put(hash, node []byte) error
+}
+
+// MemoryStore is a NodeStore in memory
+type MemoryStore struct {
+	nodes map[string][]byte
+}
+
+// NewMemoryStore is the constructor of MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		nodes: make(map[string][]byte),
+	}
+}
+
+// Get is the implementation of interface
+func (s *MemoryStore) Get(hash []byte) ([]byte, error) {
+	return s.nodes[string(hash)], nil
+}
+
+// Put is the implementation of interface
+func (s *MemoryStore) Put(hash, node []byte) error {
+	s.nodes[string(hash)] = node
+	return nil
+}
+
+// Len return the number of nodes
+func (s *MemoryStore) Len() int {
+	return len(s.nodes)
+}
+
+// Trie is a Merkle Patricia Trie, the nodes are loaded from NodeStore once
+// they are visited, and the modified nodes are kept in memory until Commit.
+// Note: Trie is not thread safety.
+type Trie struct {
+	root  node
+	store NodeStore
+}
+
+// New return the trie of root, and nil or EmptyRoot means an empty trie.
+// The store could be nil if the trie is never loaded from or committed to a store.
+func New(root []byte, store NodeStore) (*Trie, error) {
+	var t = &Trie{store: store}
+	if len(root) != 0 && !bytes.Equal(root, EmptyRoot) {
+		n, err := t.resolve(hashNode(root))
+		if err != nil {
+			return nil, err
+		}
+		t.root = n
+	}
+	return t, nil
+}
+
+// Get return the value of key, and nil if the key is not exist
+func (t *Trie) Get(key []byte) ([]byte, error) {
+	var n = t.root
+	var hex = keybytesToHex(key)
+	for {
+		switch nn := n.(type) {
+		case nil:
+			return nil, nil
+		case valueNode:
+			if len(hex) != 0 {
+				return nil, nil
+			}
+			return nn, nil
+		case *shortNode:
+			if len(hex) < len(nn.Key) || !bytes.Equal(nn.Key, hex[:len(nn.Key)]) {
+				return nil, nil
+			}
+			n, hex = nn.Val, hex[len(nn.Key):]
+		case *fullNode:
+			n, hex = nn.Children[hex[0]], hex[1:]
+		case hashNode:
+			resolved, err := t.resolve(nn)
+			if err != nil {
+				return nil, err
+			}
+			n = resolved
+		default:
+			panic(fmt.Sprintf("unexpected node %T", n))
+		}
+	}
+}
+
+// Update set the value of key, and the key is deleted if value is empty
+func (t *Trie) Update(key, value []byte) error {
+	if len(value) == 0 {
+		return t.Delete(key)
+	}
+	n, err := t.insert(t.root, keybytesToHex(key), valueNode(value))
+	if err != nil {
+		return err
+	}
+	t.root = n
+	return nil
+}
+
+// Delete delete the key, and nothing happens if the key is not exist
+func (t *Trie) Delete(key []byte) error {
+	n, err := t.delete(t.root, keybytesToHex(key))
+	if err != nil {
+		return err
+	}
+	t.root = n
+	return nil
+}
+
+// Hash return the root hash of trie
+func (t *Trie) Hash() []byte {
+	switch n := t.root.(type) {
+	case nil:
+		return EmptyRoot
+	case hashNode:
+		return n
+	}
+	if hash := cachedHash(t.root); hash != nil {
+		return hash
+	}
+	// the root is always hashed even if it is shorter than 32 bytes
+	return crypto.Keccak256(encodeNode(t.root))
+}
+
+// Commit write the nodes modified since last commit into store, and return the root hash
+func (t *Trie) Commit() ([]byte, error) {
+	if t.store == nil {
+		return nil, errors.New("commit a trie without node store")
+	}
+	if t.root == nil {
+		return EmptyRoot, nil
+	}
+	if err := t.commit(t.root, true); err != nil {
+		return nil, err
+	}
+	return t.Hash(), nil
+}
+
+func (t *Trie) commit(n node, isRoot bool) error {
+	switch n := n.(type) {
+	case *shortNode:
+		if !n.flags.dirty {
+			return nil
+		}
+		if err := t.commit(n.Val, false); err != nil {
+			return err
+		}
+	case *fullNode:
+		if !n.flags.dirty {
+			return nil
+		}
+		for _, child := range n.Children {
+			if err := t.commit(child, false); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	// the node shorter than 32 bytes is embedded in its parent
+	data := encodeNode(n)
+	if len(data) >= 32 || isRoot {
+		hash := crypto.Keccak256(data)
+		if err := t.store.Put(hash, data); err != nil {
+			return err
+		}
+		if len(data) >= 32 {
+			setHash(n, hash)
+		}
+	}
+	switch n := n.(type) {
+	case *shortNode:
+		n.flags.dirty = false
+	case *fullNode:
+		n.flags.dirty = false
+	}
+	return nil
+}
+
+func (t *Trie) resolve(hash hashNode) (node, error) {
+	if t.store == nil {
+		return nil, fmt.Errorf("%w %x", ErrMissingNode, []byte(hash))
+	}
+	data, err := t.store.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("%w %x", ErrMissingNode, []byte(hash))
+	}
+	return decodeNode(hash, data)
+}
+
+// insert return the new node which value is inserted at key
+func (t *Trie) insert(n node, key []byte, value node) (node, error) {
+	if len(key) == 0 {
+		return value, nil
+	}
+	switch n := n.(type) {
+	case nil:
+		return &shortNode{Key: key, Val: value, flags: newFlag()}, nil
+	case *shortNode:
+		match := prefixLen(key, n.Key)
+		if match == len(n.Key) {
+			child, err := t.insert(n.Val, key[match:], value)
+			if err != nil {
+				return nil, err
+			}
+			return &shortNode{Key: n.Key, Val: child, flags: newFlag()}, nil
+		}
+		// the keys diverge at match, so a branch is inserted there
+		var branch = &fullNode{flags: newFlag()}
+		var err error
+		if branch.Children[n.Key[match]], err = t.insert(nil, n.Key[match+1:], n.Val); err != nil {
+			return nil, err
+		}
+		if branch.Children[key[match]], err = t.insert(nil, key[match+1:], value); err != nil {
+			return nil, err
+		}
+		if match == 0 {
+			return branch, nil
+		}
+		return &shortNode{Key: key[:match], Val: branch, flags: newFlag()}, nil
+	case *fullNode:
+		child, err := t.insert(n.Children[key[0]], key[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n = n.copy()
+		n.Children[key[0]] = child
+		return n, nil
+	case hashNode:
+		resolved, err := t.resolve(n)
+		if err != nil {
+			return nil, err
+		}
+		return t.insert(resolved, key, value)
+	default:
+		panic(fmt.Sprintf("unexpected node %T", n))
+	}
+}
+
+// delete return the new node which key is deleted from
+func (t *Trie) delete(n node, key []byte) (node, error) {
+	switch n := n.(type) {
+	case nil:
+		return nil, nil
+	case valueNode:
+		if len(key) == 0 {
+			return nil, nil
+		}
+		return n, nil
+	case *shortNode:
+		match := prefixLen(key, n.Key)
+		if match < len(n.Key) {
+			return n, nil
+		}
+		if match == len(key) {
+			return nil, nil
+		}
+		child, err := t.delete(n.Val, key[match:])
+		if err != nil {
+			return nil, err
+		}
+		switch child := child.(type) {
+		case nil:
+			return nil, nil
+		case *shortNode:
+			// merge the short nodes, since a short node never has a short child
+			return &shortNode{Key: concat(n.Key, child.Key...), Val: child.Val, flags: newFlag()}, nil
+		default:
+			if sameNode(child, n.Val) {
+				return n, nil
+			}
+			return &shortNode{Key: n.Key, Val: child, flags: newFlag()}, nil
+		}
+	case *fullNode:
+		child, err := t.delete(n.Children[key[0]], key[1:])
+		if err != nil {
+			return nil, err
+		}
+		if sameNode(child, n.Children[key[0]]) {
+			return n, nil
+		}
+		n = n.copy()
+		n.Children[key[0]] = child
+		// a branch with only one child is reduced to a short node
+		var pos = -1
+		for i, c := range n.Children {
+			if c != nil {
+				if pos != -1 {
+					return n, nil
+				}
+				pos = i
+			}
+		}
+		if pos == -1 {
+			return nil, nil
+		}
+		if pos == terminator {
+			return &shortNode{Key: []byte{terminator}, Val: n.Children[pos], flags: newFlag()}, nil
+		}
+		only := n.Children[pos]
+		if hash, ok := only.(hashNode); ok {
+			if only, err = t.resolve(hash); err != nil {
+				return nil, err
+			}
+		}
+		if short, ok := only.(*shortNode); ok {
+			return &shortNode{Key: concat([]byte{byte(pos)}, short.Key...), Val: short.Val, flags: newFlag()}, nil
+		}
+		return &shortNode{Key: []byte{byte(pos)}, Val: n.Children[pos], flags: newFlag()}, nil
+	case hashNode:
+		resolved, err := t.resolve(n)
+		if err != nil {
+			return nil, err
+		}
+		return t.delete(resolved, key)
+	default:
+		panic(fmt.Sprintf("unexpected node %T", n))
+	}
+}
+
+// sameNode return true if b is a, which means the node is not changed
+func sameNode(a, b node) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case *shortNode:
+		bb, ok := b.(*shortNode)
+		return ok && a == bb
+	case *fullNode:
+		bb, ok := b.(*fullNode)
+		return ok && a == bb
+	case valueNode:
+		bb, ok := b.(valueNode)
+		return ok && bytes.Equal(a, bb)
+	case hashNode:
+		bb, ok := b.(hashNode)
+		return ok && bytes.Equal(a, bb)
+	}
+	return false
+}
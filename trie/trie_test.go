@@ -0,0 +1,170 @@
+//  Copyright 2020 The THU-Arxan Authors
+//  This file is part of the evm library.
+//
+//  The evm library is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  The evm library is distributed in the hope that it will be useful,/
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with the evm library. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"github.com/thu-arxan/evm/util"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type kv struct {
+	k, v string
+}
+
+func mustHex(s string) []byte {
+	data, err := util.HexToBytes(s)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func TestEmptyTrie(t *testing.T) {
+	trie, err := New(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, mustHex("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"), trie.Hash())
+	value, err := trie.Get([]byte("dog"))
+	require.NoError(t, err)
+	require.Nil(t, value)
+	// delete on an empty trie
+	require.NoError(t, trie.Delete([]byte("dog")))
+	require.Equal(t, EmptyRoot, trie.Hash())
+}
+
+// the vectors are from the TrieTests of ethereum tests
+func TestTrieVectors(t *testing.T) {
+	var longValue = strings.Repeat("a", 50)
+	var cases = []struct {
+		name string
+		kvs  []kv
+		root string
+	}{
+		{"singleItem", []kv{{"A", longValue}}, "d23786fb4a010da3ce639d66d5e904a11dbc02746d1ce25029e53290cabf28ab"},
+		{"dogs", []kv{{"doe", "reindeer"}, {"dog", "puppy"}, {"dogglesworth", "cat"}}, "8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3"},
+		// the empty value deletes the key
+		{"puppy", []kv{
+			{"do", "verb"}, {"ether", "wookiedoo"}, {"horse", "stallion"}, {"shaman", "horse"},
+			{"doge", "coin"}, {"ether", ""}, {"dog", "puppy"}, {"shaman", ""},
+		}, "5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84"},
+	}
+	for _, c := range cases {
+		trie, err := New(nil, NewMemoryStore())
+		require.NoError(t, err)
+		for _, kv := range c.kvs {
+			require.NoError(t, trie.Update([]byte(kv.k), []byte(kv.v)), c.name)
+		}
+		require.Equal(t, mustHex(c.root), trie.Hash(), c.name)
+		root, err := trie.Commit()
+		require.NoError(t, err)
+		require.Equal(t, mustHex(c.root), root, c.name)
+	}
+}
+
+func TestSecureTrie(t *testing.T) {
+	// emptyValues of trietest_secureTrie
+	trie, err := NewSecure(nil, nil)
+	require.NoError(t, err)
+	for _, kv := range []kv{
+		{"do", "verb"}, {"ether", "wookiedoo"}, {"horse", "stallion"}, {"shaman", "horse"},
+		{"doge", "coin"}, {"ether", ""}, {"dog", "puppy"}, {"shaman", ""},
+	} {
+		require.NoError(t, trie.Update([]byte(kv.k), []byte(kv.v)))
+	}
+	require.Equal(t, mustHex("29b235a58c3c25ab83010c327d5932bcf05324b7d6b1185e650798034783ca9d"), trie.Hash())
+	value, err := trie.Get([]byte("doge"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("coin"), value)
+}
+
+func TestTrieCommit(t *testing.T) {
+	var r = rand.New(rand.NewSource(1))
+	var store = NewMemoryStore()
+	trie, err := New(nil, store)
+	require.NoError(t, err)
+	var values = make(map[string][]byte)
+	for i := 0; i < 500; i++ {
+		key := make([]byte, 1+r.Intn(40))
+		r.Read(key)
+		value := []byte(fmt.Sprintf("value%d", i))
+		values[string(key)] = value
+		require.NoError(t, trie.Update(key, value))
+	}
+	root, err := trie.Commit()
+	require.NoError(t, err)
+	nodes := store.Len()
+	// nothing is written if nothing changed
+	_, err = trie.Commit()
+	require.NoError(t, err)
+	require.Equal(t, nodes, store.Len())
+
+	// the trie is loaded from store
+	loaded, err := New(root, store)
+	require.NoError(t, err)
+	for key, value := range values {
+		got, err := loaded.Get([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	}
+	// delete half of keys on the loaded trie, and it equals to the trie built by the left keys
+	rebuilt, err := New(nil, nil)
+	require.NoError(t, err)
+	var i = 0
+	for key, value := range values {
+		if i%2 == 0 {
+			require.NoError(t, loaded.Delete([]byte(key)))
+		} else {
+			require.NoError(t, rebuilt.Update([]byte(key), value))
+		}
+		i++
+	}
+	require.Equal(t, rebuilt.Hash(), loaded.Hash())
+	root, err = loaded.Commit()
+	require.NoError(t, err)
+	require.Equal(t, rebuilt.Hash(), root)
+	for key := range values {
+		require.NoError(t, loaded.Delete([]byte(key)))
+	}
+	require.Equal(t, EmptyRoot, loaded.Hash())
+
+	// the missing node is reported
+	_, err = New(root, NewMemoryStore())
+	require.True(t, errors.Is(err, ErrMissingNode))
+}
+
+func TestCompact(t *testing.T) {
+	for _, c := range []struct {
+		hex, compact []byte
+	}{
+		{[]byte{}, []byte{0x00}},
+		{[]byte{16}, []byte{0x20}},
+		{[]byte{1, 2, 3, 4, 5}, []byte{0x11, 0x23, 0x45}},
+		{[]byte{0, 1, 2, 3, 4, 5}, []byte{0x00, 0x01, 0x23, 0x45}},
+		{[]byte{15, 1, 12, 11, 8, 16}, []byte{0x3f, 0x1c, 0xb8}},
+		{[]byte{0, 15, 1, 12, 11, 8, 16}, []byte{0x20, 0x0f, 0x1c, 0xb8}},
+	} {
+		require.Equal(t, c.compact, hexToCompact(c.hex))
+		require.Equal(t, c.hex, compactToHex(c.compact))
+	}
+	require.Equal(t, []byte("dog"), hexToKeybytes(keybytesToHex([]byte("dog"))))
+}